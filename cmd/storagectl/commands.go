@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/logos-storage/logos-storage-go-bindings/storage"
+)
+
+func setupUpload(fs *flag.FlagSet) runFunc {
+	name := fs.String("name", "", "file `name` of the dataset, used to detect the mimetype (default the base name of the file)")
+	chunkSize := fs.String("chunk-size", "", "upload chunk `size`, like 64KiB (default 64KiB)")
+
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		options := storage.UploadOptions{Filepath: *name}
+
+		if *chunkSize != "" {
+			size, err := storage.ParseByteSize(*chunkSize)
+			if err != nil {
+				return err
+			}
+			options.ChunkSize = storage.ChunkSize(size)
+		}
+
+		r := a.stdin
+		var total int64
+
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			stat, err := f.Stat()
+			if err != nil {
+				return err
+			}
+
+			r = f
+			total = stat.Size()
+
+			if options.Filepath == "" {
+				options.Filepath = filepath.Base(args[0])
+			}
+		}
+
+		bar := a.newProgress("upload", total)
+		options.OnProgress = func(read, total int, percent float64, err error) {
+			bar.set(int64(total))
+		}
+
+		cid, err := node.UploadReader(ctx, options, r)
+		bar.finish()
+		if err != nil {
+			return err
+		}
+
+		return a.output(map[string]any{"cid": cid}, func(w io.Writer) {
+			fmt.Fprintln(w, cid)
+		})
+	}
+}
+
+func setupDownload(fs *flag.FlagSet) runFunc {
+	output := fs.String("o", "", "output `file` (default stdout)")
+	local := fs.Bool("local", false, "download from the local node only")
+	chunkSize := fs.String("chunk-size", "", "download chunk `size`, like 64KiB (default 64KiB)")
+
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		cid := args[0]
+
+		options := storage.DownloadStreamOptions{Local: *local}
+
+		if *chunkSize != "" {
+			size, err := storage.ParseByteSize(*chunkSize)
+			if err != nil {
+				return err
+			}
+			options.ChunkSize = storage.ChunkSize(size)
+		}
+
+		if *output != "" {
+			options.Filepath = *output
+		} else {
+			options.Writer = a.stdout
+		}
+
+		// The size is only needed to draw the progress bar
+		if a.progress {
+			manifest, err := node.DownloadManifest(cid)
+			if err != nil {
+				return err
+			}
+			options.DatasetSize = manifest.DatasetSize
+		}
+
+		bar := a.newProgress("download", int64(options.DatasetSize))
+		var written int64
+		options.OnProgress = func(read, total int, percent float64, err error) {
+			written = int64(total)
+			bar.set(written)
+		}
+
+		err := node.DownloadStream(ctx, cid, options)
+		bar.finish()
+		if err != nil {
+			return err
+		}
+
+		// The content is the output when it is written to stdout
+		if *output == "" {
+			return nil
+		}
+
+		result := map[string]any{"cid": cid, "path": *output, "bytes": written}
+		return a.output(result, func(w io.Writer) {
+			fmt.Fprintf(w, "%s written to %s\n", humanBytes(written), *output)
+		})
+	}
+}
+
+func setupList(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		manifests, err := node.Manifests()
+		if err != nil {
+			return err
+		}
+
+		if manifests == nil {
+			manifests = []storage.Manifest{}
+		}
+
+		return a.output(manifests, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "CID\tSIZE\tFILENAME\tMIMETYPE")
+			for _, m := range manifests {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", m.Cid, humanBytes(int64(m.DatasetSize)), m.Filename, m.Mimetype)
+			}
+			tw.Flush()
+		})
+	}
+}
+
+func setupRemove(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		for _, cid := range args {
+			if err := node.Delete(cid); err != nil {
+				return fmt.Errorf("%s: %w", cid, err)
+			}
+		}
+
+		return a.output(map[string]any{"deleted": args}, func(w io.Writer) {
+			for _, cid := range args {
+				fmt.Fprintln(w, cid)
+			}
+		})
+	}
+}
+
+func setupExists(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		exists, err := node.Exists(args[0])
+		if err != nil {
+			return err
+		}
+
+		return a.output(map[string]any{"cid": args[0], "exists": exists}, func(w io.Writer) {
+			fmt.Fprintln(w, exists)
+		})
+	}
+}
+
+func setupFetch(fs *flag.FlagSet) runFunc {
+	timeout := fs.Duration("timeout", 0, "maximum `duration` of the fetch (default no timeout)")
+
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		var bar *progressBar
+
+		manifest, err := node.FetchContext(ctx, args[0], storage.FetchOptions{
+			Timeout: *timeout,
+			OnProgress: func(p storage.FetchProgress) {
+				if bar == nil {
+					bar = a.newProgress("fetch", int64(p.DatasetSize))
+				}
+				bar.set(int64(p.BytesStored))
+			},
+		})
+		bar.finish()
+		if err != nil {
+			return err
+		}
+
+		return a.output(manifest, func(w io.Writer) {
+			printManifest(w, manifest)
+		})
+	}
+}
+
+func setupManifest(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		manifest, err := node.DownloadManifest(args[0])
+		if err != nil {
+			return err
+		}
+
+		return a.output(manifest, func(w io.Writer) {
+			printManifest(w, manifest)
+		})
+	}
+}
+
+func printManifest(w io.Writer, m storage.Manifest) {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(tw, "Cid:\t%s\n", m.Cid)
+	fmt.Fprintf(tw, "Tree cid:\t%s\n", m.TreeCid)
+	fmt.Fprintf(tw, "Size:\t%s (%d bytes)\n", humanBytes(int64(m.DatasetSize)), m.DatasetSize)
+	fmt.Fprintf(tw, "Block size:\t%d\n", m.BlockSize)
+	fmt.Fprintf(tw, "Filename:\t%s\n", m.Filename)
+	fmt.Fprintf(tw, "Mimetype:\t%s\n", m.Mimetype)
+	fmt.Fprintf(tw, "Protected:\t%t\n", m.Protected)
+	tw.Flush()
+}
+
+func setupSpace(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		space, err := node.Space()
+		if err != nil {
+			return err
+		}
+
+		return a.output(space, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+			fmt.Fprintf(tw, "Blocks:\t%d\n", space.TotalBlocks)
+			fmt.Fprintf(tw, "Quota:\t%s\n", humanBytes(space.QuotaMaxBytes))
+			fmt.Fprintf(tw, "Used:\t%s\n", humanBytes(space.QuotaUsedBytes))
+			fmt.Fprintf(tw, "Reserved:\t%s\n", humanBytes(space.QuotaReservedBytes))
+			fmt.Fprintf(tw, "Free:\t%s\n", humanBytes(space.QuotaMaxBytes-space.QuotaUsedBytes-space.QuotaReservedBytes))
+			tw.Flush()
+		})
+	}
+}
+
+func setupPeers(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		info, err := node.Debug()
+		if err != nil {
+			return err
+		}
+
+		peers := info.PeersTable.Nodes
+		if peers == nil {
+			peers = []storage.Node{}
+		}
+
+		return a.output(peers, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "PEER ID\tADDRESS\tSEEN")
+			for _, p := range peers {
+				address := "-"
+				if p.Address != nil {
+					address = *p.Address
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%t\n", p.PeerId, address, p.Seen)
+			}
+			tw.Flush()
+		})
+	}
+}
+
+func setupConnect(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		if err := node.Connect(args[0], args[1:]); err != nil {
+			return err
+		}
+
+		return a.output(map[string]any{"peerId": args[0], "connected": true}, func(w io.Writer) {
+			fmt.Fprintf(w, "connected to %s\n", args[0])
+		})
+	}
+}
+
+func setupDebug(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		info, err := node.Debug()
+		if err != nil {
+			return err
+		}
+
+		return a.output(info, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+			fmt.Fprintf(tw, "Peer id:\t%s\n", info.ID)
+			fmt.Fprintf(tw, "Node id:\t%s\n", info.PeersTable.LocalNode.NodeId)
+			fmt.Fprintf(tw, "Addresses:\t%s\n", strings.Join(info.Addrs, ", "))
+			fmt.Fprintf(tw, "Announce addresses:\t%s\n", strings.Join(info.AnnounceAddresses, ", "))
+			fmt.Fprintf(tw, "Peers:\t%d\n", len(info.PeersTable.Nodes))
+			fmt.Fprintf(tw, "SPR:\t%s\n", info.Spr)
+			tw.Flush()
+		})
+	}
+}
+
+func setupVersion(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		version, revision := node.Version(), node.Revision()
+
+		return a.output(map[string]any{"version": version, "revision": revision}, func(w io.Writer) {
+			fmt.Fprintf(w, "%s (%s)\n", version, revision)
+		})
+	}
+}
+
+func setupLogLevel(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error {
+		level := storage.LogLevel(args[0])
+		if err := level.Validate(); err != nil {
+			return err
+		}
+
+		if err := node.UpdateLogLevel(string(level)); err != nil {
+			return err
+		}
+
+		return a.output(map[string]any{"logLevel": level}, func(w io.Writer) {
+			fmt.Fprintf(w, "log level set to %s\n", level)
+		})
+	}
+}
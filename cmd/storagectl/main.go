@@ -0,0 +1,336 @@
+// Command storagectl runs an embedded Logos Storage node to upload,
+// download and inspect the datasets of a data dir from the shell.
+//
+// Usage:
+//
+//	storagectl [flags] <command> [arguments]
+//
+// The node is configured from a JSON or TOML file, the STORAGE_*
+// environment variables and the flags, in this order of priority.
+// With -json, the results are written as JSON for scripting.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+
+	"github.com/logos-storage/logos-storage-go-bindings/storage"
+)
+
+const (
+	exitError = 1
+	exitUsage = 2
+)
+
+// runFunc runs a command with its positional arguments.
+type runFunc func(ctx context.Context, a *app, node *storage.StorageNode, args []string) error
+
+// command is a subcommand of storagectl.
+type command struct {
+	name    string
+	args    string
+	summary string
+
+	// minArgs and maxArgs bound the number of positional
+	// arguments, a negative maxArgs means no limit.
+	minArgs int
+	maxArgs int
+
+	// noStart creates the node without starting it, for the
+	// commands that do not use the network nor the repository.
+	noStart bool
+
+	// setup defines the flags of the command and returns the
+	// function running it, after the flags are parsed.
+	setup func(fs *flag.FlagSet) runFunc
+}
+
+var commands = []command{
+	{name: "upload", args: "[-name name] [file]", summary: "upload a file, or stdin without file", maxArgs: 1, setup: setupUpload},
+	{name: "download", args: "[-o file] [-local] <cid>", summary: "download a dataset to a file or stdout", minArgs: 1, maxArgs: 1, setup: setupDownload},
+	{name: "ls", summary: "list the local datasets", setup: setupList},
+	{name: "rm", args: "<cid>...", summary: "delete local datasets", minArgs: 1, maxArgs: -1, setup: setupRemove},
+	{name: "exists", args: "<cid>", summary: "check if a dataset is stored locally", minArgs: 1, maxArgs: 1, setup: setupExists},
+	{name: "fetch", args: "[-timeout duration] <cid>", summary: "fetch a dataset from the network into the local node", minArgs: 1, maxArgs: 1, setup: setupFetch},
+	{name: "manifest", args: "<cid>", summary: "show the manifest of a dataset", minArgs: 1, maxArgs: 1, setup: setupManifest},
+	{name: "space", summary: "show the storage space", setup: setupSpace},
+	{name: "peers", summary: "list the peers of the routing table", setup: setupPeers},
+	{name: "connect", args: "<peer id> [multiaddr...]", summary: "connect to a peer", minArgs: 1, maxArgs: -1, setup: setupConnect},
+	{name: "debug", summary: "show the debug info of the node", setup: setupDebug},
+	{name: "version", summary: "show the version of the library", noStart: true, setup: setupVersion},
+	{name: "loglevel", args: "<level>", summary: "update the log level of the node", minArgs: 1, maxArgs: 1, setup: setupLogLevel},
+}
+
+func findCommand(name string) (command, bool) {
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+	if i < 0 {
+		return command{}, false
+	}
+	return commands[i], true
+}
+
+// parse parses the flags and checks the number of positional arguments.
+func (c command) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	n := fs.NArg()
+	if n < c.minArgs || (c.maxArgs >= 0 && n > c.maxArgs) {
+		fs.Usage()
+		return fmt.Errorf("%s: invalid number of arguments", c.name)
+	}
+
+	return nil
+}
+
+// app holds the global options and the streams of the commands.
+type app struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	json bool
+
+	// progress is true when the progress bars are shown on stderr.
+	progress bool
+}
+
+// output writes v as JSON in JSON mode, or calls text otherwise.
+func (a *app) output(v any, text func(w io.Writer)) error {
+	if a.json {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	text(a.stdout)
+	return nil
+}
+
+// flags returns the flag set of a command, printing its usage on w.
+func (c command) flags(w io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.Usage = func() {
+		fmt.Fprintf(w, "Usage: storagectl %s %s\n\n%s.\n", c.name, c.args, capitalize(c.summary))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// globalFlags are the flags before the command.
+type globalFlags struct {
+	configFile string
+	envPrefix  string
+	json       bool
+	quiet      bool
+
+	overrides storage.Config
+	listen    string
+	bootstrap stringList
+	quota     string
+	logLevel  string
+	logFormat string
+	nat       string
+	repoKind  string
+}
+
+// stringList is a flag that can be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func parseGlobalFlags(args []string, stderr io.Writer) (*globalFlags, []string, error) {
+	g := &globalFlags{}
+
+	fs := flag.NewFlagSet("storagectl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { usage(stderr, fs) }
+
+	fs.StringVar(&g.configFile, "config", "", "configuration `file`, JSON or TOML")
+	fs.StringVar(&g.envPrefix, "env-prefix", "STORAGE", "`prefix` of the configuration environment variables, empty to ignore them")
+	fs.BoolVar(&g.json, "json", false, "write the results as JSON")
+	fs.BoolVar(&g.quiet, "quiet", false, "do not show the progress bars")
+
+	fs.StringVar(&g.overrides.DataDir, "data-dir", "", "data `dir` of the node")
+	fs.StringVar(&g.listen, "listen-addrs", "", "comma separated listen `multiaddrs`")
+	fs.IntVar(&g.overrides.DiscoveryPort, "disc-port", 0, "discovery UDP `port`")
+	fs.Var(&g.bootstrap, "bootstrap-node", "`spr` of a bootstrap node, can be repeated")
+	fs.StringVar(&g.nat, "nat", "", "NAT `method`: any, none, upnp, pmp or extip:<ip>")
+	fs.StringVar(&g.overrides.NetPrivKeyFile, "net-privkey", "", "network key `file`, relative to the data dir")
+	fs.IntVar(&g.overrides.MaxPeers, "max-peers", 0, "maximum number of peers")
+	fs.StringVar(&g.quota, "storage-quota", "", "storage quota `size`, like 20GiB")
+	fs.StringVar(&g.repoKind, "repo-kind", "", "repository `kind`: fs, sqlite or leveldb")
+	fs.IntVar(&g.overrides.BlockRetries, "block-retries", 0, "number of block download retries")
+	fs.StringVar(&g.logLevel, "log-level", "", "log `level` of the node (default warn)")
+	fs.StringVar(&g.logFormat, "log-format", "", "log `format`: auto, colors, nocolors or json")
+	fs.StringVar(&g.overrides.LogFile, "log-file", "", "log `file` of the node (default discard the logs)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if g.listen != "" {
+		addrs := strings.Split(g.listen, ",")
+		if err := (storage.Config{ListenAddrs: addrs}).Validate(); err != nil {
+			return nil, nil, err
+		}
+		g.overrides.ListenAddrs = addrs
+	}
+
+	if g.quota != "" {
+		quota, err := storage.ParseByteSize(g.quota)
+		if err != nil {
+			return nil, nil, fmt.Errorf("storage-quota: %w", err)
+		}
+		g.overrides.StorageQuota = quota
+	}
+
+	g.overrides.BootstrapNodes = g.bootstrap
+	g.overrides.Nat = storage.NatOption(g.nat)
+	g.overrides.RepoKind = storage.RepoKind(g.repoKind)
+	g.overrides.LogLevel = storage.LogLevel(g.logLevel)
+	g.overrides.LogFormat = storage.LogFormat(g.logFormat)
+
+	return g, fs.Args(), nil
+}
+
+// config merges the defaults, the file, the environment and the flags.
+// The logs are discarded by default since stdout carries the results.
+// The node validates the result.
+func (g *globalFlags) config() (storage.Config, error) {
+	loaded, err := storage.LoadLayeredConfig(storage.LoadOptions{
+		Defaults: storage.Config{
+			LogLevel: storage.WARN,
+			LogFile:  os.DevNull,
+		},
+		File:      g.configFile,
+		EnvPrefix: g.envPrefix,
+		Overrides: g.overrides,
+	})
+	return loaded.Config, err
+}
+
+func usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: storagectl [flags] <command> [arguments]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+
+	fmt.Fprintf(w, "\nRun 'storagectl <command> -h' for the arguments of a command.\n\nFlags:\n")
+	fs.PrintDefaults()
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// run executes storagectl and returns the exit code.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	g, args, err := parseGlobalFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "storagectl: %v\n", err)
+		return exitUsage
+	}
+
+	if len(args) == 0 {
+		fmt.Fprintf(stderr, "storagectl: missing command, run 'storagectl -h' for the usage\n")
+		return exitUsage
+	}
+
+	c, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(stderr, "storagectl: unknown command %q, run 'storagectl -h' for the usage\n", args[0])
+		return exitUsage
+	}
+
+	fs := c.flags(stderr)
+	runCommand := c.setup(fs)
+
+	err = c.parse(fs, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+
+	if err != nil {
+		return exitUsage
+	}
+
+	config, err := g.config()
+	if err != nil {
+		fmt.Fprintf(stderr, "storagectl: %v\n", err)
+		return exitError
+	}
+
+	a := &app{
+		stdin:    stdin,
+		stdout:   stdout,
+		stderr:   stderr,
+		json:     g.json,
+		progress: !g.json && !g.quiet && isTerminal(stderr),
+	}
+
+	node, err := storage.New(config)
+	if err != nil {
+		fmt.Fprintf(stderr, "storagectl: %v\n", err)
+		return exitError
+	}
+	defer node.Destroy()
+
+	if !c.noStart {
+		if err := node.Start(); err != nil {
+			fmt.Fprintf(stderr, "storagectl: start the node: %v\n", err)
+			return exitError
+		}
+		defer node.Stop()
+	}
+
+	if err := runCommand(ctx, a, node, fs.Args()); err != nil {
+		fmt.Fprintf(stderr, "storagectl %s: %v\n", c.name, err)
+		return exitError
+	}
+
+	return 0
+}
+
+// isTerminal returns true if w is a character device, like a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+
+	os.Exit(code)
+}
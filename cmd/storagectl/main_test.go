@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/logos-storage/logos-storage-go-bindings/storage"
+	"github.com/logos-storage/logos-storage-go-bindings/storage/storagetest"
+)
+
+func TestParseGlobalFlags(t *testing.T) {
+	g, args, err := parseGlobalFlags([]string{
+		"-json",
+		"-data-dir", "/tmp/data",
+		"-listen-addrs", "/ip4/127.0.0.1/tcp/8070,/ip4/127.0.0.1/udp/8070/quic-v1",
+		"-bootstrap-node", "spr:a",
+		"-bootstrap-node", "spr:b",
+		"-storage-quota", "2GiB",
+		"-log-level", "debug",
+		"upload", "-name", "a.txt",
+	}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !g.json {
+		t.Fatal("expected the JSON mode")
+	}
+
+	if strings.Join(args, " ") != "upload -name a.txt" {
+		t.Fatalf("unexpected command arguments %v", args)
+	}
+
+	c := g.overrides
+	if c.DataDir != "/tmp/data" || len(c.ListenAddrs) != 2 || c.StorageQuota != 2*storage.GiB || c.LogLevel != storage.DEBUG {
+		t.Fatalf("unexpected overrides %+v", c)
+	}
+
+	if strings.Join(c.BootstrapNodes, ",") != "spr:a,spr:b" {
+		t.Fatalf("unexpected bootstrap nodes %v", c.BootstrapNodes)
+	}
+
+	if _, _, err := parseGlobalFlags([]string{"-storage-quota", "lots", "ls"}, io.Discard); err == nil {
+		t.Fatal("expected an invalid quota to fail")
+	}
+}
+
+func TestConfigLayers(t *testing.T) {
+	t.Setenv("STORAGECTL_TEST_DATA_DIR", "/env/data")
+	t.Setenv("STORAGECTL_TEST_MAX_PEERS", "7")
+
+	g, _, err := parseGlobalFlags([]string{"-env-prefix", "STORAGECTL_TEST", "-data-dir", "/flag/data", "ls"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := g.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.DataDir != "/flag/data" || config.MaxPeers != 7 {
+		t.Fatalf("expected the flags over the environment, got %+v", config)
+	}
+
+	if config.LogLevel != storage.WARN || config.LogFile == "" {
+		t.Fatalf("expected the logs to be discarded by default, got %+v", config)
+	}
+}
+
+func TestCommandArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		ok   bool
+	}{
+		{"upload", nil, true},
+		{"upload", []string{"a.txt"}, true},
+		{"upload", []string{"a.txt", "b.txt"}, false},
+		{"download", []string{"-o", "out", "cid"}, true},
+		{"download", nil, false},
+		{"rm", []string{"cid1", "cid2", "cid3"}, true},
+		{"rm", nil, false},
+		{"connect", []string{"peer", "/ip4/1.2.3.4/tcp/1"}, true},
+		{"ls", []string{"extra"}, false},
+		{"fetch", []string{"-timeout", "1m", "cid"}, true},
+	}
+
+	for _, tt := range tests {
+		c, ok := findCommand(tt.name)
+		if !ok {
+			t.Fatalf("unknown command %s", tt.name)
+		}
+
+		fs := c.flags(io.Discard)
+		c.setup(fs)
+
+		if err := c.parse(fs, tt.args); (err == nil) != tt.ok {
+			t.Errorf("%s %v: unexpected error %v", tt.name, tt.args, err)
+		}
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{nil, exitUsage},
+		{[]string{"nope"}, exitUsage},
+		{[]string{"-h"}, 0},
+		{[]string{"download"}, exitUsage},
+		{[]string{"upload", "-h"}, 0},
+		{[]string{"-listen-addrs", "nope", "ls"}, exitUsage},
+	}
+
+	for _, tt := range tests {
+		var stderr bytes.Buffer
+
+		code := run(context.Background(), tt.args, strings.NewReader(""), io.Discard, &stderr)
+		if code != tt.code {
+			t.Errorf("%v: expected the exit code %d, got %d: %s", tt.args, tt.code, code, stderr.String())
+		}
+
+		if stderr.Len() == 0 {
+			t.Errorf("%v: expected a message on stderr", tt.args)
+		}
+	}
+}
+
+func TestRunEndToEnd(t *testing.T) {
+	dataDir := t.TempDir()
+	output := filepath.Join(t.TempDir(), "hello.txt")
+	content := "Hello World!"
+
+	global := []string{
+		"-json",
+		"-env-prefix", "",
+		"-data-dir", dataDir,
+		"-nat", "none",
+		"-listen-addrs", "/ip4/127.0.0.1/tcp/" + strconv.Itoa(storagetest.FreeTCPPort(t)),
+		"-disc-port", strconv.Itoa(storagetest.FreeUDPPort(t)),
+		"-log-format", "nocolors",
+	}
+
+	// Each command starts and stops its own node on the data dir
+	runCommand := func(stdin string, args ...string) []byte {
+		t.Helper()
+
+		var stdout, stderr bytes.Buffer
+		if code := run(context.Background(), append(global, args...), strings.NewReader(stdin), &stdout, &stderr); code != 0 {
+			t.Fatalf("%v: exit code %d: %s", args, code, stderr.String())
+		}
+		return stdout.Bytes()
+	}
+
+	var uploaded struct {
+		Cid string `json:"cid"`
+	}
+	if err := json.Unmarshal(runCommand(content, "upload", "-name", "hello.txt"), &uploaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if uploaded.Cid == "" {
+		t.Fatal("expected the cid of the upload")
+	}
+
+	var manifests []storage.Manifest
+	if err := json.Unmarshal(runCommand("", "ls"), &manifests); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifests) != 1 || manifests[0].Cid != uploaded.Cid || manifests[0].Filename != "hello.txt" {
+		t.Fatalf("expected the uploaded dataset to be listed, got %+v", manifests)
+	}
+
+	var downloaded struct {
+		Cid   string `json:"cid"`
+		Path  string `json:"path"`
+		Bytes int64  `json:"bytes"`
+	}
+	if err := json.Unmarshal(runCommand("", "download", "-o", output, uploaded.Cid), &downloaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if downloaded.Cid != uploaded.Cid || downloaded.Path != output || downloaded.Bytes != int64(len(content)) {
+		t.Fatalf("unexpected download result %+v", downloaded)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil || string(data) != content {
+		t.Fatalf("unexpected downloaded file %q: %v", data, err)
+	}
+
+	// Without output file, the content is the output
+	if out := runCommand("", "download", uploaded.Cid); string(out) != content {
+		t.Fatalf("expected the content on stdout, got %q", out)
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	tests := []struct {
+		done, total int64
+		want        string
+	}{
+		{0, 300, "upload [>                             ]   0% 0 B / 300 B"},
+		{100, 300, "upload [==========>                   ]  33% 100 B / 300 B"},
+		{300, 300, "upload [==============================] 100% 300 B / 300 B"},
+		{400, 300, "upload [==============================] 100% 300 B / 300 B"},
+		{1536, 0, "upload 1.5 KiB"},
+	}
+
+	for _, tt := range tests {
+		if got := progressLine("upload", tt.done, tt.total); got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{3 * 1024 * 1024 / 2, "1.5 MiB"},
+		{20 * 1024 * 1024 * 1024, "20.0 GiB"},
+		{5 * 1024 * 1024 * 1024 * 1024 * 1024, "5120.0 TiB"},
+	}
+
+	for _, tt := range tests {
+		if got := humanBytes(tt.n); got != tt.want {
+			t.Errorf("humanBytes(%d): expected %q, got %q", tt.n, tt.want, got)
+		}
+	}
+}
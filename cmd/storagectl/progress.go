@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressWidth    = 30
+	progressInterval = 100 * time.Millisecond
+)
+
+// progressBar draws the progress of a transfer on one line of stderr.
+// It does nothing when the progress bars are disabled.
+type progressBar struct {
+	w     io.Writer
+	label string
+
+	// total is the expected number of bytes, 0 if unknown.
+	total int64
+
+	mu   sync.Mutex
+	done int64
+	last time.Time
+}
+
+func (a *app) newProgress(label string, total int64) *progressBar {
+	if !a.progress {
+		return nil
+	}
+	return &progressBar{w: a.stderr, label: label, total: total}
+}
+
+// set updates the number of bytes transferred, the line
+// is redrawn at most every progressInterval.
+func (p *progressBar) set(done int64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done = done
+	if time.Since(p.last) < progressInterval {
+		return
+	}
+
+	p.last = time.Now()
+	fmt.Fprintf(p.w, "\r%s", progressLine(p.label, p.done, p.total))
+}
+
+// finish draws the last state and ends the line.
+func (p *progressBar) finish() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintf(p.w, "\r%s\n", progressLine(p.label, p.done, p.total))
+}
+
+// progressLine renders a progress line like
+// "upload [=========>          ]  33% 1.0 MiB / 3.0 MiB".
+// Without total, only the bytes transferred are shown.
+func progressLine(label string, done, total int64) string {
+	if total <= 0 {
+		return fmt.Sprintf("%s %s", label, humanBytes(done))
+	}
+
+	done = min(done, total)
+	filled := int(done * progressWidth / total)
+
+	bar := strings.Repeat("=", filled)
+	if filled < progressWidth {
+		bar += ">" + strings.Repeat(" ", progressWidth-filled-1)
+	}
+
+	return fmt.Sprintf("%s [%s] %3d%% %s / %s", label, bar, done*100/total, humanBytes(done), humanBytes(total))
+}
+
+// humanBytes formats a number of bytes with a binary unit, like "1.5 MiB".
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 3; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGT"[exp])
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// accessLogFilename is the name of the access log file in the data dir.
+const accessLogFilename = "accesses.json"
+
+// AccessRecord describes how a dataset has been used by the node
+// since the access log was created.
+type AccessRecord struct {
+	// FirstSeen is the first time the dataset was uploaded, fetched,
+	// downloaded or observed.
+	FirstSeen time.Time `json:"firstSeen"`
+
+	// LastAccess is the last time the dataset was uploaded, fetched
+	// or downloaded.
+	LastAccess time.Time `json:"lastAccess"`
+
+	// Count is the number of accesses.
+	Count int `json:"count"`
+}
+
+// AccessLog records the accesses to the datasets of a node.
+// The node records the uploads, fetches and downloads automatically.
+//
+// The log is kept in the data dir, so it survives the restarts: it is
+// loaded by New, and saved when the node is stopped, after each cycle
+// of a RetentionManager, and by Save.
+type AccessLog struct {
+	mu      sync.Mutex
+	records map[string]AccessRecord
+
+	// path is the file of the log, empty if it is not saved.
+	path string
+
+	// dirty is true if the log changed since it was saved.
+	dirty bool
+}
+
+func newAccessLog() *AccessLog {
+	return &AccessLog{records: make(map[string]AccessRecord)}
+}
+
+// Touch records an access to the cid.
+func (l *AccessLog) Touch(cid string) {
+	l.touchAt(cid, time.Now())
+}
+
+func (l *AccessLog) touchAt(cid string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record, ok := l.records[cid]
+	if !ok {
+		record.FirstSeen = now
+	}
+
+	record.LastAccess = now
+	record.Count++
+	l.records[cid] = record
+	l.dirty = true
+}
+
+// observe adds the cid to the log without counting an access,
+// if it is not already known.
+func (l *AccessLog) observe(cid string, now time.Time) AccessRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record, ok := l.records[cid]
+	if !ok {
+		record = AccessRecord{FirstSeen: now, LastAccess: now}
+		l.records[cid] = record
+		l.dirty = true
+	}
+
+	return record
+}
+
+// Get returns the access record of the cid.
+func (l *AccessLog) Get(cid string) (AccessRecord, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record, ok := l.records[cid]
+	return record, ok
+}
+
+// Forget removes the cid from the log.
+func (l *AccessLog) Forget(cid string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.records[cid]; ok {
+		delete(l.records, cid)
+		l.dirty = true
+	}
+}
+
+// load reads the log saved at path, which is then used by Save.
+// The records already in memory are more recent and are kept.
+func (l *AccessLog) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	var records map[string]AccessRecord
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &records); err != nil {
+			return fmt.Errorf("failed to read access log %s: %w", path, err)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.path = path
+	for cid, record := range records {
+		if _, ok := l.records[cid]; !ok {
+			l.records[cid] = record
+		}
+	}
+
+	return nil
+}
+
+// Save writes the log into the data dir if it changed. Like for the
+// catalog, a temporary file is renamed so the file is never partially
+// written.
+func (l *AccessLog) Save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path == "" || !l.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(l.records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+
+	l.dirty = false
+	return nil
+}
+
+// AccessLog returns the access log of the node.
+func (node StorageNode) AccessLog() *AccessLog {
+	return node.accesses
+}
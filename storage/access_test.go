@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAccessLogSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), accessLogFilename)
+	now := time.Now()
+
+	log := newAccessLog()
+	if err := log.load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing changed, nothing is written
+	if err := log.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no access log file, got %v", err)
+	}
+
+	log.touchAt("a", now.Add(-time.Hour))
+	log.touchAt("a", now)
+	log.observe("b", now)
+	if err := log.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The records in memory are kept over the saved ones
+	loaded := newAccessLog()
+	loaded.observe("b", now.Add(time.Minute))
+	if err := loaded.load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	a, ok := loaded.Get("a")
+	if !ok || !a.FirstSeen.Equal(now.Add(-time.Hour)) || !a.LastAccess.Equal(now) || a.Count != 2 {
+		t.Fatalf("unexpected record for a: %+v", a)
+	}
+
+	b, ok := loaded.Get("b")
+	if !ok || !b.FirstSeen.Equal(now.Add(time.Minute)) {
+		t.Fatalf("unexpected record for b: %+v", b)
+	}
+}
+
+func TestAccessLogCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), accessLogFilename)
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newAccessLog().load(path); err == nil {
+		t.Fatal("expected an error for a corrupt access log")
+	}
+}
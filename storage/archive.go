@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrCidMismatch is returned when a re-uploaded dataset
+// does not have its original cid.
+var ErrCidMismatch = errors.New("cid mismatch")
+
+const (
+	// exportFormat is the version of the archive layout.
+	exportFormat = 1
+
+	// exportIndexName is the first file of the archive.
+	exportIndexName = "storage-export.json"
+
+	exportDatasetsDir = "datasets"
+)
+
+// exportIndex describes the content of an archive.
+type exportIndex struct {
+	Format    int       `json:"format"`
+	CreatedAt time.Time `json:"createdAt"`
+	Version   string    `json:"version"`
+	Revision  string    `json:"revision"`
+	Cids      []string  `json:"cids"`
+}
+
+// ImportResult is the result of the import of a dataset.
+type ImportResult struct {
+	// Manifest is the exported manifest.
+	Manifest Manifest
+
+	// ImportedCid is the cid computed by the upload.
+	ImportedCid string
+
+	// Err is the error of the import, if any.
+	Err error
+}
+
+// Match returns true if the dataset was imported with its original cid.
+func (r ImportResult) Match() bool {
+	return r.Err == nil && r.ImportedCid == r.Manifest.Cid
+}
+
+// ImportReport is the result of ImportDatasets.
+type ImportReport struct {
+	Results []ImportResult
+
+	// Missing is the list of cids of the archive index
+	// without dataset in the archive.
+	Missing []string
+}
+
+// Mismatches returns the results of the datasets that
+// were not imported with their original cid.
+func (r ImportReport) Mismatches() []ImportResult {
+	var results []ImportResult
+	for _, res := range r.Results {
+		if !res.Match() {
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+// ExportDatasets writes the datasets into a tar archive that can be moved
+// to another node, without network, and imported with ImportDatasets.
+//
+// The archive starts with a storage-export.json index, then contains for
+// each cid a datasets/<cid>/manifest.json file with its manifest and a
+// datasets/<cid>/data file with its content, read from the local node.
+func (node StorageNode) ExportDatasets(ctx context.Context, cids []string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	now := time.Now()
+	index := exportIndex{
+		Format:    exportFormat,
+		CreatedAt: now,
+		Version:   node.Version(),
+		Revision:  node.Revision(),
+		Cids:      cids,
+	}
+
+	if err := writeTarJSON(tw, exportIndexName, index, now); err != nil {
+		return err
+	}
+
+	for _, cid := range cids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		manifest, err := node.DownloadManifest(cid)
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", cid, err)
+		}
+
+		dir := path.Join(exportDatasetsDir, cid)
+
+		if err := writeTarJSON(tw, path.Join(dir, "manifest.json"), manifest, now); err != nil {
+			return err
+		}
+
+		err = tw.WriteHeader(&tar.Header{
+			Name:    path.Join(dir, "data"),
+			Mode:    0644,
+			Size:    int64(manifest.DatasetSize),
+			ModTime: now,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := node.DownloadStream(ctx, cid, DownloadStreamOptions{Writer: tw, Local: true}); err != nil {
+			return fmt.Errorf("failed to export %s: %w", cid, err)
+		}
+
+		// Flush checks that the full dataset size was written
+		if err := tw.Flush(); err != nil {
+			return fmt.Errorf("failed to export %s: %w", cid, err)
+		}
+	}
+
+	return tw.Close()
+}
+
+// ImportDatasets uploads the datasets of an archive written by ExportDatasets.
+// Each dataset is uploaded with its original filename and block size, so
+// the computed cid is expected to be the exported one. The datasets that
+// could not be imported or got another cid are reported in the results,
+// and their errors, wrapping ErrCidMismatch for the mismatches, are joined
+// in the returned error.
+//
+// The datasets must match the index of the archive: a dataset that is not
+// in the index stops the import before it is uploaded, and the cids of the
+// index without dataset are reported in Missing and in the returned error.
+func (node StorageNode) ImportDatasets(ctx context.Context, r io.Reader) (ImportReport, error) {
+	var report ImportReport
+
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return report, fmt.Errorf("failed to read the archive index: %w", err)
+	}
+
+	if hdr.Name != exportIndexName {
+		return report, fmt.Errorf("invalid archive: expected %s first, got %s", exportIndexName, hdr.Name)
+	}
+
+	var index exportIndex
+	if err := json.NewDecoder(tr).Decode(&index); err != nil {
+		return report, fmt.Errorf("failed to read the archive index: %w", err)
+	}
+
+	if index.Format != exportFormat {
+		return report, fmt.Errorf("unsupported archive format %d", index.Format)
+	}
+
+	expected := make(map[string]bool, len(index.Cids))
+	for _, cid := range index.Cids {
+		expected[cid] = false
+	}
+
+	var errs []error
+	var manifest *Manifest
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return report, err
+		}
+
+		dir, name := path.Split(hdr.Name)
+		cid := path.Base(dir)
+
+		switch name {
+		case "manifest.json":
+			if imported, ok := expected[cid]; !ok || imported {
+				return report, fmt.Errorf("invalid archive: unexpected dataset %s", cid)
+			}
+			expected[cid] = true
+
+			var m Manifest
+			if err := json.NewDecoder(tr).Decode(&m); err != nil {
+				return report, fmt.Errorf("failed to read the manifest of %s: %w", cid, err)
+			}
+			m.Cid = cid
+			manifest = &m
+		case "data":
+			if manifest == nil || manifest.Cid != cid {
+				return report, fmt.Errorf("invalid archive: data of %s without manifest", cid)
+			}
+
+			res := ImportResult{Manifest: *manifest}
+			res.ImportedCid, res.Err = node.reupload(ctx, *manifest, tr, nil)
+			if res.Err == nil && res.ImportedCid != cid {
+				res.Err = fmt.Errorf("%w: %s was imported as %s", ErrCidMismatch, cid, res.ImportedCid)
+			}
+
+			if res.Err != nil {
+				errs = append(errs, res.Err)
+			}
+
+			report.Results = append(report.Results, res)
+			manifest = nil
+		default:
+			return report, fmt.Errorf("invalid archive: unexpected file %s", hdr.Name)
+		}
+	}
+
+	for _, cid := range index.Cids {
+		if !expected[cid] && !slices.Contains(report.Missing, cid) {
+			report.Missing = append(report.Missing, cid)
+		}
+	}
+
+	if len(report.Missing) > 0 {
+		errs = append(errs, fmt.Errorf("invalid archive: missing datasets %s", strings.Join(report.Missing, ", ")))
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// reupload uploads the content of a dataset with the filename and the block
+// size of its manifest, which is required to compute the same cid.
+func (node StorageNode) reupload(ctx context.Context, manifest Manifest, r io.Reader, onProgress OnUploadProgressFunc) (string, error) {
+	return node.UploadReader(ctx, UploadOptions{
+		Filepath:   manifest.Filename,
+		ChunkSize:  ChunkSize(manifest.BlockSize),
+		OnProgress: onProgress,
+	}, r)
+}
+
+func writeTarJSON(tw *tar.Writer, name string, v any, modTime time.Time) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(data)
+	return err
+}
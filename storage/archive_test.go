@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImportDatasets(t *testing.T) {
+	storage := newStorageNode(t)
+
+	cid, _ := uploadHelper(t, storage)
+	bigCid, _ := uploadBigFileHelper(t, storage)
+
+	var archive bytes.Buffer
+	if err := storage.ExportDatasets(context.Background(), []string{cid, bigCid}, &archive); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(archive.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+
+	expected := []string{
+		exportIndexName,
+		"datasets/" + cid + "/manifest.json",
+		"datasets/" + cid + "/data",
+		"datasets/" + bigCid + "/manifest.json",
+		"datasets/" + bigCid + "/data",
+	}
+	if !slices.Equal(names, expected) {
+		t.Fatalf("expected archive files %v, got %v", expected, names)
+	}
+
+	// Import into another node
+	other := newStorageNode(t)
+
+	report, err := other.ImportDatasets(context.Background(), bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Results) != 2 || len(report.Mismatches()) != 0 {
+		t.Fatalf("expected 2 datasets imported without mismatch, got %+v", report.Results)
+	}
+
+	for _, c := range []string{cid, bigCid} {
+		exists, err := other.Exists(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Fatalf("expected %s to be imported", c)
+		}
+	}
+}
+
+func TestImportDatasetsInvalidArchive(t *testing.T) {
+	storage := newStorageNode(t)
+
+	_, err := storage.ImportDatasets(context.Background(), strings.NewReader("not an archive"))
+	if err == nil {
+		t.Fatal("expected an error when importing an invalid archive")
+	}
+}
+
+func TestImportDatasetsIndexMismatch(t *testing.T) {
+	archive := func(cids []string, manifests ...string) io.Reader {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+
+		index := exportIndex{Format: exportFormat, Cids: cids}
+		if err := writeTarJSON(tw, exportIndexName, index, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, cid := range manifests {
+			if err := writeTarJSON(tw, "datasets/"+cid+"/manifest.json", Manifest{}, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return &buf
+	}
+
+	report, err := StorageNode{}.ImportDatasets(context.Background(), archive([]string{"a", "b"}))
+	if err == nil || !slices.Equal(report.Missing, []string{"a", "b"}) {
+		t.Fatalf("expected the missing datasets to be reported, got %v: %v", report.Missing, err)
+	}
+
+	_, err = StorageNode{}.ImportDatasets(context.Background(), archive([]string{"a"}, "x"))
+	if err == nil || !strings.Contains(err.Error(), "unexpected dataset x") {
+		t.Fatalf("expected an unexpected dataset error, got %v", err)
+	}
+
+	_, err = StorageNode{}.ImportDatasets(context.Background(), archive([]string{"a"}, "a", "a"))
+	if err == nil || !strings.Contains(err.Error(), "unexpected dataset a") {
+		t.Fatalf("expected a duplicated dataset error, got %v", err)
+	}
+}
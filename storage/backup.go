@@ -0,0 +1,412 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// backupFormat is the version of the backup layout.
+	backupFormat = 1
+
+	// backupMetadataName is the first file of the backup.
+	backupMetadataName = "backup.json"
+
+	// backupDataDir contains the data dir files in the backup.
+	backupDataDir = "data"
+
+	// backupKeyDir contains the network key in the backup when
+	// it is stored outside of the data dir.
+	backupKeyDir = "key"
+
+	defaultNetPrivKeyFile = "key"
+)
+
+// BackupMetadata describes a backup written by Backup.
+type BackupMetadata struct {
+	Format    int       `json:"format"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Version and Revision are the ones of the node that wrote the backup.
+	Version  string `json:"version"`
+	Revision string `json:"revision"`
+
+	RepoKind RepoKind `json:"repoKind,omitempty"`
+	PeerId   string   `json:"peerId,omitempty"`
+
+	// ExternalKey is the file name of the network key when it was
+	// stored outside of the data dir. It is restored in the data dir.
+	ExternalKey string `json:"externalKey,omitempty"`
+}
+
+// Backup writes a gzipped tar archive of the data dir, including the
+// network key, that can be restored with Restore.
+//
+// The repo backends cannot be copied while they are used, so the node
+// is stopped during the backup, and started again after if it was
+// running. The helpers bound to the node, like the PeerManager, are
+// not closed by this stop.
+func (node StorageNode) Backup(ctx context.Context, dest io.Writer) (err error) {
+	repo, err := node.Repo()
+	if err != nil {
+		return err
+	}
+
+	meta := BackupMetadata{
+		Format:    backupFormat,
+		CreatedAt: time.Now(),
+		Version:   node.Version(),
+		Revision:  node.Revision(),
+		RepoKind:  node.config.RepoKind,
+	}
+
+	keyFile := node.config.NetPrivKeyFile
+	if keyFile == "" {
+		keyFile = defaultNetPrivKeyFile
+	}
+
+	if filepath.IsAbs(keyFile) {
+		if rel, err := filepath.Rel(repo, keyFile); err != nil || strings.HasPrefix(rel, "..") {
+			meta.ExternalKey = filepath.Base(keyFile)
+		}
+	}
+
+	if node.State() == NodeStarted {
+		if meta.PeerId, err = node.PeerId(); err != nil {
+			return err
+		}
+
+		if err := node.stop(); err != nil {
+			return fmt.Errorf("failed to stop the node for the backup: %w", err)
+		}
+
+		defer func() {
+			if startErr := node.Start(); startErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to restart the node after the backup: %w", startErr))
+			}
+		}()
+	}
+
+	gw := gzip.NewWriter(dest)
+	tw := tar.NewWriter(gw)
+
+	if err := writeTarJSON(tw, backupMetadataName, meta, meta.CreatedAt); err != nil {
+		return err
+	}
+
+	if err := addTarDir(ctx, tw, repo, backupDataDir); err != nil {
+		return fmt.Errorf("failed to archive the data dir: %w", err)
+	}
+
+	if meta.ExternalKey != "" {
+		if err := addTarFile(tw, keyFile, path.Join(backupKeyDir, meta.ExternalKey)); err != nil {
+			return fmt.Errorf("failed to archive the network key: %w", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+// Restore rebuilds a data dir from a backup written by Backup, before
+// creating the node with New. The data dir must not exist or be empty.
+// The backup is extracted into a temporary directory next to the data
+// dir, which is renamed into place once complete, so a failed restore
+// leaves the data dir untouched.
+//
+// It refuses to restore a backup written by an incompatible version,
+// see CheckBackupCompatibility.
+func Restore(src io.Reader, dataDir string) error {
+	version, revision, err := libraryVersion()
+	if err != nil {
+		return err
+	}
+
+	return restore(src, dataDir, version, revision)
+}
+
+func restore(src io.Reader, dataDir string, version, revision string) error {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if len(entries) > 0 {
+		return fmt.Errorf("the data dir %s is not empty", dataDir)
+	}
+
+	gr, err := gzip.NewReader(src)
+	if err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+
+	if hdr.Name != backupMetadataName {
+		return fmt.Errorf("invalid backup: expected %s first, got %s", backupMetadataName, hdr.Name)
+	}
+
+	var meta BackupMetadata
+	if err := json.NewDecoder(tr).Decode(&meta); err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+
+	if meta.Format != backupFormat {
+		return fmt.Errorf("unsupported backup format %d", meta.Format)
+	}
+
+	if err := CheckBackupCompatibility(meta, version, revision); err != nil {
+		return err
+	}
+
+	dataDir = filepath.Clean(dataDir)
+	if err := os.MkdirAll(filepath.Dir(dataDir), 0700); err != nil {
+		return err
+	}
+
+	// MkdirTemp creates the directory accessible by the owner only,
+	// as required by the library for the data dir.
+	tmp, err := os.MkdirTemp(filepath.Dir(dataDir), "."+filepath.Base(dataDir)+".restore-*")
+	if err != nil {
+		return err
+	}
+
+	if err := extractBackup(tr, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	// Remove only succeeds on an empty data dir
+	if err := os.Remove(dataDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, dataDir); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// extractBackup writes the files of a backup, after its metadata,
+// into the directory dir.
+func extractBackup(tr *tar.Reader, dir string) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(hdr.Name)
+
+		var rel string
+		switch {
+		case name == backupDataDir:
+			continue
+		case strings.HasPrefix(name, backupDataDir+"/"):
+			rel = strings.TrimPrefix(name, backupDataDir+"/")
+		case strings.HasPrefix(name, backupKeyDir+"/"):
+			rel = path.Base(name)
+		default:
+			return fmt.Errorf("invalid backup: unexpected file %s", hdr.Name)
+		}
+
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("invalid backup: unsafe path %s", hdr.Name)
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := restoreFile(tr, target, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid backup: unsupported file type for %s", hdr.Name)
+		}
+	}
+}
+
+// CheckBackupCompatibility returns an error if a backup cannot be restored
+// for a library version and revision.
+// A backup can be restored by the same major and minor version, with a
+// patch version equal or greater. If the versions cannot be parsed, the
+// versions and the revisions must be equal.
+func CheckBackupCompatibility(meta BackupMetadata, version, revision string) error {
+	backup, ok1 := parseVersion(meta.Version)
+	current, ok2 := parseVersion(version)
+
+	if !ok1 || !ok2 {
+		if meta.Version != version || meta.Revision != revision {
+			return fmt.Errorf("backup version %s (%s) is not compatible with %s (%s)", meta.Version, meta.Revision, version, revision)
+		}
+
+		return nil
+	}
+
+	if backup[0] != current[0] || backup[1] != current[1] || backup[2] > current[2] {
+		return fmt.Errorf("backup version %s is not compatible with %s", meta.Version, version)
+	}
+
+	return nil
+}
+
+// parseVersion parses a "v1.2.3" version, the suffixes are ignored.
+func parseVersion(v string) ([3]int, bool) {
+	var res [3]int
+
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+ "); i >= 0 {
+		v = v[:i]
+	}
+
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return res, false
+	}
+
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return res, false
+		}
+		res[i] = n
+	}
+
+	return res, true
+}
+
+// libraryVersion returns the version and the revision of the library,
+// using a node created in a temporary data dir.
+func libraryVersion() (string, string, error) {
+	dir, err := os.MkdirTemp("", "storage-version-*")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(dir)
+
+	node, err := New(Config{DataDir: dir, Nat: "none", LogFormat: LogFormatNoColors})
+	if err != nil {
+		return "", "", err
+	}
+	defer node.Destroy()
+
+	return node.Version(), node.Revision(), nil
+}
+
+func restoreFile(r io.Reader, target string, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func addTarFile(tw *tar.Writer, src, name string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// addTarDir adds the content of the directory root under the prefix.
+func addTarDir(ctx context.Context, tw *tar.Writer, root, prefix string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		name := path.Join(prefix, filepath.ToSlash(rel))
+
+		switch {
+		case d.IsDir():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = name + "/"
+
+			return tw.WriteHeader(hdr)
+		case d.Type().IsRegular():
+			return addTarFile(tw, p, name)
+		default:
+			// Sockets and links are not part of the repo state
+			return nil
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckBackupCompatibility(t *testing.T) {
+	tests := []struct {
+		backup, backupRevision string
+		version, revision      string
+		compatible             bool
+	}{
+		{"v0.3.2", "abc", "v0.3.2", "abc", true},
+		{"v0.3.2", "abc", "v0.3.2", "def", true},
+		{"v0.3.1", "abc", "v0.3.2", "def", true},
+		{"v0.3.3", "abc", "v0.3.2", "def", false},
+		{"v0.2.9", "abc", "v0.3.2", "def", false},
+		{"v1.3.2", "abc", "v0.3.2", "def", false},
+		{"dev", "abc", "dev", "abc", true},
+		{"dev", "abc", "dev", "def", false},
+	}
+
+	for _, tt := range tests {
+		meta := BackupMetadata{Version: tt.backup, Revision: tt.backupRevision}
+		err := CheckBackupCompatibility(meta, tt.version, tt.revision)
+
+		if tt.compatible && err != nil {
+			t.Errorf("expected %s (%s) to be compatible with %s (%s): %v", tt.backup, tt.backupRevision, tt.version, tt.revision, err)
+		}
+
+		if !tt.compatible && err == nil {
+			t.Errorf("expected %s (%s) to be incompatible with %s (%s)", tt.backup, tt.backupRevision, tt.version, tt.revision)
+		}
+	}
+}
+
+func TestRestoreNonEmptyDataDir(t *testing.T) {
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, "file"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restore(bytes.NewReader(nil), dataDir, "v0.3.2", ""); err == nil {
+		t.Fatal("expected an error when restoring into a non-empty data dir")
+	}
+}
+
+func TestRestoreAtomic(t *testing.T) {
+	backup := func(files map[string]string) *bytes.Buffer {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+
+		meta := BackupMetadata{Format: backupFormat, Version: "v0.3.2"}
+		if err := writeTarJSON(tw, backupMetadataName, meta, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, content := range files {
+			if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tw.Close()
+		gw.Close()
+		return &buf
+	}
+
+	parent := t.TempDir()
+	dataDir := filepath.Join(parent, "data")
+
+	if err := restore(backup(map[string]string{"data/../../escape": "x"}), dataDir, "v0.3.2", ""); err == nil {
+		t.Fatal("expected an error for an unsafe path")
+	}
+
+	entries, _ := os.ReadDir(parent)
+	if len(entries) != 0 {
+		t.Fatalf("expected nothing left after a failed restore, got %v", entries)
+	}
+
+	// An existing empty data dir is replaced
+	if err := os.Mkdir(dataDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restore(backup(map[string]string{"data/repo/file": "content"}), dataDir, "v0.3.2", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, "repo", "file"))
+	if err != nil || string(data) != "content" {
+		t.Fatalf("unexpected restored file %q: %v", data, err)
+	}
+
+	info, err := os.Stat(dataDir)
+	if err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("expected the data dir to be accessible by the owner only, got %v: %v", info.Mode(), err)
+	}
+
+	entries, _ = os.ReadDir(parent)
+	if len(entries) != 1 {
+		t.Fatalf("expected only the data dir, got %v", entries)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	storage := newStorageNode(t)
+	cid, _ := uploadHelper(t, storage)
+
+	peerId, err := storage.PeerId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := NewPeerManager(storage, PeerManagerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	var backup bytes.Buffer
+	if err := storage.Backup(context.Background(), &backup); err != nil {
+		t.Fatal(err)
+	}
+
+	if storage.State() != NodeStarted {
+		t.Fatalf("expected the node to be restarted after the backup, got %s", storage.State())
+	}
+
+	// The backup does not close the helpers bound to the node
+	if err := manager.Add(PeerTarget{PeerId: peerId}); errors.Is(err, ErrPeerManagerClosed) {
+		t.Fatal("expected the peer manager to be open after the backup")
+	}
+
+	dataDir := filepath.Join(t.TempDir(), "restored")
+	if err := Restore(&backup, dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newStorageNode(t, Config{DataDir: dataDir})
+
+	restoredPeerId, err := restored.PeerId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restoredPeerId != peerId {
+		t.Errorf("expected the restored peer id %s, got %s", peerId, restoredPeerId)
+	}
+
+	exists, err := restored.Exists(cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("expected the cid to exist in the restored node")
+	}
+}
@@ -0,0 +1,412 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// catalogFilename is the name of the catalog file in the data dir.
+const catalogFilename = "catalog.json"
+
+// CatalogEntry is the information attached to a cid in the Catalog.
+type CatalogEntry struct {
+	// Cid is the content identifier of the dataset.
+	Cid string `json:"cid"`
+
+	// Labels are free form tags used to search the datasets.
+	Labels []string `json:"labels,omitempty"`
+
+	// Description is a human readable description of the dataset.
+	Description string `json:"description,omitempty"`
+
+	// Uploader identifies who uploaded the dataset.
+	Uploader string `json:"uploader,omitempty"`
+
+	// Attributes are custom key/values.
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// Filename is the name of the file, taken from the manifest.
+	Filename string `json:"filename,omitempty"`
+
+	// Mimetype is the MIME type of the file, taken from the manifest.
+	Mimetype string `json:"mimetype,omitempty"`
+
+	// DatasetSize is the size of the dataset, taken from the manifest.
+	DatasetSize int `json:"datasetSize"`
+
+	// UploadedAt is the time of the upload.
+	UploadedAt time.Time `json:"uploadedAt"`
+
+	// Missing is true if the dataset was not stored by the node
+	// during the last reconciliation.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// HasLabel returns true if the entry has the label.
+func (e CatalogEntry) HasLabel(label string) bool {
+	return slices.Contains(e.Labels, label)
+}
+
+// CatalogQuery filters the entries returned by Catalog.Query.
+// The zero value matches all the entries that are not missing.
+type CatalogQuery struct {
+	// Labels are the labels that the entries must all have.
+	Labels []string
+
+	// Mimetype is the MIME type of the entries.
+	Mimetype string
+
+	// MinSize is the minimum dataset size.
+	MinSize int
+
+	// MaxSize is the maximum dataset size, 0 means no maximum.
+	MaxSize int
+
+	// UploadedAfter keeps the entries uploaded after this time.
+	UploadedAfter time.Time
+
+	// UploadedBefore keeps the entries uploaded before this time.
+	UploadedBefore time.Time
+
+	// Attributes are the key/values that the entries must all have.
+	Attributes map[string]string
+
+	// IncludeMissing includes the entries flagged as missing.
+	IncludeMissing bool
+}
+
+func (q CatalogQuery) match(e CatalogEntry) bool {
+	if e.Missing && !q.IncludeMissing {
+		return false
+	}
+
+	for _, label := range q.Labels {
+		if !e.HasLabel(label) {
+			return false
+		}
+	}
+
+	if q.Mimetype != "" && q.Mimetype != e.Mimetype {
+		return false
+	}
+
+	if e.DatasetSize < q.MinSize || (q.MaxSize > 0 && e.DatasetSize > q.MaxSize) {
+		return false
+	}
+
+	if !q.UploadedAfter.IsZero() && !e.UploadedAt.After(q.UploadedAfter) {
+		return false
+	}
+
+	if !q.UploadedBefore.IsZero() && !e.UploadedAt.Before(q.UploadedBefore) {
+		return false
+	}
+
+	for k, v := range q.Attributes {
+		if value, ok := e.Attributes[k]; !ok || value != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CatalogReconciliation is the result of a reconciliation between the
+// catalog and the manifests stored by the node.
+type CatalogReconciliation struct {
+	// Missing lists the cids of the entries whose dataset is not stored anymore.
+	Missing []string
+
+	// Restored lists the cids of the entries previously missing whose
+	// dataset is stored again.
+	Restored []string
+
+	// Untracked lists the manifests stored by the node that are not in the catalog.
+	Untracked []Manifest
+}
+
+// Catalog is a local catalog of datasets, persisted in a JSON file.
+// It attaches labels, a description, an uploader and custom key/values
+// to the cids. Attach it to a node with SetCatalog so that UploadReader
+// and UploadFile fill it in automatically.
+type Catalog struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]CatalogEntry
+	onError func(cid string, err error)
+}
+
+// OpenCatalog opens the catalog stored at path. The file is created
+// on the first change if it does not exist.
+func OpenCatalog(path string) (*Catalog, error) {
+	c := &Catalog{path: path, entries: make(map[string]CatalogEntry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []CatalogEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to read catalog %s: %w", path, err)
+	}
+
+	for _, e := range entries {
+		c.entries[e.Cid] = e
+	}
+
+	return c, nil
+}
+
+// OpenCatalog opens the catalog stored in the data dir of the node.
+func (node StorageNode) OpenCatalog() (*Catalog, error) {
+	repo, err := node.Repo()
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenCatalog(filepath.Join(repo, catalogFilename))
+}
+
+// SetCatalog attaches the catalog to the node, UploadReader and UploadFile
+// will record the uploaded datasets in it. Pass nil to detach it.
+func (node StorageNode) SetCatalog(c *Catalog) {
+	node.catalog.Store(c)
+}
+
+// Catalog returns the catalog attached to the node, if any.
+func (node StorageNode) Catalog() *Catalog {
+	return node.catalog.Load()
+}
+
+// OnRecordError sets the function called when an upload could not be
+// recorded in the catalog. The upload itself succeeded, UploadReader and
+// UploadFile return its cid without error, and Reconcile lists the
+// dataset as untracked. Pass nil to remove the function.
+func (c *Catalog) OnRecordError(fn func(cid string, err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onError = fn
+}
+
+// Path returns the path of the catalog file.
+func (c *Catalog) Path() string {
+	return c.path
+}
+
+// Get returns the entry of the cid.
+func (c *Catalog) Get(cid string) (CatalogEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[cid]
+	return e, ok
+}
+
+// Put adds or replaces the entry of its cid and saves the catalog.
+func (c *Catalog) Put(entry CatalogEntry) error {
+	if entry.Cid == "" {
+		return errors.New("catalog entry without cid")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[entry.Cid] = entry
+	return c.save()
+}
+
+// Update updates the entry of the cid with fn and saves the catalog.
+// The entry is created if it does not exist.
+func (c *Catalog) Update(cid string, fn func(entry *CatalogEntry)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[cid]
+	if !ok {
+		e = CatalogEntry{Cid: cid}
+	}
+
+	fn(&e)
+	e.Cid = cid
+	c.entries[cid] = e
+
+	return c.save()
+}
+
+// Remove removes the entry of the cid and saves the catalog.
+func (c *Catalog) Remove(cid string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[cid]; !ok {
+		return nil
+	}
+
+	delete(c.entries, cid)
+	return c.save()
+}
+
+// Query returns the entries matching the query, sorted by upload time.
+func (c *Catalog) Query(q CatalogQuery) []CatalogEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var entries []CatalogEntry
+	for _, e := range c.entries {
+		if q.match(e) {
+			entries = append(entries, e)
+		}
+	}
+
+	sortCatalogEntries(entries)
+	return entries
+}
+
+// Reconcile flags the entries whose cid is not in the manifests as
+// missing, and clears the flag of the ones that are back.
+// It saves the catalog if an entry changed.
+func (c *Catalog) Reconcile(manifests []Manifest) (CatalogReconciliation, error) {
+	var result CatalogReconciliation
+
+	stored := make(map[string]struct{}, len(manifests))
+	for _, m := range manifests {
+		stored[m.Cid] = struct{}{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for cid, e := range c.entries {
+		_, ok := stored[cid]
+
+		switch {
+		case !ok && !e.Missing:
+			e.Missing = true
+			result.Missing = append(result.Missing, cid)
+		case ok && e.Missing:
+			e.Missing = false
+			result.Restored = append(result.Restored, cid)
+		default:
+			continue
+		}
+
+		c.entries[cid] = e
+	}
+
+	for _, m := range manifests {
+		if _, ok := c.entries[m.Cid]; !ok {
+			result.Untracked = append(result.Untracked, m)
+		}
+	}
+
+	slices.Sort(result.Missing)
+	slices.Sort(result.Restored)
+
+	if len(result.Missing) == 0 && len(result.Restored) == 0 {
+		return result, nil
+	}
+
+	return result, c.save()
+}
+
+// ReconcileCatalog reconciles the catalog with the manifests stored by the node.
+func (node StorageNode) ReconcileCatalog(c *Catalog) (CatalogReconciliation, error) {
+	manifests, err := node.Manifests()
+	if err != nil {
+		return CatalogReconciliation{}, err
+	}
+
+	return c.Reconcile(manifests)
+}
+
+// save writes the catalog into a temporary file and renames it,
+// so the catalog file is never partially written.
+// The caller must hold the lock.
+func (c *Catalog) save() error {
+	entries := make([]CatalogEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, e)
+	}
+	sortCatalogEntries(entries)
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.path)
+}
+
+func sortCatalogEntries(entries []CatalogEntry) {
+	slices.SortFunc(entries, func(a, b CatalogEntry) int {
+		if order := a.UploadedAt.Compare(b.UploadedAt); order != 0 {
+			return order
+		}
+
+		return strings.Compare(a.Cid, b.Cid)
+	})
+}
+
+// catalogUpload records an uploaded dataset in the catalog attached
+// to the node, if any. The failures are reported to the function set
+// with OnRecordError.
+func (node StorageNode) catalogUpload(cid string, options UploadOptions) {
+	c := node.Catalog()
+	if c == nil {
+		return
+	}
+
+	if err := node.recordUpload(c, cid, options); err != nil {
+		c.mu.Lock()
+		onError := c.onError
+		c.mu.Unlock()
+
+		if onError != nil {
+			onError(cid, fmt.Errorf("failed to record %s in the catalog: %w", cid, err))
+		}
+	}
+}
+
+func (node StorageNode) recordUpload(c *Catalog, cid string, options UploadOptions) error {
+	manifest, err := node.DownloadManifest(cid)
+	if err != nil {
+		return err
+	}
+
+	uploader := options.Uploader
+	if uploader == "" {
+		if uploader, err = node.PeerId(); err != nil {
+			return err
+		}
+	}
+
+	return c.Update(cid, func(e *CatalogEntry) {
+		e.Labels = options.Labels
+		e.Description = options.Description
+		e.Uploader = uploader
+		e.Attributes = options.Attributes
+		e.Filename = manifest.Filename
+		e.Mimetype = manifest.Mimetype
+		e.DatasetSize = manifest.DatasetSize
+		e.UploadedAt = time.Now()
+		e.Missing = false
+	})
+}
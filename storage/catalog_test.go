@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCatalogQuery(t *testing.T) {
+	c, err := OpenCatalog(filepath.Join(t.TempDir(), catalogFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	entries := []CatalogEntry{
+		{Cid: "a", Labels: []string{"video", "public"}, Mimetype: "video/mp4", DatasetSize: 1000, UploadedAt: now.Add(-2 * time.Hour)},
+		{Cid: "b", Labels: []string{"video"}, Mimetype: "video/mp4", DatasetSize: 10, UploadedAt: now.Add(-1 * time.Hour), Attributes: map[string]string{"team": "edge"}},
+		{Cid: "c", Labels: []string{"public"}, Mimetype: "text/plain", DatasetSize: 100, UploadedAt: now, Missing: true},
+	}
+
+	for _, e := range entries {
+		if err := c.Put(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		query    CatalogQuery
+		expected []string
+	}{
+		{"all", CatalogQuery{}, []string{"a", "b"}},
+		{"include missing", CatalogQuery{IncludeMissing: true}, []string{"a", "b", "c"}},
+		{"label", CatalogQuery{Labels: []string{"video"}}, []string{"a", "b"}},
+		{"labels", CatalogQuery{Labels: []string{"video", "public"}}, []string{"a"}},
+		{"mimetype", CatalogQuery{Mimetype: "text/plain", IncludeMissing: true}, []string{"c"}},
+		{"size range", CatalogQuery{MinSize: 50, MaxSize: 500, IncludeMissing: true}, []string{"c"}},
+		{"uploaded after", CatalogQuery{UploadedAfter: now.Add(-90 * time.Minute)}, []string{"b"}},
+		{"uploaded before", CatalogQuery{UploadedBefore: now.Add(-90 * time.Minute)}, []string{"a"}},
+		{"attributes", CatalogQuery{Attributes: map[string]string{"team": "edge"}}, []string{"b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cids []string
+			for _, e := range c.Query(tt.query) {
+				cids = append(cids, e.Cid)
+			}
+
+			if !slices.Equal(cids, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, cids)
+			}
+		})
+	}
+
+	// The catalog is persisted
+	reopened, err := OpenCatalog(c.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e, ok := reopened.Get("b"); !ok || e.Attributes["team"] != "edge" {
+		t.Fatalf("expected entry b to be persisted, got %+v", e)
+	}
+}
+
+func TestCatalogReconcile(t *testing.T) {
+	c, err := OpenCatalog(filepath.Join(t.TempDir(), catalogFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []CatalogEntry{{Cid: "a"}, {Cid: "b", Missing: true}, {Cid: "c"}} {
+		if err := c.Put(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := c.Reconcile([]Manifest{{Cid: "b"}, {Cid: "c"}, {Cid: "d"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(result.Missing, []string{"a"}) {
+		t.Errorf("expected missing [a], got %v", result.Missing)
+	}
+
+	if !slices.Equal(result.Restored, []string{"b"}) {
+		t.Errorf("expected restored [b], got %v", result.Restored)
+	}
+
+	if len(result.Untracked) != 1 || result.Untracked[0].Cid != "d" {
+		t.Errorf("expected untracked [d], got %v", result.Untracked)
+	}
+
+	if e, _ := c.Get("a"); !e.Missing {
+		t.Error("expected entry a to be flagged as missing")
+	}
+}
+
+func TestCatalogUpload(t *testing.T) {
+	storage := newStorageNode(t)
+
+	catalog, err := storage.OpenCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.SetCatalog(catalog)
+
+	buf := bytes.NewBuffer([]byte("Hello World!"))
+	cid, err := storage.UploadReader(context.Background(), UploadOptions{
+		Filepath:    "hello.txt",
+		Labels:      []string{"greeting"},
+		Description: "Hello World",
+		Attributes:  map[string]string{"lang": "en"},
+	}, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerId, err := storage.PeerId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := catalog.Query(CatalogQuery{Labels: []string{"greeting"}})
+	if len(entries) != 1 || entries[0].Cid != cid {
+		t.Fatalf("expected the uploaded cid in the catalog, got %+v", entries)
+	}
+
+	e := entries[0]
+	if e.Filename != "hello.txt" || e.Mimetype == "" || e.DatasetSize != 12 {
+		t.Errorf("expected the manifest information in the entry, got %+v", e)
+	}
+
+	if e.Uploader != peerId {
+		t.Errorf("expected uploader %q, got %q", peerId, e.Uploader)
+	}
+
+	if err := storage.Delete(cid); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := storage.ReconcileCatalog(catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(result.Missing, []string{cid}) {
+		t.Fatalf("expected %s to be missing, got %v", cid, result.Missing)
+	}
+}
+
+func TestCatalogUploadRecordError(t *testing.T) {
+	storage := newStorageNode(t)
+
+	// The catalog cannot be saved in a missing directory
+	catalog, err := OpenCatalog(filepath.Join(t.TempDir(), "missing", catalogFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.SetCatalog(catalog)
+
+	var failed []string
+	catalog.OnRecordError(func(cid string, err error) {
+		failed = append(failed, cid)
+	})
+
+	buf := bytes.NewBuffer([]byte("Hello World!"))
+	cid, err := storage.UploadReader(context.Background(), UploadOptions{Filepath: "hello.txt"}, buf)
+	if err != nil {
+		t.Fatalf("expected the upload to succeed, got %v", err)
+	}
+
+	if !slices.Equal(failed, []string{cid}) {
+		t.Fatalf("expected the record error of %s, got %v", cid, failed)
+	}
+}
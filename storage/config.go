@@ -0,0 +1,407 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigError is returned by Config.Validate for an invalid field.
+type ConfigError struct {
+	// Field is the JSON name of the field, like "log-level".
+	Field string
+
+	Value any
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s %v: %v", e.Field, e.Value, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Duration is a duration serialized in the format expected by the
+// library, like "30d" or "10m", see ParseDuration.
+type Duration time.Duration
+
+var durationUnits = []struct {
+	suffix string
+	unit   time.Duration
+}{
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+}
+
+// ParseDuration parses a duration made of integers followed by a unit,
+// s, m, h, d or w, like "30d" or "1h30m". The units are case insensitive
+// and a number without unit is a number of seconds.
+func ParseDuration(s string) (Duration, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+	if str == "" {
+		return 0, errors.New("empty duration")
+	}
+
+	if n, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return Duration(time.Duration(n) * time.Second), nil
+	}
+
+	var total time.Duration
+	for str != "" {
+		i := 0
+		for i < len(str) && str[i] >= '0' && str[i] <= '9' {
+			i++
+		}
+
+		if i == 0 || i == len(str) {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		n, err := strconv.ParseInt(str[:i], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+
+		var unit time.Duration
+		for _, u := range durationUnits {
+			if str[i:i+1] == u.suffix {
+				unit = u.unit
+				break
+			}
+		}
+
+		if unit == 0 {
+			return 0, fmt.Errorf("unknown unit %q in duration %q", str[i:i+1], s)
+		}
+
+		total += time.Duration(n) * unit
+		str = str[i+1:]
+	}
+
+	return Duration(total), nil
+}
+
+// String returns the duration with the largest exact unit, like "30d".
+// A negative duration is "0s".
+func (d Duration) String() string {
+	td := time.Duration(d)
+	if td <= 0 {
+		return "0s"
+	}
+
+	for _, u := range durationUnits {
+		if td%u.unit == 0 {
+			return strconv.FormatInt(int64(td/u.unit), 10) + u.suffix
+		}
+	}
+
+	// Sub-second durations are rounded up, see Validate
+	return strconv.FormatInt(int64((td+time.Second-1)/time.Second), 10) + "s"
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON accepts a string parsed by ParseDuration
+// or a number of seconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var n int64
+	if err := json.Unmarshal(data, &n); err == nil {
+		*d = Duration(time.Duration(n) * time.Second)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+
+	v, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = v
+	return nil
+}
+
+// ByteSize is a number of bytes, see ParseByteSize.
+type ByteSize int64
+
+const (
+	KiB ByteSize = 1 << (10 * (iota + 1))
+	MiB
+	GiB
+	TiB
+)
+
+var byteSizeUnits = map[string]ByteSize{
+	"":    1,
+	"b":   1,
+	"k":   KiB,
+	"kb":  1000,
+	"kib": KiB,
+	"m":   MiB,
+	"mb":  1000 * 1000,
+	"mib": MiB,
+	"g":   GiB,
+	"gb":  1000 * 1000 * 1000,
+	"gib": GiB,
+	"t":   TiB,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"tib": TiB,
+}
+
+// ParseByteSize parses a size like "20GiB", "512 MB" or "1.5GiB".
+// The units are case insensitive: KB, MB, GB and TB are powers of 1000,
+// KiB, MiB, GiB and TiB and the single letters K, M, G and T are powers
+// of 1024. A number without unit is a number of bytes.
+func ParseByteSize(s string) (ByteSize, error) {
+	str := strings.TrimSpace(s)
+
+	i := 0
+	for i < len(str) && (str[i] >= '0' && str[i] <= '9' || str[i] == '.') {
+		i++
+	}
+
+	if i == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	n, err := strconv.ParseFloat(str[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(str[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in size %q", s)
+	}
+
+	size := n * float64(unit)
+	if size > math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+
+	return ByteSize(size), nil
+}
+
+// String returns the size with the largest exact binary unit, like "20GiB".
+func (b ByteSize) String() string {
+	for _, u := range []struct {
+		suffix string
+		unit   ByteSize
+	}{{"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"KiB", KiB}} {
+		if b != 0 && b%u.unit == 0 {
+			return strconv.FormatInt(int64(b/u.unit), 10) + u.suffix
+		}
+	}
+
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
+
+// UnmarshalJSON accepts a number of bytes or a string
+// parsed by ParseByteSize. It is marshalled as a number.
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var n int64
+	if err := json.Unmarshal(data, &n); err == nil {
+		*b = ByteSize(n)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid size %s", data)
+	}
+
+	v, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+
+	*b = v
+	return nil
+}
+
+// NatOption is the method used to determine the public address.
+type NatOption string
+
+const (
+	NatAny  NatOption = "any"
+	NatNone NatOption = "none"
+	NatUpnp NatOption = "upnp"
+	NatPmp  NatOption = "pmp"
+)
+
+const natExtIPPrefix = "extip:"
+
+// NatExtIP uses the given public IP address.
+func NatExtIP(ip netip.Addr) NatOption {
+	return NatOption(natExtIPPrefix + ip.String())
+}
+
+// ExtIP returns the IP address of an extip option.
+func (n NatOption) ExtIP() (netip.Addr, bool) {
+	s, ok := strings.CutPrefix(string(n), natExtIPPrefix)
+	if !ok {
+		return netip.Addr{}, false
+	}
+
+	ip, err := netip.ParseAddr(s)
+	return ip, err == nil
+}
+
+// Validate checks that the option is any, none, upnp, pmp or extip:<IP>.
+func (n NatOption) Validate() error {
+	switch n {
+	case NatAny, NatNone, NatUpnp, NatPmp:
+		return nil
+	}
+
+	if strings.HasPrefix(string(n), natExtIPPrefix) {
+		if _, ok := n.ExtIP(); !ok {
+			return errors.New("extip requires a valid IP address")
+		}
+		return nil
+	}
+
+	return errors.New("must be one of any, none, upnp, pmp, extip:<IP>")
+}
+
+// Validate checks a log level, optionally followed by topic levels
+// like "info;trace:discv5,dht", case insensitive.
+func (l LogLevel) Validate() error {
+	for i, part := range strings.Split(string(l), ";") {
+		level := part
+		if i > 0 {
+			var topics string
+			var ok bool
+			level, topics, ok = strings.Cut(part, ":")
+			if !ok || strings.TrimSpace(topics) == "" {
+				return fmt.Errorf("expected <level>:<topics>, got %q", part)
+			}
+		}
+
+		switch LogLevel(strings.ToLower(strings.TrimSpace(level))) {
+		case TRACE, DEBUG, INFO, NOTICE, WARN, ERROR, FATAL, "none":
+		default:
+			return fmt.Errorf("unknown log level %q", level)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the fields of the configuration before it is passed to
+// the library. It returns the joined ConfigError of the invalid fields.
+// The zero values are valid and replaced by the library defaults.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(field string, value any, err error) {
+		if err != nil {
+			errs = append(errs, &ConfigError{Field: field, Value: value, Err: err})
+		}
+	}
+
+	if c.LogLevel != "" {
+		check("log-level", c.LogLevel, c.LogLevel.Validate())
+	}
+
+	switch c.LogFormat {
+	case "", LogFormatAuto, LogFormatColors, LogFormatNoColors, LogFormatJSON:
+	default:
+		check("log-format", c.LogFormat, errors.New("must be one of auto, colors, nocolors, json"))
+	}
+
+	if c.MetricsAddress != "" {
+		_, err := netip.ParseAddr(c.MetricsAddress)
+		check("metrics-address", c.MetricsAddress, err)
+	}
+
+	if c.MetricsPort != MetricsPortFree {
+		check("metrics-port", c.MetricsPort, validatePort(c.MetricsPort))
+	}
+	check("disc-port", c.DiscoveryPort, validatePort(c.DiscoveryPort))
+
+	for _, addr := range c.ListenAddrs {
+		check("listen-addrs", addr, validateMultiaddr(addr))
+	}
+
+	if c.Nat != "" {
+		check("nat", c.Nat, c.Nat.Validate())
+	}
+
+	for _, spr := range c.BootstrapNodes {
+		_, err := ParseSPR(spr)
+		check("bootstrap-node", spr, err)
+	}
+
+	switch c.RepoKind {
+	case "", FS, SQLite, LevelDb:
+	default:
+		check("repo-kind", c.RepoKind, errors.New("must be one of fs, sqlite, leveldb"))
+	}
+
+	check("storage-quota", c.StorageQuota, validatePositive(int64(c.StorageQuota)))
+	if c.BlockTtl != nil {
+		check("block-ttl", *c.BlockTtl, validateSeconds(*c.BlockTtl))
+	}
+	if mi := c.BlockMaintenanceInterval; mi != nil {
+		err := validateSeconds(*mi)
+		if err == nil && *mi == 0 {
+			err = errors.New("must be positive")
+		}
+		check("block-mi", *mi, err)
+	}
+	check("block-mn", c.BlockMaintenanceNumberOfBlocks, validatePositive(int64(c.BlockMaintenanceNumberOfBlocks)))
+	check("block-retries", c.BlockRetries, validatePositive(int64(c.BlockRetries)))
+	check("max-peers", c.MaxPeers, validatePositive(int64(c.MaxPeers)))
+	check("num-threads", c.NumThreads, validatePositive(int64(c.NumThreads)))
+	check("cache-size", c.CacheSize, validatePositive(int64(c.CacheSize)))
+
+	return errors.Join(errs...)
+}
+
+// ListenMultiaddrs parses the listen addresses, see ParseMultiaddr.
+func (c Config) ListenMultiaddrs() ([]Multiaddr, error) {
+	return ParseMultiaddrs(c.ListenAddrs)
+}
+
+func validatePort(port int) error {
+	if port < 0 || port > 65535 {
+		return errors.New("must be between 0 and 65535")
+	}
+	return nil
+}
+
+func validatePositive(n int64) error {
+	if n < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+// validateSeconds checks that the duration is a number of seconds,
+// the precision of the library.
+func validateSeconds(d Duration) error {
+	if d < 0 {
+		return errors.New("must not be negative")
+	}
+
+	if d > 0 && time.Duration(d)%time.Second != 0 {
+		return errors.New("must be a whole number of seconds")
+	}
+
+	return nil
+}
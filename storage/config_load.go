@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigSource is the layer that set a configuration field.
+type ConfigSource string
+
+const (
+	// SourceDefault means that the field was not set by the other layers,
+	// it comes from LoadOptions.Defaults or the library default.
+	SourceDefault ConfigSource = "default"
+
+	SourceFile     ConfigSource = "file"
+	SourceEnv      ConfigSource = "env"
+	SourceOverride ConfigSource = "override"
+)
+
+// ConfigOrigin is the provenance of a configuration field.
+type ConfigOrigin struct {
+	Source ConfigSource
+
+	// Name is the file path for SourceFile and the variable name
+	// for SourceEnv.
+	Name string
+}
+
+func (o ConfigOrigin) String() string {
+	if o.Name == "" {
+		return string(o.Source)
+	}
+	return fmt.Sprintf("%s %s", o.Source, o.Name)
+}
+
+// LoadOptions defines the layers merged by LoadLayeredConfig,
+// from the lowest to the highest priority.
+type LoadOptions struct {
+	// Defaults is the base configuration.
+	Defaults Config
+
+	// File is the path of a JSON or TOML configuration file, if any.
+	File string
+
+	// EnvPrefix is the prefix of the environment variables,
+	// see ConfigFromEnv. Empty disables the environment layer.
+	EnvPrefix string
+
+	// Overrides are applied last, only the non zero fields are used.
+	Overrides Config
+
+	// MaxBootstrapAge rejects the bootstrap nodes whose signed peer
+	// record is older, see SPR.Stale. 0 accepts any age.
+	MaxBootstrapAge time.Duration
+}
+
+// LoadedConfig is the result of LoadLayeredConfig.
+type LoadedConfig struct {
+	Config Config
+
+	// Origins maps the JSON name of each field, like "data-dir",
+	// to the layer that set it.
+	Origins map[string]ConfigOrigin
+}
+
+// Origin returns the provenance of a field, by JSON name.
+func (l LoadedConfig) Origin(field string) ConfigOrigin {
+	if o, ok := l.Origins[field]; ok {
+		return o
+	}
+	return ConfigOrigin{Source: SourceDefault}
+}
+
+// configField is a field of Config with its JSON name.
+type configField struct {
+	name  string
+	index int
+}
+
+func configFields() []configField {
+	t := reflect.TypeFor[Config]()
+
+	fields := make([]configField, 0, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields = append(fields, configField{name: name, index: i})
+		}
+	}
+
+	return fields
+}
+
+// LoadConfig reads a configuration file. The format is chosen by the
+// extension, .json or .toml, and the keys are the ones of the CLI,
+// like data-dir or bootstrap-node. The unknown keys are rejected.
+func LoadConfig(path string) (Config, error) {
+	config, _, err := loadConfigFile(path)
+	return config, err
+}
+
+func loadConfigFile(path string) (Config, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	var values map[string]any
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		err = d.Decode(&values)
+	case ".toml":
+		values, err = parseTOML(string(data))
+	default:
+		return Config{}, nil, fmt.Errorf("unsupported config file format %q", filepath.Ext(path))
+	}
+
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	config, err := configFromValues(values)
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	return config, keys, nil
+}
+
+// configFromValues decodes the values keyed by JSON names into a Config.
+func configFromValues(values map[string]any) (Config, error) {
+	var config Config
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return config, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+
+	if err := d.Decode(&config); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// ConfigFromEnv reads the configuration from the environment variables
+// named after the CLI keys, upper cased with underscores and prefixed,
+// like STORAGE_DATA_DIR or STORAGE_BOOTSTRAP_NODE for the prefix "STORAGE".
+// The lists are comma separated.
+func ConfigFromEnv(prefix string) (Config, error) {
+	config, _, err := configFromEnv(prefix, os.LookupEnv)
+	return config, err
+}
+
+// configFromEnv returns the configuration and the variable
+// name of each field set.
+func configFromEnv(prefix string, lookup func(string) (string, bool)) (Config, map[string]string, error) {
+	prefix = strings.TrimSuffix(prefix, "_")
+	t := reflect.TypeFor[Config]()
+
+	values := map[string]any{}
+	vars := map[string]string{}
+
+	for _, f := range configFields() {
+		name := strings.ToUpper(strings.ReplaceAll(f.name, "-", "_"))
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		raw, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		value, err := envValue(t.Field(f.index).Type, raw)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+
+		values[f.name] = value
+		vars[f.name] = name
+	}
+
+	config, err := configFromValues(values)
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("invalid config environment: %w", err)
+	}
+
+	return config, vars, nil
+}
+
+// envValue converts a variable to the JSON value of a field type.
+func envValue(t reflect.Type, raw string) (any, error) {
+	raw = strings.TrimSpace(raw)
+
+	switch t.Kind() {
+	case reflect.Slice:
+		values := []string{}
+		for v := range strings.SplitSeq(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values, nil
+	case reflect.Pointer:
+		return envValue(t.Elem(), raw)
+	case reflect.Bool:
+		return strconv.ParseBool(raw)
+	case reflect.Int, reflect.Int64:
+		// Durations and sizes also accept strings like 30d or 20GiB
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return n, nil
+		}
+		return raw, nil
+	default:
+		return raw, nil
+	}
+}
+
+// LoadLayeredConfig merges the defaults, the file, the environment and
+// the overrides, in this order, and records the origin of each field.
+// The fields present in the file or the environment are applied even if
+// they have a zero value, while only the non zero fields of the defaults
+// and the overrides are used.
+func LoadLayeredConfig(options LoadOptions) (LoadedConfig, error) {
+	loaded := LoadedConfig{Config: options.Defaults, Origins: map[string]ConfigOrigin{}}
+
+	if options.File != "" {
+		config, keys, err := loadConfigFile(options.File)
+		if err != nil {
+			return loaded, err
+		}
+
+		loaded.merge(config, func(f configField) (ConfigOrigin, bool) {
+			return ConfigOrigin{Source: SourceFile, Name: options.File}, slices.Contains(keys, f.name)
+		})
+	}
+
+	if options.EnvPrefix != "" {
+		config, vars, err := configFromEnv(options.EnvPrefix, os.LookupEnv)
+		if err != nil {
+			return loaded, err
+		}
+
+		loaded.merge(config, func(f configField) (ConfigOrigin, bool) {
+			v, ok := vars[f.name]
+			return ConfigOrigin{Source: SourceEnv, Name: v}, ok
+		})
+	}
+
+	overrides := reflect.ValueOf(options.Overrides)
+	loaded.merge(options.Overrides, func(f configField) (ConfigOrigin, bool) {
+		return ConfigOrigin{Source: SourceOverride}, !overrides.Field(f.index).IsZero()
+	})
+
+	for _, s := range loaded.Config.BootstrapNodes {
+		spr, err := ParseSPR(s)
+		if err != nil {
+			return loaded, &ConfigError{Field: "bootstrap-node", Value: s, Err: err}
+		}
+
+		if options.MaxBootstrapAge > 0 && spr.Stale(options.MaxBootstrapAge) {
+			err := fmt.Errorf("record of %s created at %s is stale", spr.PeerID, spr.Time().Format(time.RFC3339))
+			return loaded, &ConfigError{Field: "bootstrap-node", Value: s, Err: err}
+		}
+	}
+
+	return loaded, nil
+}
+
+// merge copies the fields of the layer selected by
+// the set function into the loaded config.
+func (l *LoadedConfig) merge(layer Config, set func(f configField) (ConfigOrigin, bool)) {
+	dst := reflect.ValueOf(&l.Config).Elem()
+	src := reflect.ValueOf(layer)
+
+	for _, f := range configFields() {
+		origin, ok := set(f)
+		if !ok {
+			continue
+		}
+
+		dst.Field(f.index).Set(src.Field(f.index))
+		l.Origins[f.name] = origin
+	}
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfigTOML(t *testing.T) {
+	path := writeConfigFile(t, "storage.toml", `
+# Node configuration
+data-dir = "/var/lib/storage"
+listen-addrs = [
+  "/ip4/0.0.0.0/tcp/8070", # tcp
+  '/ip4/0.0.0.0/udp/8070/quic-v1',
+]
+bootstrap-node = ["spr:abc"]
+disc-port = 8_090
+metrics = true
+storage-quota = "20GiB"
+block-ttl = "30d"
+log-level = "info"
+`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.DataDir != "/var/lib/storage" || config.DiscoveryPort != 8090 || !config.MetricsEnabled {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	if !slices.Equal(config.ListenAddrs, []string{"/ip4/0.0.0.0/tcp/8070", "/ip4/0.0.0.0/udp/8070/quic-v1"}) {
+		t.Fatalf("unexpected listen addrs %v", config.ListenAddrs)
+	}
+
+	if config.StorageQuota != 20*GiB || config.BlockTtl == nil || time.Duration(*config.BlockTtl) != 30*24*time.Hour {
+		t.Fatalf("unexpected quota %v or ttl %v", config.StorageQuota, config.BlockTtl)
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	path := writeConfigFile(t, "storage.json", `{"data-dir": "./data", "max-peers": 50, "block-mi": 600}`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.DataDir != "./data" || config.MaxPeers != 50 || config.BlockMaintenanceInterval == nil || time.Duration(*config.BlockMaintenanceInterval) != 10*time.Minute {
+		t.Fatalf("unexpected config %+v", config)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown.json": `{"datadir": "./data"}`,
+		"unknown.toml": `datadir = "./data"`,
+		"table.toml":   "[node]\ndata-dir = \"./data\"",
+		"string.toml":  `data-dir = "./data`,
+		"config.yaml":  `data-dir: ./data`,
+	} {
+		if _, err := LoadConfig(writeConfigFile(t, name, content)); err == nil {
+			t.Fatalf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	env := map[string]string{
+		"STORAGE_DATA_DIR":       "/data",
+		"STORAGE_BOOTSTRAP_NODE": "spr:a, spr:b",
+		"STORAGE_METRICS":        "true",
+		"STORAGE_STORAGE_QUOTA":  "1GiB",
+		"STORAGE_DISC_PORT":      "8091",
+		"STORAGE_BLOCK_TTL":      "0",
+		"STORAGE_BLOCK_MI":       "5m",
+	}
+
+	config, vars, err := configFromEnv("STORAGE", func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.DataDir != "/data" || !config.MetricsEnabled || config.StorageQuota != GiB || config.DiscoveryPort != 8091 {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	if !slices.Equal(config.BootstrapNodes, []string{"spr:a", "spr:b"}) {
+		t.Fatalf("unexpected bootstrap nodes %v", config.BootstrapNodes)
+	}
+
+	if config.BlockTtl == nil || *config.BlockTtl != 0 {
+		t.Fatalf("expected a disabled ttl, got %v", config.BlockTtl)
+	}
+
+	if config.BlockMaintenanceInterval == nil || time.Duration(*config.BlockMaintenanceInterval) != 5*time.Minute {
+		t.Fatalf("unexpected maintenance interval %v", config.BlockMaintenanceInterval)
+	}
+
+	if vars["data-dir"] != "STORAGE_DATA_DIR" {
+		t.Fatalf("unexpected variables %v", vars)
+	}
+
+	_, _, err = configFromEnv("STORAGE_", func(name string) (string, bool) {
+		return "many", name == "STORAGE_MAX_PEERS"
+	})
+	if err == nil {
+		t.Fatal("expected an error for an invalid integer")
+	}
+}
+
+func TestLoadLayeredConfig(t *testing.T) {
+	path := writeConfigFile(t, "storage.toml", `
+data-dir = "/file"
+max-peers = 10
+metrics = false
+`)
+
+	t.Setenv("TEST_STORAGE_MAX_PEERS", "20")
+
+	loaded, err := LoadLayeredConfig(LoadOptions{
+		Defaults:  Config{DataDir: "/default", MetricsEnabled: true, AgentString: "default"},
+		File:      path,
+		EnvPrefix: "TEST_STORAGE",
+		Overrides: Config{AgentString: "override"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := loaded.Config
+	if c.DataDir != "/file" || c.MaxPeers != 20 || c.MetricsEnabled || c.AgentString != "override" {
+		t.Fatalf("unexpected config %+v", c)
+	}
+
+	expected := map[string]ConfigOrigin{
+		"data-dir":     {Source: SourceFile, Name: path},
+		"metrics":      {Source: SourceFile, Name: path},
+		"max-peers":    {Source: SourceEnv, Name: "TEST_STORAGE_MAX_PEERS"},
+		"agent-string": {Source: SourceOverride},
+		"repo-kind":    {Source: SourceDefault},
+	}
+
+	for field, origin := range expected {
+		if loaded.Origin(field) != origin {
+			t.Fatalf("expected %s from %s, got %s", field, origin, loaded.Origin(field))
+		}
+	}
+}
+
+func TestLoadLayeredConfigStaleBootstrap(t *testing.T) {
+	options := LoadOptions{
+		Overrides:       Config{BootstrapNodes: []string{testnetSPR}},
+		MaxBootstrapAge: 24 * time.Hour,
+	}
+
+	var configErr *ConfigError
+	if _, err := LoadLayeredConfig(options); !errors.As(err, &configErr) || configErr.Field != "bootstrap-node" {
+		t.Fatalf("expected a stale bootstrap node error, got %v", err)
+	}
+
+	options.MaxBootstrapAge = 0
+	if _, err := LoadLayeredConfig(options); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"10H", 10 * time.Hour},
+		{"1h30m", 90 * time.Minute},
+		{"2w", 14 * 24 * time.Hour},
+		{"3600", time.Hour},
+	}
+
+	for _, tt := range tests {
+		d, err := ParseDuration(tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.in, err)
+		}
+
+		if time.Duration(d) != tt.expected {
+			t.Fatalf("%s: expected %v, got %v", tt.in, tt.expected, time.Duration(d))
+		}
+	}
+
+	for _, in := range []string{"", "h", "10x", "10h5"} {
+		if _, err := ParseDuration(in); err == nil {
+			t.Fatalf("expected an error for %q", in)
+		}
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	ttl, mi := Duration(30*24*time.Hour), Duration(90*time.Second)
+	data, err := json.Marshal(Config{BlockTtl: &ttl, BlockMaintenanceInterval: &mi})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `"block-ttl":"30d"`) || !strings.Contains(string(data), `"block-mi":"90s"`) {
+		t.Fatalf("unexpected JSON %s", data)
+	}
+
+	var c Config
+	if err := json.Unmarshal([]byte(`{"block-ttl":"10H","block-mi":600}`), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.BlockTtl == nil || time.Duration(*c.BlockTtl) != 10*time.Hour || c.BlockMaintenanceInterval == nil || time.Duration(*c.BlockMaintenanceInterval) != 10*time.Minute {
+		t.Fatalf("unexpected durations %v %v", c.BlockTtl, c.BlockMaintenanceInterval)
+	}
+
+	// A zero ttl is sent to disable it, an unset one is left to the default
+	disabled := Duration(0)
+	data, err = json.Marshal(Config{BlockTtl: &disabled})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `"block-ttl":"0s"`) {
+		t.Fatalf("expected the disabled ttl in %s", data)
+	}
+
+	data, err = json.Marshal(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "block-ttl") || strings.Contains(string(data), "block-mi") {
+		t.Fatalf("expected no ttl nor maintenance interval in %s", data)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected ByteSize
+	}{
+		{"20GiB", 20 * GiB},
+		{"512 MB", 512 * 1000 * 1000},
+		{"1.5gib", 3 * GiB / 2},
+		{"4096", 4096},
+		{"1k", KiB},
+	}
+
+	for _, tt := range tests {
+		b, err := ParseByteSize(tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.in, err)
+		}
+
+		if b != tt.expected {
+			t.Fatalf("%s: expected %d, got %d", tt.in, tt.expected, b)
+		}
+	}
+
+	for _, in := range []string{"", "GiB", "20XB"} {
+		if _, err := ParseByteSize(in); err == nil {
+			t.Fatalf("expected an error for %q", in)
+		}
+	}
+
+	if (20 * GiB).String() != "20GiB" {
+		t.Fatalf("unexpected string %s", 20*GiB)
+	}
+
+	var c Config
+	if err := json.Unmarshal([]byte(`{"storage-quota":"1GiB"}`), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `"storage-quota":1073741824`) {
+		t.Fatalf("expected the quota to be marshalled as bytes, got %s", data)
+	}
+}
+
+func TestNatOption(t *testing.T) {
+	nat := NatExtIP(netip.MustParseAddr("1.2.3.4"))
+	if nat != "extip:1.2.3.4" {
+		t.Fatalf("unexpected nat option %s", nat)
+	}
+
+	if ip, ok := nat.ExtIP(); !ok || ip.String() != "1.2.3.4" {
+		t.Fatalf("unexpected ext ip %v", ip)
+	}
+
+	for _, n := range []NatOption{NatAny, NatNone, NatUpnp, NatPmp, nat} {
+		if err := n.Validate(); err != nil {
+			t.Fatalf("%s: %v", n, err)
+		}
+	}
+
+	for _, n := range []NatOption{"extip:nope", "auto"} {
+		if err := n.Validate(); err == nil {
+			t.Fatalf("expected an error for %s", n)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	ttl, subSecond, zero := Duration(time.Hour), Duration(1500*time.Millisecond), Duration(0)
+
+	valid := Config{
+		LogLevel:       "INFO;trace:discv5,dht",
+		Nat:            NatNone,
+		ListenAddrs:    []string{"/ip4/127.0.0.1/tcp/0", "/ip4/127.0.0.1/udp/0/quic-v1"},
+		BootstrapNodes: []string{testnetSPR},
+		StorageQuota:   20 * GiB,
+		BlockTtl:       &ttl,
+		MetricsPort:    MetricsPortFree,
+	}
+
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := valid.ListenMultiaddrs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A misspelled protocol is not left to the library
+	typo := Config{ListenAddrs: []string{"/ip4/1.2.3.4/tpc/8070"}}
+	if err := typo.Validate(); !errors.Is(err, ErrUnknownProtocol) {
+		t.Fatalf("expected ErrUnknownProtocol, got %v", err)
+	}
+
+	if err := (Config{}).Validate(); err != nil {
+		t.Fatalf("expected the zero config to be valid: %v", err)
+	}
+
+	invalid := Config{
+		LogLevel:                 "verbose",
+		Nat:                      "extip:1.2.3",
+		ListenAddrs:              []string{"0.0.0.0:8070"},
+		BootstrapNodes:           []string{"enr:abc"},
+		DiscoveryPort:            70000,
+		MetricsPort:              -2,
+		BlockTtl:                 &subSecond,
+		BlockMaintenanceInterval: &zero,
+	}
+
+	err := invalid.Validate()
+	if err == nil {
+		t.Fatal("expected the config to be invalid")
+	}
+
+	fields := map[string]bool{}
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var configErr *ConfigError
+		if !errors.As(e, &configErr) {
+			t.Fatalf("expected a ConfigError, got %v", e)
+		}
+		fields[configErr.Field] = true
+	}
+
+	for _, field := range []string{"log-level", "nat", "listen-addrs", "bootstrap-node", "disc-port", "metrics-port", "block-ttl", "block-mi"} {
+		if !fields[field] {
+			t.Fatalf("expected an error for %s, got %v", field, err)
+		}
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	_, err := New(Config{DataDir: t.TempDir(), Nat: "sometimes"})
+
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Field != "nat" {
+		t.Fatalf("expected a nat config error, got %v", err)
+	}
+}
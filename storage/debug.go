@@ -54,9 +54,35 @@ type PeerRecord struct {
 	Addresses []string `json:"addresses,omitempty"`
 }
 
+// PeerID returns the typed peer id of the node.
+func (d DebugInfo) PeerID() (PeerID, error) {
+	return ParsePeerID(d.ID)
+}
+
+// Multiaddrs returns the typed listen addresses.
+func (d DebugInfo) Multiaddrs() ([]Multiaddr, error) {
+	return ParseMultiaddrs(d.Addrs)
+}
+
+// AnnounceMultiaddrs returns the typed announced addresses.
+func (d DebugInfo) AnnounceMultiaddrs() ([]Multiaddr, error) {
+	return ParseMultiaddrs(d.AnnounceAddresses)
+}
+
+// PeerID returns the typed peer id of the record.
+func (r PeerRecord) PeerID() (PeerID, error) {
+	return ParsePeerID(r.PeerId)
+}
+
+// Multiaddrs returns the typed addresses of the record.
+func (r PeerRecord) Multiaddrs() ([]Multiaddr, error) {
+	return ParseMultiaddrs(r.Addresses)
+}
+
 // Debug retrieves debugging information from the Logos Storage node.
-func (node StorageNode) Debug() (DebugInfo, error) {
-	var info DebugInfo
+func (node StorageNode) Debug() (info DebugInfo, err error) {
+	op := node.observe(OpDebug, nil)
+	defer op.end(&err)
 
 	bridge := newBridgeCtx()
 	defer bridge.free()
@@ -80,7 +106,10 @@ func (node StorageNode) Debug() (DebugInfo, error) {
 // You can also use Chronicles topic directives. So for example if you want
 // to update the general level to INFO but want to see TRACE logs for the libstorage
 // topic, you can pass "INFO,libstorage:TRACE".
-func (node StorageNode) UpdateLogLevel(logLevel string) error {
+func (node StorageNode) UpdateLogLevel(logLevel string) (err error) {
+	op := node.observe(OpLogLevel, nil)
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -91,15 +120,16 @@ func (node StorageNode) UpdateLogLevel(logLevel string) error {
 		return bridge.callError("cGoStorageLogLevel")
 	}
 
-	_, err := bridge.wait()
+	_, err = bridge.wait()
 	return err
 }
 
 // StoragePeerDebug retrieves the peer record for a given peer ID.
 // This function is available only if the flag
 // -d:storage_enable_api_debug_peers=true was set at build time.
-func (node StorageNode) StoragePeerDebug(peerId string) (PeerRecord, error) {
-	var record PeerRecord
+func (node StorageNode) StoragePeerDebug(peerId string) (record PeerRecord, err error) {
+	op := node.observe(OpPeerDebug, Attrs{AttrPeerId: peerId})
+	defer op.end(&err)
 
 	bridge := newBridgeCtx()
 	defer bridge.free()
@@ -0,0 +1,438 @@
+package storage
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"regexp"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDiagnosticsMaxSize      = 16 * MiB
+	defaultDiagnosticsMaxLogBytes  = 4 * MiB
+	defaultDiagnosticsMaxManifests = 1000
+	defaultDiagnosticsTimeout      = 10 * time.Second
+
+	// diagnosticsIndexName is the last file of the bundle, it
+	// lists the files and the errors met while collecting them.
+	diagnosticsIndexName = "bundle.json"
+
+	redacted = "[redacted]"
+)
+
+type DiagnosticsOptions struct {
+	// MaxSize is the maximum uncompressed size of the files of the
+	// bundle. The files are truncated when it is reached.
+	// Default: 16 MiB
+	MaxSize ByteSize
+
+	// MaxLogBytes is the maximum size of the end of LogFile included.
+	// Default: 4 MiB
+	MaxLogBytes ByteSize
+
+	// MaxManifests is the maximum number of manifests listed,
+	// the summary counts all of them.
+	// Default: 1000
+	MaxManifests int
+
+	// Timeout is the maximum duration of each call to the library.
+	// Default: 10 seconds
+	Timeout time.Duration
+
+	// RedactPrivateAddresses replaces the private, loopback and
+	// link-local IP addresses, and removes the signed peer records
+	// which contain them.
+	RedactPrivateAddresses bool
+}
+
+// DiagnosticsFile is a file of the bundle, listed in bundle.json.
+type DiagnosticsFile struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// diagnosticsIndex is the content of bundle.json.
+type diagnosticsIndex struct {
+	CreatedAt time.Time         `json:"createdAt"`
+	Version   string            `json:"version"`
+	Revision  string            `json:"revision"`
+	GoVersion string            `json:"goVersion"`
+	OS        string            `json:"os"`
+	Arch      string            `json:"arch"`
+	State     NodeState         `json:"state"`
+	Redacted  bool              `json:"redactedPrivateAddresses"`
+	Files     []DiagnosticsFile `json:"files"`
+}
+
+// ManifestsSummary is the summary of the manifests of the node
+// written in the diagnostics bundle.
+type ManifestsSummary struct {
+	Count     int        `json:"count"`
+	Bytes     int64      `json:"bytes"`
+	Protected int        `json:"protected"`
+	Manifests []Manifest `json:"manifests"`
+	Truncated bool       `json:"truncated,omitempty"`
+}
+
+// DiagnosticsBundle writes a zip of the data needed to investigate an
+// issue: the versions, the redacted config, the debug info and routing
+// table, the space, a summary of the manifests, the end of the log file,
+// the goroutines and the Go runtime stats.
+//
+// A section that cannot be collected, like the debug info of a stopped
+// node, is recorded with its error in bundle.json, the last file, and
+// does not fail the bundle. The key file path is always redacted.
+func (node StorageNode) DiagnosticsBundle(ctx context.Context, w io.Writer, options DiagnosticsOptions) error {
+	if options.MaxSize <= 0 {
+		options.MaxSize = defaultDiagnosticsMaxSize
+	}
+
+	if options.MaxLogBytes <= 0 {
+		options.MaxLogBytes = defaultDiagnosticsMaxLogBytes
+	}
+
+	if options.MaxManifests <= 0 {
+		options.MaxManifests = defaultDiagnosticsMaxManifests
+	}
+
+	if options.Timeout <= 0 {
+		options.Timeout = defaultDiagnosticsTimeout
+	}
+
+	b := &diagnosticsBundle{
+		zw:        zip.NewWriter(w),
+		options:   options,
+		remaining: int64(options.MaxSize),
+		index: diagnosticsIndex{
+			CreatedAt: time.Now(),
+			Version:   node.Version(),
+			Revision:  node.Revision(),
+			GoVersion: runtime.Version(),
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+			State:     node.State(),
+			Redacted:  options.RedactPrivateAddresses,
+		},
+	}
+
+	b.json("config.json", func() (any, error) {
+		return redactConfig(node.config, options.RedactPrivateAddresses), nil
+	})
+
+	var info DebugInfo
+	b.json("debug.json", func() (any, error) {
+		var err error
+		info, err = callWithTimeout(ctx, options.Timeout, node.Debug)
+		if err != nil {
+			return nil, err
+		}
+
+		info = redactDebugInfo(info, options.RedactPrivateAddresses)
+		return info, nil
+	})
+
+	b.json("routing-table.json", func() (any, error) {
+		if info.ID == "" {
+			return nil, fmt.Errorf("debug info not available")
+		}
+		return info.PeersTable, nil
+	})
+
+	b.json("space.json", func() (any, error) {
+		return callWithTimeout(ctx, options.Timeout, node.Space)
+	})
+
+	b.json("manifests.json", func() (any, error) {
+		return callWithTimeout(ctx, options.Timeout, func() (ManifestsSummary, error) {
+			return node.manifestsSummary(options.MaxManifests)
+		})
+	})
+
+	if node.config.LogFile != "" {
+		b.file("logs/storage.log", func(w io.Writer) error {
+			return tailFile(w, node.config.LogFile, int64(options.MaxLogBytes), options.RedactPrivateAddresses)
+		})
+	}
+
+	b.file("goroutines.txt", func(w io.Writer) error {
+		return pprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+
+	b.json("runtime.json", func() (any, error) {
+		return goRuntimeStats(), nil
+	})
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.close()
+}
+
+// manifestsSummary counts the manifests and keeps the first ones.
+func (node StorageNode) manifestsSummary(max int) (ManifestsSummary, error) {
+	summary := ManifestsSummary{Manifests: []Manifest{}}
+
+	for m, err := range node.ManifestsSeq(ManifestFilter{}) {
+		if err != nil {
+			return summary, err
+		}
+
+		summary.Count++
+		summary.Bytes += int64(m.DatasetSize)
+		if m.Protected {
+			summary.Protected++
+		}
+
+		if len(summary.Manifests) < max {
+			summary.Manifests = append(summary.Manifests, m)
+		} else {
+			summary.Truncated = true
+		}
+	}
+
+	return summary, nil
+}
+
+// diagnosticsBundle writes the files of the bundle within the size budget.
+type diagnosticsBundle struct {
+	zw        *zip.Writer
+	options   DiagnosticsOptions
+	remaining int64
+	index     diagnosticsIndex
+}
+
+// file writes a file with the content produced by fn, truncated to the
+// remaining budget. The error of fn is recorded in the index.
+func (b *diagnosticsBundle) file(name string, fn func(w io.Writer) error) {
+	entry := DiagnosticsFile{Name: name}
+	defer func() {
+		b.index.Files = append(b.index.Files, entry)
+	}()
+
+	if b.remaining <= 0 {
+		entry.Truncated = true
+		entry.Error = "bundle size limit reached"
+		return
+	}
+
+	zf, err := b.zw.Create(name)
+	if err != nil {
+		entry.Error = err.Error()
+		return
+	}
+
+	lw := &limitedWriter{w: zf, remaining: b.remaining}
+	err = fn(lw)
+
+	entry.Size = lw.written
+	entry.Truncated = lw.truncated
+	b.remaining -= lw.written
+
+	if err != nil && err != errWriteLimit {
+		entry.Error = err.Error()
+	}
+}
+
+// json writes the value returned by fn as indented JSON.
+func (b *diagnosticsBundle) json(name string, fn func() (any, error)) {
+	b.file(name, func(w io.Writer) error {
+		v, err := fn()
+		if err != nil {
+			return err
+		}
+
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if b.options.RedactPrivateAddresses {
+			data = redactPrivateAddresses(data)
+		}
+
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// close writes the index, outside of the size budget, and the zip directory.
+func (b *diagnosticsBundle) close() error {
+	zf, err := b.zw.Create(diagnosticsIndexName)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(zf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(b.index); err != nil {
+		return err
+	}
+
+	return b.zw.Close()
+}
+
+var errWriteLimit = fmt.Errorf("write limit reached")
+
+// limitedWriter writes at most remaining bytes and
+// drops the rest, marking the output truncated.
+type limitedWriter struct {
+	w         io.Writer
+	remaining int64
+	written   int64
+	truncated bool
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining {
+		n, err := l.w.Write(p[:l.remaining])
+		l.written += int64(n)
+		l.remaining -= int64(n)
+		l.truncated = true
+		if err != nil {
+			return n, err
+		}
+		return n, errWriteLimit
+	}
+
+	n, err := l.w.Write(p)
+	l.written += int64(n)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// tailFile copies the last max bytes of the file.
+func tailFile(w io.Writer, path string, max int64, redact bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if offset := stat.Size() - max; offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(f, max))
+	if err != nil {
+		return err
+	}
+
+	// Drop the partial first line
+	if stat.Size() > max {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+
+	if redact {
+		data = redactPrivateAddresses(data)
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// redactConfig removes the key file path and, if requested, the
+// bootstrap records. The private addresses of the listen addresses
+// are replaced in the JSON output.
+func redactConfig(c Config, private bool) Config {
+	if c.NetPrivKeyFile != "" {
+		c.NetPrivKeyFile = redacted
+	}
+
+	if private && len(c.BootstrapNodes) > 0 {
+		nodes := make([]string, len(c.BootstrapNodes))
+		for i := range nodes {
+			nodes[i] = redacted
+		}
+		c.BootstrapNodes = nodes
+	}
+
+	return c
+}
+
+// redactDebugInfo removes the signed peer records, which
+// contain the addresses, when the private addresses are redacted.
+func redactDebugInfo(info DebugInfo, private bool) DebugInfo {
+	if !private {
+		return info
+	}
+
+	info.Spr = redacted
+	info.PeersTable.LocalNode.Record = redacted
+
+	nodes := make([]Node, len(info.PeersTable.Nodes))
+	for i, n := range info.PeersTable.Nodes {
+		n.Record = redacted
+		nodes[i] = n
+	}
+	info.PeersTable.Nodes = nodes
+
+	return info
+}
+
+// addressPattern matches the IPv4 addresses, and the IPv6
+// addresses of the multiaddrs.
+var addressPattern = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b|/ip6/[0-9A-Fa-f:.]+`)
+
+// redactPrivateAddresses replaces the private addresses of a text.
+func redactPrivateAddresses(data []byte) []byte {
+	return addressPattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		s, ip6 := strings.CutPrefix(string(match), "/ip6/")
+
+		addr, err := netip.ParseAddr(s)
+		if err != nil || !isPrivateAddr(addr) {
+			return match
+		}
+
+		if ip6 {
+			return []byte("/ip6/" + redacted)
+		}
+		return []byte(redacted)
+	})
+}
+
+func isPrivateAddr(addr netip.Addr) bool {
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified()
+}
+
+// goRuntimeStats returns the Go runtime stats of the bundle.
+func goRuntimeStats() map[string]any {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return map[string]any{
+		"goroutines":    runtime.NumGoroutine(),
+		"cpus":          runtime.NumCPU(),
+		"gomaxprocs":    runtime.GOMAXPROCS(0),
+		"cgoCalls":      runtime.NumCgoCall(),
+		"heapAlloc":     m.HeapAlloc,
+		"heapSys":       m.HeapSys,
+		"heapObjects":   m.HeapObjects,
+		"totalAlloc":    m.TotalAlloc,
+		"sys":           m.Sys,
+		"numGC":         m.NumGC,
+		"pauseTotalNs":  m.PauseTotalNs,
+		"lastGC":        time.Unix(0, int64(m.LastGC)),
+		"gcCPUFraction": m.GCCPUFraction,
+	}
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readBundle(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[f.Name] = b
+	}
+
+	return files
+}
+
+func TestDiagnosticsBundle(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "storage.log")
+
+	node := newStorageNode(t, Config{
+		LogLevel: "INFO",
+		LogFile:  logFile,
+	})
+
+	var buf bytes.Buffer
+	if err := node.DiagnosticsBundle(context.Background(), &buf, DiagnosticsOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readBundle(t, buf.Bytes())
+
+	for _, name := range []string{"config.json", "debug.json", "routing-table.json", "space.json", "manifests.json", "logs/storage.log", "goroutines.txt", "runtime.json", "bundle.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+
+	var index struct {
+		Version string            `json:"version"`
+		State   string            `json:"state"`
+		Files   []DiagnosticsFile `json:"files"`
+	}
+	if err := json.Unmarshal(files["bundle.json"], &index); err != nil {
+		t.Fatal(err)
+	}
+
+	if index.Version != node.Version() || index.State != "started" {
+		t.Fatalf("unexpected index %+v", index)
+	}
+
+	for _, f := range index.Files {
+		if f.Error != "" {
+			t.Errorf("%s: %s", f.Name, f.Error)
+		}
+	}
+
+	var config Config
+	if err := json.Unmarshal(files["config.json"], &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.DataDir != node.config.DataDir {
+		t.Fatalf("expected the data dir %s, got %s", node.config.DataDir, config.DataDir)
+	}
+}
+
+func TestDiagnosticsBundleLimit(t *testing.T) {
+	var buf bytes.Buffer
+	b := &diagnosticsBundle{zw: zip.NewWriter(&buf), remaining: 10}
+
+	b.file("a.txt", func(w io.Writer) error {
+		_, err := w.Write([]byte("0123456"))
+		return err
+	})
+
+	b.file("b.txt", func(w io.Writer) error {
+		_, err := w.Write([]byte("0123456"))
+		return err
+	})
+
+	b.file("c.txt", func(w io.Writer) error {
+		_, err := w.Write([]byte("0123456"))
+		return err
+	})
+
+	b.json("d.json", func() (any, error) {
+		return nil, errors.New("not available")
+	})
+
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readBundle(t, buf.Bytes())
+
+	if string(files["a.txt"]) != "0123456" || string(files["b.txt"]) != "012" {
+		t.Fatalf("unexpected files %q %q", files["a.txt"], files["b.txt"])
+	}
+
+	if _, ok := files["c.txt"]; ok {
+		t.Fatal("expected c.txt to be skipped")
+	}
+
+	var index struct {
+		Files []DiagnosticsFile `json:"files"`
+	}
+	if err := json.Unmarshal(files[diagnosticsIndexName], &index); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []DiagnosticsFile{
+		{Name: "a.txt", Size: 7},
+		{Name: "b.txt", Size: 3, Truncated: true},
+		{Name: "c.txt", Truncated: true, Error: "bundle size limit reached"},
+		{Name: "d.json", Truncated: true, Error: "bundle size limit reached"},
+	}
+
+	if len(index.Files) != len(want) {
+		t.Fatalf("expected %d files, got %+v", len(want), index.Files)
+	}
+
+	for i := range want {
+		if index.Files[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], index.Files[i])
+		}
+	}
+}
+
+func TestDiagnosticsBundleError(t *testing.T) {
+	var buf bytes.Buffer
+	b := &diagnosticsBundle{zw: zip.NewWriter(&buf), remaining: 100}
+
+	b.json("space.json", func() (any, error) {
+		return nil, errors.New("node is not started")
+	})
+
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if f := b.index.Files[0]; f.Error != "node is not started" || f.Truncated {
+		t.Fatalf("unexpected entry %+v", f)
+	}
+}
+
+func TestRedactPrivateAddresses(t *testing.T) {
+	in := `"/ip4/192.168.1.10/tcp/8070", "/ip4/8.8.8.8/tcp/8070", "127.0.0.1", ` +
+		`"/ip6/::1/tcp/8070", "/ip6/2001:4860::8888/udp/8090", "/ip4/100.64.0.1/tcp/1"`
+
+	want := `"/ip4/[redacted]/tcp/8070", "/ip4/8.8.8.8/tcp/8070", "[redacted]", ` +
+		`"/ip6/[redacted]/tcp/8070", "/ip6/2001:4860::8888/udp/8090", "/ip4/100.64.0.1/tcp/1"`
+
+	if got := string(redactPrivateAddresses([]byte(in))); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestRedactConfig(t *testing.T) {
+	c := Config{
+		DataDir:        "/data",
+		NetPrivKeyFile: "/secrets/key",
+		BootstrapNodes: []string{testnetSPR},
+	}
+
+	r := redactConfig(c, false)
+	if r.NetPrivKeyFile != redacted || r.BootstrapNodes[0] != testnetSPR {
+		t.Fatalf("unexpected config %+v", r)
+	}
+
+	r = redactConfig(c, true)
+	if r.BootstrapNodes[0] != redacted || c.BootstrapNodes[0] != testnetSPR {
+		t.Fatalf("expected only the copy to be redacted, got %+v and %+v", r, c)
+	}
+
+	if r.DataDir != "/data" {
+		t.Fatalf("expected the data dir to be kept, got %s", r.DataDir)
+	}
+}
+
+func TestRedactDebugInfo(t *testing.T) {
+	info := DebugInfo{
+		ID:  "16Uiu2",
+		Spr: "spr:abc",
+		PeersTable: RoutingTable{
+			LocalNode: Node{PeerId: "16Uiu2", Record: "spr:abc"},
+			Nodes:     []Node{{PeerId: "16Uiu3", Record: "spr:def"}},
+		},
+	}
+
+	r := redactDebugInfo(info, true)
+	if r.Spr != redacted || r.PeersTable.LocalNode.Record != redacted || r.PeersTable.Nodes[0].Record != redacted {
+		t.Fatalf("expected the records to be redacted, got %+v", r)
+	}
+
+	if info.PeersTable.Nodes[0].Record != "spr:def" {
+		t.Fatal("expected the original nodes to be kept")
+	}
+
+	if r := redactDebugInfo(info, false); r.Spr != "spr:abc" {
+		t.Fatalf("expected the records to be kept, got %+v", r)
+	}
+}
+
+func TestTailFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.log")
+	lines := "first line\nsecond line from 10.0.0.1\nthird line\n"
+
+	if err := os.WriteFile(path, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := tailFile(&buf, path, 100, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != lines {
+		t.Fatalf("expected the whole file, got %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := tailFile(&buf, path, 30, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "third line") {
+		t.Fatalf("expected the partial line to be dropped, got %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := tailFile(&buf, path, 40, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "second line from [redacted]\nthird line\n" {
+		t.Fatalf("unexpected tail %q", buf.String())
+	}
+}
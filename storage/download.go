@@ -28,9 +28,7 @@ import "C"
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
-	"sync/atomic"
 	"unsafe"
 )
 
@@ -114,9 +112,10 @@ type Manifest struct {
 }
 
 // DownloadManifest retrieves the Logos Storage manifest from its cid.
-// The session identifier is the cid, i.e you cannot have multiple
-// sessions for a cid.
-func (node StorageNode) DownloadManifest(cid string) (Manifest, error) {
+func (node StorageNode) DownloadManifest(cid string) (_ Manifest, err error) {
+	op := node.observe(OpDownloadManifest, Attrs{AttrCid: cid})
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -148,9 +147,31 @@ func (node StorageNode) DownloadManifest(cid string) (Manifest, error) {
 // If options.writer is set, the data will be written into that writer.
 // The options filepath and writer are not mutually exclusive, i.e you can write
 // in different places in a same call.
-func (node StorageNode) DownloadStream(ctx context.Context, cid string, options DownloadStreamOptions) error {
-	bridge := newBridgeCtx()
-	defer bridge.free()
+// If the writer fails or writes less than a full chunk, the download is
+// stopped and the write error is returned, wrapped with the cid and the
+// byte offset where the write failed.
+//
+// The library identifies a download session by its cid, so concurrent calls
+// for the same cid share one underlying session and each chunk is fanned
+// out to every caller. A call can join a session only until its first chunk
+// has been received, and only with the same Local and ChunkSize options.
+// Since the library allows one session per cid, a later call waits for the
+// whole transfer of the running session before starting its own: the calls
+// that miss the first chunk are run one after another, not shared.
+// Cancelling the context or failing to write only detaches the caller,
+// the session is cancelled when its last caller is gone. DownloadStream
+// returns once the write in progress, if any, is over. Each caller has its
+// own queue of a few chunks, so a slow writer does not slow down the others
+// until its queue is full: the session then waits for it.
+// If a manual session started by DownloadInit is active for the cid,
+// it returns ErrDownloadInProgress.
+//
+// The file at Filepath is only created when the download succeeds:
+// the data is written to a temporary file in the same directory,
+// which is removed if the download fails or is cancelled.
+func (node StorageNode) DownloadStream(ctx context.Context, cid string, options DownloadStreamOptions) (err error) {
+	op := node.observe(OpDownloadStream, Attrs{AttrCid: cid, AttrLocal: options.Local})
+	defer op.end(&err)
 
 	if options.DatasetSizeAuto {
 		manifest, err := node.DownloadManifest(cid)
@@ -162,109 +183,109 @@ func (node StorageNode) DownloadStream(ctx context.Context, cid string, options
 		options.DatasetSize = manifest.DatasetSize
 	}
 
-	total := 0
-	bridge.onProgress = func(read int, chunk []byte) {
-		if read == 0 {
-			return
-		}
-
-		if options.Writer != nil {
-			w := options.Writer
-			if _, err := w.Write(chunk); err != nil {
-				if options.OnProgress != nil {
-					options.OnProgress(0, 0, 0.0, err)
-				}
-			}
-		}
+	sub, err := newDownloadSubscriber(cid, options)
+	if err != nil {
+		return err
+	}
 
-		total += read
+	node.accesses.Touch(cid)
 
-		if options.OnProgress != nil {
-			var percent = 0.0
-			if options.DatasetSize > 0 {
-				percent = float64(total) / float64(options.DatasetSize) * 100.0
-			}
+	err = node.downloads.stream(ctx, node, sub)
+	op.set(AttrBytes, sub.written())
 
-			options.OnProgress(read, total, percent, nil)
-		}
-	}
+	return sub.close(err)
+}
 
-	var cCid = C.CString(cid)
-	defer C.free(unsafe.Pointer(cCid))
+// DownloadInit initializes the download process for a specific CID.
+// This method should be used if you want to manage the download session
+// and the chunk downloads manually.
+// A manual session is exclusive: it returns ErrDownloadInProgress if
+// another session, manual or streamed, is active for the cid.
+func (node StorageNode) DownloadInit(cid string, options DownloadInitOptions) (err error) {
+	op := node.observe(OpDownloadInit, Attrs{AttrCid: cid, AttrLocal: options.Local})
+	defer op.end(&err)
 
-	err := node.DownloadInit(cid, DownloadInitOptions{
-		ChunkSize: options.ChunkSize,
-		Local:     options.Local,
-	})
+	session, err := node.downloads.reserve(cid)
 	if err != nil {
 		return err
 	}
 
-	defer node.DownloadCancel(cid)
+	if err := node.downloadInit(cid, options.ChunkSize, options.Local); err != nil {
+		node.downloads.finish(session, err)
+		return err
+	}
 
-	var cFilepath = C.CString(options.Filepath)
-	defer C.free(unsafe.Pointer(cFilepath))
+	node.accesses.Touch(cid)
+	return nil
+}
 
-	var cLocal = C.bool(options.Local)
+// DownloadChunk downloads a chunk from its cid.
+// You HAVE TO call `DownloadInit` before using this method.
+// When using this method, you are managing at your own
+// the total size downloaded (use DownloadManifest to get the
+// datasetSize).
+// When the download is complete, you need to call `StorageDownloadCancel`
+// to free the resources.
+func (node StorageNode) DownloadChunk(cid string) (bytes []byte, err error) {
+	op := node.observe(OpDownloadChunk, Attrs{AttrCid: cid})
+	defer func() {
+		op.set(AttrBytes, len(bytes))
+		op.end(&err)
+	}()
 
-	if C.cGoStorageDownloadStream(node.ctx, cCid, options.ChunkSize.toSizeT(), cLocal, cFilepath, bridge.resp) != C.RET_OK {
-		return bridge.callError("cGoStorageDownloadLocal")
+	if node.downloads.streaming(cid) {
+		return nil, ErrDownloadInProgress
 	}
 
-	// Create a done channel to signal the goroutine to stop
-	// when the download is complete and avoid goroutine leaks.
-	done := make(chan struct{})
-	defer close(done)
-
-	channelError := make(chan error, 1)
-	var cancelled atomic.Bool
-	go func() {
-		select {
-		case <-ctx.Done():
-			channelError <- node.DownloadCancel(cid)
-			cancelled.Store(true)
-		case <-done:
-			// Nothing to do, download finished
-		}
-	}()
-
-	_, err = bridge.wait()
+	bridge := newBridgeCtx()
+	defer bridge.free()
 
-	// Extract the potential cancellation error
-	var cancelError error
-	select {
-	case cancelError = <-channelError:
-	default:
+	bridge.onProgress = func(read int, chunk []byte) {
+		bytes = chunk
 	}
 
-	if err != nil {
-		if cancelError != nil {
-			return fmt.Errorf("context canceled: %v, but failed to cancel download session: %v", ctx.Err(), cancelError)
-		}
+	var cCid = C.CString(cid)
+	defer C.free(unsafe.Pointer(cCid))
 
-		if cancelled.Load() {
-			return context.Canceled
-		}
+	if C.cGoStorageDownloadChunk(node.ctx, cCid, bridge.resp) != C.RET_OK {
+		return nil, bridge.callError("cGoStorageDownloadChunk")
+	}
 
-		return err
+	if _, err := bridge.wait(); err != nil {
+		return nil, err
+	}
+
+	// An empty chunk is the end of the download, the cid can
+	// be downloaded again even if DownloadCancel is not called.
+	if len(bytes) == 0 {
+		node.downloads.release(cid)
 	}
 
-	return cancelError
+	return bytes, nil
 }
 
-// DownloadInit initializes the download process for a specific CID.
-// This method should be used if you want to manage the download session
-// and the chunk downloads manually.
-func (node StorageNode) DownloadInit(cid string, options DownloadInitOptions) error {
+// DownloadCancel cancels the download session of a cid.
+// A session managed manually is released. A session used by
+// DownloadStream is stopped, and the DownloadStream calls sharing
+// it return ErrDownloadCancelled.
+func (node StorageNode) DownloadCancel(cid string) (err error) {
+	op := node.observe(OpDownloadCancel, Attrs{AttrCid: cid})
+	defer op.end(&err)
+
+	return node.downloads.cancel(node, cid)
+}
+
+// downloadInit creates the download session in the library.
+func (node StorageNode) downloadInit(cid string, chunkSize ChunkSize, local bool) error {
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
 	var cCid = C.CString(cid)
 	defer C.free(unsafe.Pointer(cCid))
 
-	var cLocal = C.bool(options.Local)
+	var cLocal = C.bool(local)
 
-	if C.cGoStorageDownloadInit(node.ctx, cCid, options.ChunkSize.toSizeT(), cLocal, bridge.resp) != C.RET_OK {
+	if C.cGoStorageDownloadInit(node.ctx, cCid, chunkSize.toSizeT(), cLocal, bridge.resp) != C.RET_OK {
 		return bridge.callError("cGoStorageDownloadInit")
 	}
 
@@ -272,41 +293,40 @@ func (node StorageNode) DownloadInit(cid string, options DownloadInitOptions) er
 	return err
 }
 
-// DownloadChunk downloads a chunk from its cid.
-// You HAVE TO call `DownloadInit` before using this method.
-// When using this method, you are managing at your own
-// the total size downloaded (use DownloadManifest to get the
-// datasetSize).
-// When the download is complete, you need to call `StorageDownloadCancel`
-// to free the resources.
-func (node StorageNode) DownloadChunk(cid string) ([]byte, error) {
+// downloadStream streams the session created by downloadInit,
+// onChunk is called from the library thread for each chunk received.
+func (node StorageNode) downloadStream(cid string, chunkSize ChunkSize, local bool, onChunk func(chunk []byte)) error {
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
-	var bytes []byte
-
 	bridge.onProgress = func(read int, chunk []byte) {
-		bytes = chunk
+		if read == 0 {
+			return
+		}
+
+		onChunk(chunk)
 	}
 
 	var cCid = C.CString(cid)
 	defer C.free(unsafe.Pointer(cCid))
 
-	if C.cGoStorageDownloadChunk(node.ctx, cCid, bridge.resp) != C.RET_OK {
-		return nil, bridge.callError("cGoStorageDownloadChunk")
-	}
+	// The destination files are written on the Go side,
+	// so each caller sharing the session gets its own.
+	var cFilepath = C.CString("")
+	defer C.free(unsafe.Pointer(cFilepath))
 
-	if _, err := bridge.wait(); err != nil {
-		return nil, err
+	var cLocal = C.bool(local)
+
+	if C.cGoStorageDownloadStream(node.ctx, cCid, chunkSize.toSizeT(), cLocal, cFilepath, bridge.resp) != C.RET_OK {
+		return bridge.callError("cGoStorageDownloadLocal")
 	}
 
-	return bytes, nil
+	_, err := bridge.wait()
+	return err
 }
 
-// DownloadCancel cancels a download session.
-// It can be only if the download session is managed manually.
-// It doesn't work with DownloadStream.
-func (node StorageNode) DownloadCancel(cid string) error {
+// downloadCancel cancels the download session in the library.
+func (node StorageNode) downloadCancel(cid string) error {
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -0,0 +1,585 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrDownloadInProgress is returned when a download session cannot be
+// created or managed because another session is active for the same cid.
+var ErrDownloadInProgress = errors.New("a download session is already in progress for this cid")
+
+// ErrDownloadCancelled is returned by DownloadStream when the session
+// it uses is cancelled with DownloadCancel.
+var ErrDownloadCancelled = errors.New("download session cancelled")
+
+const (
+	// downloadFileMode is the mode of the files written by DownloadStream.
+	downloadFileMode = 0644
+
+	// downloadQueueSize is the number of chunks queued for a subscriber
+	// before the session waits for its writer.
+	downloadQueueSize = 16
+)
+
+// downloadMux tracks the download sessions of a node.
+// The library identifies a session by its cid, so the mux makes sure
+// that only one session exists per cid and shares the streamed ones
+// between the callers of DownloadStream.
+//
+// The lock of the mux is never held while taking the lock of a
+// subscriber. The chunks are queued to the subscribers, so a slow writer
+// does not slow down the others until it is downloadQueueSize chunks
+// behind. The session then waits for it, which bounds the memory used.
+type downloadMux struct {
+	mu       sync.Mutex
+	sessions map[string]*downloadSession
+}
+
+// downloadSession is a download session of the library.
+// A manual session is owned by the caller of DownloadInit, a streamed
+// session is owned by its subscribers.
+type downloadSession struct {
+	cid       string
+	manual    bool
+	local     bool
+	chunkSize int
+
+	// joinable is true until the first chunk has been fanned out.
+	joinable bool
+
+	// ending is set when the underlying stream returned,
+	// no cancellation can be started after that.
+	ending bool
+
+	// cancelled is set when DownloadCancel ended the session.
+	cancelled bool
+
+	subscribers map[*downloadSubscriber]struct{}
+
+	// cancels tracks the pending cancellations so the session is not
+	// released before them, otherwise they could cancel the next
+	// session created for the same cid.
+	cancels sync.WaitGroup
+
+	// done is closed when the session is over, err is then the
+	// result of the session.
+	done chan struct{}
+	err  error
+}
+
+// downloadSubscriber is a caller of DownloadStream. The chunks fanned
+// out to it are queued and written by its own goroutine.
+type downloadSubscriber struct {
+	cid     string
+	options DownloadStreamOptions
+
+	// file is a temporary file next to options.Filepath,
+	// renamed to it when the download succeeds.
+	file *os.File
+
+	mu    sync.Mutex
+	queue [][]byte
+	total int
+
+	// space is signalled when a chunk is popped from the queue,
+	// or when the writer goroutine stops.
+	space *sync.Cond
+
+	// detached is set when the subscriber left the session,
+	// it won't write any chunk after that.
+	detached bool
+
+	// err is the first write error.
+	err error
+
+	// ready is signalled when a chunk is queued.
+	ready chan struct{}
+
+	// drained is closed when the writer goroutine returns: all the
+	// chunks of the session are written, or it failed or left.
+	drained chan struct{}
+}
+
+func newDownloadMux() *downloadMux {
+	return &downloadMux{sessions: make(map[string]*downloadSession)}
+}
+
+func newDownloadSubscriber(cid string, options DownloadStreamOptions) (*downloadSubscriber, error) {
+	sub := &downloadSubscriber{
+		cid:     cid,
+		options: options,
+		ready:   make(chan struct{}, 1),
+		drained: make(chan struct{}),
+	}
+	sub.space = sync.NewCond(&sub.mu)
+
+	if options.Filepath != "" {
+		dir, name := filepath.Split(options.Filepath)
+
+		f, err := os.CreateTemp(dir, "."+name+".*.tmp")
+		if err != nil {
+			return nil, err
+		}
+
+		if err := f.Chmod(downloadFileMode); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return nil, err
+		}
+
+		sub.file = f
+	}
+
+	return sub, nil
+}
+
+// push queues a chunk for the writer goroutine. If the queue is full,
+// it waits until the writer pops a chunk, fails or leaves.
+// It is called from the library thread.
+func (sub *downloadSubscriber) push(chunk []byte) {
+	sub.mu.Lock()
+	for len(sub.queue) >= downloadQueueSize && !sub.detached && sub.err == nil {
+		sub.space.Wait()
+	}
+
+	if !sub.detached && sub.err == nil {
+		sub.queue = append(sub.queue, chunk)
+	}
+	sub.mu.Unlock()
+
+	select {
+	case sub.ready <- struct{}{}:
+	default:
+	}
+}
+
+// next pops the next chunk. It returns stop if the subscriber
+// left the session or failed to write.
+func (sub *downloadSubscriber) next() (chunk []byte, ok bool, stop bool) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.detached || sub.err != nil {
+		return nil, false, true
+	}
+
+	if len(sub.queue) == 0 {
+		return nil, false, false
+	}
+
+	chunk = sub.queue[0]
+	sub.queue[0] = nil
+	sub.queue = sub.queue[1:]
+	sub.space.Signal()
+
+	return chunk, true, false
+}
+
+// run writes the queued chunks until the session is done and the
+// queue is empty, or until the subscriber fails or leaves.
+func (sub *downloadSubscriber) run(done <-chan struct{}) {
+	defer close(sub.drained)
+
+	over := false
+	for {
+		chunk, ok, stop := sub.next()
+		if stop {
+			return
+		}
+
+		if ok {
+			sub.deliver(chunk)
+			continue
+		}
+
+		// The session pushes all its chunks before being done
+		if over {
+			return
+		}
+
+		select {
+		case <-sub.ready:
+		case <-done:
+			over = true
+		}
+	}
+}
+
+// deliver writes the chunk to the subscriber destinations and
+// reports the progress. The lock is not held while writing,
+// so the next chunks can be queued meanwhile.
+func (sub *downloadSubscriber) deliver(chunk []byte) {
+	sub.mu.Lock()
+	offset := sub.total
+	sub.mu.Unlock()
+
+	for _, w := range sub.writers() {
+		n, err := w.Write(chunk)
+		if err == nil && n < len(chunk) {
+			err = io.ErrShortWrite
+		}
+
+		if err != nil {
+			sub.mu.Lock()
+			sub.err = fmt.Errorf("failed to write cid %s at offset %d: %w", sub.cid, offset+n, err)
+			sub.space.Broadcast()
+			sub.mu.Unlock()
+
+			if sub.options.OnProgress != nil {
+				sub.options.OnProgress(0, 0, 0.0, sub.writeErr())
+			}
+
+			return
+		}
+	}
+
+	read := len(chunk)
+
+	sub.mu.Lock()
+	sub.total += read
+	total := sub.total
+	sub.mu.Unlock()
+
+	if sub.options.OnProgress != nil {
+		var percent = 0.0
+		if sub.options.DatasetSize > 0 {
+			percent = float64(total) / float64(sub.options.DatasetSize) * 100.0
+		}
+
+		sub.options.OnProgress(read, total, percent, nil)
+	}
+}
+
+func (sub *downloadSubscriber) writers() []io.Writer {
+	var writers []io.Writer
+
+	if sub.file != nil {
+		writers = append(writers, sub.file)
+	}
+
+	if sub.options.Writer != nil {
+		writers = append(writers, sub.options.Writer)
+	}
+
+	return writers
+}
+
+// writeErr returns the write error of the subscriber, if any.
+func (sub *downloadSubscriber) writeErr() error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	return sub.err
+}
+
+// detach stops the writer goroutine after its current write,
+// and releases the session if it waits for the queue.
+func (sub *downloadSubscriber) detach() {
+	sub.mu.Lock()
+	sub.detached = true
+	sub.queue = nil
+	sub.space.Broadcast()
+	sub.mu.Unlock()
+
+	select {
+	case sub.ready <- struct{}{}:
+	default:
+	}
+}
+
+// written returns the number of bytes written.
+func (sub *downloadSubscriber) written() int {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	return sub.total
+}
+
+// close releases the destination file. If the download succeeded,
+// the temporary file is renamed to Filepath, otherwise it is removed
+// so a failed download leaves nothing behind.
+func (sub *downloadSubscriber) close(err error) error {
+	if sub.file == nil {
+		return err
+	}
+
+	closeErr := sub.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(sub.file.Name(), sub.options.Filepath)
+	}
+
+	if err != nil {
+		os.Remove(sub.file.Name())
+	}
+
+	return err
+}
+
+// stream subscribes to the streamed session of the cid, creating it
+// if needed, and waits until the chunks of the session are written
+// or the subscriber leaves it.
+func (m *downloadMux) stream(ctx context.Context, node StorageNode, sub *downloadSubscriber) error {
+	s, err := m.join(ctx, node, sub)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-sub.drained:
+		if err := sub.writeErr(); err != nil {
+			m.leave(node, s, sub)
+			return err
+		}
+
+		// The writer goroutine only returns without
+		// error once the session is done.
+		return s.err
+	case <-ctx.Done():
+		if cancelErr := m.leave(node, s, sub); cancelErr != nil {
+			return fmt.Errorf("context canceled: %v, but failed to cancel download session: %v", ctx.Err(), cancelErr)
+		}
+
+		return context.Canceled
+	}
+}
+
+// join adds the subscriber to a joinable session of the cid, or starts
+// a new one. If the active streamed session cannot be joined, it waits
+// for it to end. A manual session is not waited for, since only its
+// owner can end it: join returns ErrDownloadInProgress.
+func (m *downloadMux) join(ctx context.Context, node StorageNode, sub *downloadSubscriber) (*downloadSession, error) {
+	local := sub.options.Local
+	chunkSize := sub.options.ChunkSize.valOrDefault()
+
+	for {
+		m.mu.Lock()
+
+		s, ok := m.sessions[sub.cid]
+		if !ok {
+			s = &downloadSession{
+				cid:         sub.cid,
+				local:       local,
+				chunkSize:   chunkSize,
+				joinable:    true,
+				subscribers: map[*downloadSubscriber]struct{}{sub: {}},
+				done:        make(chan struct{}),
+			}
+			m.sessions[sub.cid] = s
+			m.mu.Unlock()
+
+			go sub.run(s.done)
+			go m.run(node, s)
+
+			return s, nil
+		}
+
+		if s.manual {
+			m.mu.Unlock()
+			return nil, ErrDownloadInProgress
+		}
+
+		if s.joinable && !s.ending && !s.cancelled && len(s.subscribers) > 0 && s.local == local && s.chunkSize == chunkSize {
+			s.subscribers[sub] = struct{}{}
+			m.mu.Unlock()
+
+			go sub.run(s.done)
+
+			return s, nil
+		}
+
+		done := s.done
+		m.mu.Unlock()
+
+		select {
+		case <-done:
+			// The session is over, try again
+		case <-ctx.Done():
+			return nil, context.Canceled
+		}
+	}
+}
+
+// run drives a streamed session from its creation to its release.
+func (m *downloadMux) run(node StorageNode, s *downloadSession) {
+	err := node.downloadInit(s.cid, ChunkSize(s.chunkSize), s.local)
+	if err != nil {
+		m.mu.Lock()
+		s.ending = true
+		m.mu.Unlock()
+
+		s.cancels.Wait()
+		m.finish(s, err)
+		return
+	}
+
+	err = node.downloadStream(s.cid, ChunkSize(s.chunkSize), s.local, func(chunk []byte) {
+		m.fanOut(s, chunk)
+	})
+
+	m.mu.Lock()
+	s.ending = true
+	m.mu.Unlock()
+
+	s.cancels.Wait()
+
+	// Release the session in the library
+	node.downloadCancel(s.cid)
+
+	m.mu.Lock()
+	cancelled := s.cancelled
+	m.mu.Unlock()
+
+	if cancelled {
+		err = ErrDownloadCancelled
+	}
+
+	m.finish(s, err)
+}
+
+// fanOut queues a chunk to every subscriber of the session. It is called
+// from the library thread, which waits for the subscribers whose queue is full.
+func (m *downloadMux) fanOut(s *downloadSession, chunk []byte) {
+	m.mu.Lock()
+	s.joinable = false
+	subscribers := make([]*downloadSubscriber, 0, len(s.subscribers))
+	for sub := range s.subscribers {
+		subscribers = append(subscribers, sub)
+	}
+	m.mu.Unlock()
+
+	for _, sub := range subscribers {
+		sub.push(chunk)
+	}
+}
+
+// leave detaches the subscriber from the session and waits for its
+// write in progress, so the caller can release its destinations.
+// If it was the last one, the session is cancelled and leave waits
+// for it to end. It returns the cancellation error, if any.
+func (m *downloadMux) leave(node StorageNode, s *downloadSession, sub *downloadSubscriber) error {
+	m.mu.Lock()
+
+	delete(s.subscribers, sub)
+
+	last := len(s.subscribers) == 0 && !s.ending
+	if last {
+		s.cancels.Add(1)
+	}
+
+	m.mu.Unlock()
+
+	// Once detached, the subscriber does not start any write
+	sub.detach()
+
+	if !last {
+		<-sub.drained
+		return nil
+	}
+
+	err := node.downloadCancel(s.cid)
+	s.cancels.Done()
+
+	<-s.done
+	<-sub.drained
+
+	return err
+}
+
+// cancel cancels the session of the cid in the library. A streamed
+// session ends with ErrDownloadCancelled for all its subscribers.
+func (m *downloadMux) cancel(node StorageNode, cid string) error {
+	m.mu.Lock()
+
+	s, ok := m.sessions[cid]
+	if !ok || s.manual {
+		m.mu.Unlock()
+
+		err := node.downloadCancel(cid)
+		if ok {
+			m.finish(s, nil)
+		}
+
+		return err
+	}
+
+	if s.ending {
+		// The session is already over
+		m.mu.Unlock()
+		<-s.done
+		return nil
+	}
+
+	s.cancelled = true
+	s.cancels.Add(1)
+	m.mu.Unlock()
+
+	err := node.downloadCancel(cid)
+	s.cancels.Done()
+
+	<-s.done
+
+	return err
+}
+
+// reserve registers a manual session for the cid.
+func (m *downloadMux) reserve(cid string) (*downloadSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[cid]; ok {
+		return nil, ErrDownloadInProgress
+	}
+
+	s := &downloadSession{
+		cid:    cid,
+		manual: true,
+		done:   make(chan struct{}),
+	}
+	m.sessions[cid] = s
+
+	return s, nil
+}
+
+// release releases the manual session of the cid, if any.
+func (m *downloadMux) release(cid string) {
+	m.mu.Lock()
+	s, ok := m.sessions[cid]
+	m.mu.Unlock()
+
+	if ok && s.manual {
+		m.finish(s, nil)
+	}
+}
+
+// streaming returns true if the cid is used by a streamed session.
+func (m *downloadMux) streaming(cid string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[cid]
+	return ok && !s.manual
+}
+
+// finish removes the session and wakes up its waiters.
+func (m *downloadMux) finish(s *downloadSession, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessions[s.cid] != s {
+		return
+	}
+
+	delete(m.sessions, s.cid)
+	s.err = err
+	close(s.done)
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// blockingWriter blocks every write until unblock is closed.
+type blockingWriter struct {
+	unblock chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.unblock
+	return w.buf.Write(p)
+}
+
+func TestDownloadFanOutSlowSubscriber(t *testing.T) {
+	m := newDownloadMux()
+
+	var fast bytes.Buffer
+	slow := &blockingWriter{unblock: make(chan struct{})}
+
+	fastSub, _ := newDownloadSubscriber("cid", DownloadStreamOptions{Writer: &fast})
+	slowSub, _ := newDownloadSubscriber("cid", DownloadStreamOptions{Writer: slow})
+
+	s := &downloadSession{
+		cid:         "cid",
+		subscribers: map[*downloadSubscriber]struct{}{fastSub: {}, slowSub: {}},
+		done:        make(chan struct{}),
+	}
+	m.sessions["cid"] = s
+
+	go fastSub.run(s.done)
+	go slowSub.run(s.done)
+
+	// The queue of the slow subscriber absorbs the first chunks
+	for range downloadQueueSize {
+		m.fanOut(s, []byte("0123456789"))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for fastSub.written() != downloadQueueSize*10 {
+		if time.Now().After(deadline) {
+			t.Fatal("the fast subscriber was blocked by the slow one")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Then the session waits for the slow subscriber
+	fanned := make(chan struct{})
+	go func() {
+		m.fanOut(s, []byte("0123456789"))
+		m.fanOut(s, []byte("0123456789"))
+		close(fanned)
+	}()
+
+	select {
+	case <-fanned:
+		t.Fatal("expected the session to wait for the full queue")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	left := make(chan struct{})
+	go func() {
+		m.leave(StorageNode{}, s, slowSub)
+		close(left)
+	}()
+
+	select {
+	case <-fanned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("leaving did not release the session")
+	}
+
+	// Leaving waits for the write in progress
+	select {
+	case <-left:
+		t.Fatal("leave returned during a write")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(slow.unblock)
+
+	select {
+	case <-left:
+	case <-time.After(5 * time.Second):
+		t.Fatal("leave did not return after the write")
+	}
+
+	m.finish(s, nil)
+	<-fastSub.drained
+
+	if fast.Len() != (downloadQueueSize+2)*10 {
+		t.Fatalf("expected %d bytes, got %d", (downloadQueueSize+2)*10, fast.Len())
+	}
+
+	if slow.buf.Len() != 10 {
+		t.Fatalf("expected the detached subscriber to stop writing, got %d bytes", slow.buf.Len())
+	}
+}
+
+func TestDownloadSubscriberWriteError(t *testing.T) {
+	w := &failingWriter{limit: 15}
+	sub, _ := newDownloadSubscriber("cid", DownloadStreamOptions{Writer: w})
+
+	done := make(chan struct{})
+	go sub.run(done)
+
+	sub.push([]byte("0123456789"))
+	sub.push([]byte("0123456789"))
+	sub.push([]byte("0123456789"))
+
+	<-sub.drained
+
+	err := sub.writeErr()
+	if !errors.Is(err, errWriterFull) {
+		t.Fatalf("expected errWriterFull, got %v", err)
+	}
+
+	if sub.written() != 10 {
+		t.Fatalf("expected 10 bytes written, got %d", sub.written())
+	}
+}
+
+func TestDownloadJoinManualSession(t *testing.T) {
+	m := newDownloadMux()
+
+	if _, err := m.reserve("cid"); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, _ := newDownloadSubscriber("cid", DownloadStreamOptions{})
+
+	// The manual session is not waited for, only its owner can end it
+	_, err := m.join(context.Background(), StorageNode{}, sub)
+	if !errors.Is(err, ErrDownloadInProgress) {
+		t.Fatalf("expected ErrDownloadInProgress, got %v", err)
+	}
+
+	m.release("cid")
+
+	if m.streaming("cid") {
+		t.Fatal("expected the cid to be free")
+	}
+
+	if _, err := m.reserve("cid"); err != nil {
+		t.Fatalf("expected the released cid to be reserved again, got %v", err)
+	}
+}
+
+func TestDownloadSubscriberFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hello.txt")
+
+	sub, err := newDownloadSubscriber("cid", DownloadStreamOptions{Filepath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub.deliver([]byte("Hello World!"))
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no file before the end of the download, got %v", err)
+	}
+
+	if err := sub.close(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "Hello World!" {
+		t.Fatalf("unexpected file %q: %v", data, err)
+	}
+
+	failed, err := newDownloadSubscriber("cid", DownloadStreamOptions{Filepath: filepath.Join(dir, "failed.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed.deliver([]byte("Hello"))
+
+	if err := failed.close(context.Canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the download error, got %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "hello.txt" {
+		t.Fatalf("expected only hello.txt to be left, got %v", entries)
+	}
+}
@@ -1,10 +1,16 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestDownloadStream(t *testing.T) {
@@ -119,6 +125,133 @@ func TestDownloadStreamCancelled(t *testing.T) {
 	}
 }
 
+type failingWriter struct {
+	written int
+	limit   int
+}
+
+var errWriterFull = errors.New("writer is full")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.written+len(p) > w.limit {
+		return 0, errWriterFull
+	}
+
+	w.written += len(p)
+	return len(p), nil
+}
+
+func TestDownloadStreamWriterError(t *testing.T) {
+	storage := newStorageNode(t)
+	cid, _ := uploadBigFileHelper(t, storage)
+
+	w := &failingWriter{limit: 1024 * 1024}
+	err := storage.DownloadStream(context.Background(), cid, DownloadStreamOptions{Writer: w, Local: true})
+	if err == nil {
+		t.Fatal("DownloadStream should have failed when the writer fails")
+	}
+
+	if !errors.Is(err, errWriterFull) {
+		t.Fatalf("DownloadStream returned unexpected error: %v", err)
+	}
+
+	if !strings.Contains(err.Error(), cid) {
+		t.Fatalf("DownloadStream error should contain the cid: %v", err)
+	}
+
+	if !strings.Contains(err.Error(), fmt.Sprintf("offset %d", w.written)) {
+		t.Fatalf("DownloadStream error should contain the offset %d: %v", w.written, err)
+	}
+}
+
+func TestDownloadStreamConcurrent(t *testing.T) {
+	storage := newStorageNode(t)
+	cid, len := uploadBigFileHelper(t, storage)
+
+	var buffers [3]bytes.Buffer
+	channelError := make(chan error, 3)
+	for i := range buffers {
+		go func() {
+			channelError <- storage.DownloadStream(context.Background(), cid, DownloadStreamOptions{Writer: &buffers[i], Local: true})
+		}()
+	}
+
+	for range buffers {
+		if err := <-channelError; err != nil {
+			t.Fatal("Error happened:", err.Error())
+		}
+	}
+
+	for i := range buffers {
+		if buffers[i].Len() != len {
+			t.Fatalf("Download %d received %d bytes but expected %d", i, buffers[i].Len(), len)
+		}
+	}
+}
+
+func TestDownloadStreamConcurrentCancelled(t *testing.T) {
+	storage := newStorageNode(t)
+	cid, len := uploadBigFileHelper(t, storage)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var buf bytes.Buffer
+	channelError := make(chan error, 2)
+	go func() {
+		channelError <- storage.DownloadStream(ctx, cid, DownloadStreamOptions{Local: true})
+	}()
+	go func() {
+		channelError <- storage.DownloadStream(context.Background(), cid, DownloadStreamOptions{Writer: &buf, Local: true})
+	}()
+
+	cancel()
+
+	canceled := 0
+	for range 2 {
+		err := <-channelError
+		if err != nil && err.Error() != context.Canceled.Error() {
+			t.Fatalf("DownloadStream returned unexpected error: %v", err)
+		}
+
+		if err != nil {
+			canceled++
+		}
+	}
+
+	if canceled > 1 {
+		t.Fatal("Only one download should have been canceled")
+	}
+
+	if buf.Len() != len {
+		t.Fatalf("Download received %d bytes but expected %d", buf.Len(), len)
+	}
+}
+
+func TestDownloadInitInProgress(t *testing.T) {
+	storage := newStorageNode(t)
+	cid, _ := uploadHelper(t, storage)
+
+	if err := storage.DownloadInit(cid, DownloadInitOptions{}); err != nil {
+		t.Fatal("Error when initializing download:", err)
+	}
+
+	if err := storage.DownloadInit(cid, DownloadInitOptions{}); !errors.Is(err, ErrDownloadInProgress) {
+		t.Fatalf("expected ErrDownloadInProgress got %v", err)
+	}
+
+	if err := storage.DownloadCancel(cid); err != nil {
+		t.Fatalf("Error when cancelling the download %s", err)
+	}
+
+	if err := storage.DownloadInit(cid, DownloadInitOptions{}); err != nil {
+		t.Fatal("Error when initializing download after cancel:", err)
+	}
+
+	if err := storage.DownloadCancel(cid); err != nil {
+		t.Fatalf("Error when cancelling the download %s", err)
+	}
+}
+
 func TestDownloadManual(t *testing.T) {
 	storage := newStorageNode(t)
 	cid, _ := uploadHelper(t, storage)
@@ -178,3 +311,70 @@ func TestDownloadInitWithNotExistingCid(t *testing.T) {
 		t.Fatal("expected error when initializing download for non-existent cid")
 	}
 }
+
+func TestDownloadStreamDuringManualSession(t *testing.T) {
+	storage := newStorageNode(t)
+	cid, _ := uploadHelper(t, storage)
+
+	if err := storage.DownloadInit(cid, DownloadInitOptions{}); err != nil {
+		t.Fatal("Error when initializing download:", err)
+	}
+
+	err := storage.DownloadStream(context.Background(), cid, DownloadStreamOptions{Local: true})
+	if !errors.Is(err, ErrDownloadInProgress) {
+		t.Fatalf("expected ErrDownloadInProgress got %v", err)
+	}
+
+	if err := storage.DownloadCancel(cid); err != nil {
+		t.Fatalf("Error when cancelling the download %s", err)
+	}
+
+	if err := storage.DownloadStream(context.Background(), cid, DownloadStreamOptions{Local: true}); err != nil {
+		t.Fatal("Error when streaming after cancel:", err)
+	}
+}
+
+func TestDownloadCancelStream(t *testing.T) {
+	storage := newStorageNode(t)
+	cid, _ := uploadBigFileHelper(t, storage)
+
+	started := make(chan struct{})
+	var once sync.Once
+
+	channelError := make(chan error, 1)
+	go func() {
+		channelError <- storage.DownloadStream(context.Background(), cid, DownloadStreamOptions{
+			Local: true,
+			OnProgress: func(read, total int, percent float64, err error) {
+				once.Do(func() { close(started) })
+				time.Sleep(10 * time.Millisecond)
+			},
+		})
+	}()
+
+	<-started
+
+	if err := storage.DownloadCancel(cid); err != nil {
+		t.Fatalf("Error when cancelling the download %s", err)
+	}
+
+	if err := <-channelError; !errors.Is(err, ErrDownloadCancelled) {
+		t.Fatalf("expected ErrDownloadCancelled got %v", err)
+	}
+}
+
+func TestDownloadStreamFileNotCreatedOnError(t *testing.T) {
+	storage := newStorageNode(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "missing.txt")
+
+	opt := DownloadStreamOptions{Filepath: path}
+	if err := storage.DownloadStream(context.Background(), "bafybeihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", opt); err == nil {
+		t.Fatal("Error expected when downloading non-existing cid")
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected no file after a failed download, got %v", entries)
+	}
+}
@@ -0,0 +1,375 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const defaultHealthTimeout = 5 * time.Second
+
+type HealthStatus string
+
+const (
+	HealthOK     HealthStatus = "ok"
+	HealthFailed HealthStatus = "failed"
+
+	// HealthSkipped means that the check could not run,
+	// like the peers of a node that is not started.
+	HealthSkipped HealthStatus = "skipped"
+)
+
+// The names of the checks of the HealthReport.
+const (
+	// HealthState checks that the node is started.
+	HealthState = "state"
+
+	// HealthBridge checks that the library answers a Debug call
+	// before the timeout.
+	HealthBridge = "bridge"
+
+	// HealthPeers checks the number of connected peers, read from
+	// the libp2p_peers metric. It is skipped when MinPeers is set
+	// and the metrics are disabled.
+	HealthPeers = "peers"
+
+	// HealthQuota checks the free space of the quota.
+	HealthQuota = "quota"
+
+	// HealthAddresses checks that the node has listen
+	// and announce addresses.
+	HealthAddresses = "addresses"
+)
+
+// HealthCheck is the result of a check.
+type HealthCheck struct {
+	Name    string        `json:"name"`
+	Status  HealthStatus  `json:"status"`
+	Message string        `json:"message,omitempty"`
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// HealthReport is the result of Health.
+type HealthReport struct {
+	Time   time.Time     `json:"time"`
+	State  NodeState     `json:"state"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// Check returns the check with the name.
+func (r HealthReport) Check(name string) (HealthCheck, bool) {
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return HealthCheck{}, false
+}
+
+// Healthy returns true if none of the named checks failed or was
+// skipped. Without names, all the checks are considered.
+func (r HealthReport) Healthy(names ...string) bool {
+	for _, c := range r.Checks {
+		if len(names) > 0 && !slices.Contains(names, c.Name) {
+			continue
+		}
+
+		if c.Status != HealthOK {
+			return false
+		}
+	}
+	return true
+}
+
+type HealthOptions struct {
+	// Timeout is the maximum duration of the calls to the library.
+	// Default: 5 seconds
+	Timeout time.Duration
+
+	// MinPeers is the minimum number of connected peers.
+	// It needs MetricsEnabled in the config of the node.
+	// Default: 0
+	MinPeers int
+
+	// MinFreeBytes is the minimum free space of the quota, not used
+	// nor reserved.
+	// Default: 0
+	MinFreeBytes int64
+}
+
+// Health runs the health checks of the node. The checks using the
+// library are skipped when the node is not started, or when the
+// bridge does not answer.
+//
+// The calls to the library cannot be interrupted, so only one probe
+// runs at a time: the concurrent checks share its result, and while
+// it does not answer the bridge check fails without a new call.
+func (node StorageNode) Health(ctx context.Context, options HealthOptions) HealthReport {
+	if options.Timeout <= 0 {
+		options.Timeout = defaultHealthTimeout
+	}
+
+	report := HealthReport{Time: time.Now(), State: node.State()}
+
+	add := func(name string, start time.Time, status HealthStatus, format string, args ...any) {
+		report.Checks = append(report.Checks, HealthCheck{
+			Name:    name,
+			Status:  status,
+			Message: fmt.Sprintf(format, args...),
+			Elapsed: time.Since(start),
+		})
+	}
+
+	skip := func(reason string, names ...string) {
+		for _, name := range names {
+			add(name, time.Now(), HealthSkipped, "%s", reason)
+		}
+	}
+
+	if report.State != NodeStarted {
+		add(HealthState, report.Time, HealthFailed, "node is %s", report.State)
+		skip("node is not started", HealthBridge, HealthPeers, HealthQuota, HealthAddresses)
+		return report
+	}
+	add(HealthState, report.Time, HealthOK, "")
+
+	start := time.Now()
+	probe, err := node.health.wait(ctx, options.Timeout, func() healthResult {
+		return node.probeHealth(options.Timeout)
+	})
+	if err == nil {
+		err = probe.infoErr
+	}
+
+	if err != nil {
+		add(HealthBridge, start, HealthFailed, "%v", err)
+		skip("bridge is not responsive", HealthPeers, HealthQuota, HealthAddresses)
+		return report
+	}
+	add(HealthBridge, start, HealthOK, "")
+
+	info := probe.info
+
+	start = time.Now()
+	switch {
+	case errors.Is(probe.peersErr, ErrMetricsDisabled) && options.MinPeers > 0:
+		add(HealthPeers, start, HealthSkipped, "%v", probe.peersErr)
+	case errors.Is(probe.peersErr, ErrMetricsDisabled):
+		add(HealthPeers, start, HealthOK, "")
+	case probe.peersErr != nil:
+		add(HealthPeers, start, HealthFailed, "%v", probe.peersErr)
+	case probe.peers < options.MinPeers:
+		add(HealthPeers, start, HealthFailed, "%d connected peers, expected at least %d", probe.peers, options.MinPeers)
+	default:
+		add(HealthPeers, start, HealthOK, "%d connected peers", probe.peers)
+	}
+
+	start = time.Now()
+	if probe.spaceErr != nil {
+		add(HealthQuota, start, HealthFailed, "%v", probe.spaceErr)
+	} else {
+		space := probe.space
+		free := space.QuotaMaxBytes - space.QuotaUsedBytes - space.QuotaReservedBytes
+		if free < options.MinFreeBytes {
+			add(HealthQuota, start, HealthFailed, "%d bytes free, expected at least %d", free, options.MinFreeBytes)
+		} else {
+			add(HealthQuota, start, HealthOK, "%d bytes free", free)
+		}
+	}
+
+	start = time.Now()
+	switch {
+	case len(info.Addrs) == 0:
+		add(HealthAddresses, start, HealthFailed, "no listen address")
+	case len(info.AnnounceAddresses) == 0:
+		add(HealthAddresses, start, HealthFailed, "no announce address")
+	default:
+		add(HealthAddresses, start, HealthOK, "")
+	}
+
+	return report
+}
+
+// healthResult is the result of the library calls of a health probe.
+type healthResult struct {
+	info     DebugInfo
+	infoErr  error
+	space    Space
+	spaceErr error
+	peers    int
+	peersErr error
+}
+
+func (node StorageNode) probeHealth(timeout time.Duration) healthResult {
+	var r healthResult
+
+	r.info, r.infoErr = node.Debug()
+	if r.infoErr != nil {
+		return r
+	}
+
+	r.space, r.spaceErr = node.Space()
+	r.peers, r.peersErr = node.connectedPeers(timeout)
+
+	return r
+}
+
+// connectedPeers returns the number of connected peers from the
+// libp2p_peers metric, Debug only has the routing table.
+func (node StorageNode) connectedPeers(timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	metrics, err := node.Metrics(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	peers, ok := metrics.Peers()
+	if !ok {
+		return 0, errors.New("no libp2p_peers metric")
+	}
+
+	return int(peers), nil
+}
+
+// healthProbe runs one health probe at a time, shared by the
+// copies of the node.
+type healthProbe struct {
+	mu      sync.Mutex
+	done    chan struct{}
+	started time.Time
+	result  healthResult
+}
+
+func newHealthProbe() *healthProbe {
+	return &healthProbe{}
+}
+
+// wait returns the result of the probe in flight, or of a new one,
+// if it ends before the timeout counted from its start.
+func (p *healthProbe) wait(ctx context.Context, timeout time.Duration, probe func() healthResult) (healthResult, error) {
+	p.mu.Lock()
+	if p.done == nil {
+		done := make(chan struct{})
+		p.done, p.started = done, time.Now()
+
+		go func() {
+			result := probe()
+
+			p.mu.Lock()
+			p.result, p.done = result, nil
+			p.mu.Unlock()
+
+			close(done)
+		}()
+	}
+	done, started := p.done, p.started
+	p.mu.Unlock()
+
+	remaining := timeout - time.Since(started)
+	if remaining <= 0 {
+		return healthResult{}, fmt.Errorf("no answer from the library for %v", time.Since(started).Round(time.Millisecond))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, remaining)
+	defer cancel()
+
+	select {
+	case <-done:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.result, nil
+	case <-ctx.Done():
+		return healthResult{}, ctx.Err()
+	}
+}
+
+// callWithTimeout waits for a call to the library at most the timeout.
+// The call cannot be interrupted, so it keeps running in the
+// background after the timeout.
+func callWithTimeout[T any](ctx context.Context, timeout time.Duration, fn func() (T, error)) (T, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		v   T
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		v, err := fn()
+		done <- result{v, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+type HealthHandlerOptions struct {
+	Health HealthOptions
+
+	// Liveness are the checks of /livez. A skipped check does not
+	// fail the liveness, so a node that is starting or stopped is
+	// not restarted.
+	// Default: bridge
+	Liveness []string
+
+	// Readiness are the checks of /readyz.
+	// Default: all the checks
+	Readiness []string
+}
+
+// HealthHandler returns a handler serving /livez and /readyz for the
+// probes of an orchestrator. They answer the JSON HealthReport, with
+// the status 200 if the selected checks pass and 503 otherwise.
+func HealthHandler(node *StorageNode, options HealthHandlerOptions) http.Handler {
+	if len(options.Liveness) == 0 {
+		options.Liveness = []string{HealthBridge}
+	}
+
+	probe := func(names []string, live bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			report := node.Health(r.Context(), options.Health)
+
+			if len(names) > 0 {
+				report.Checks = slices.DeleteFunc(report.Checks, func(c HealthCheck) bool {
+					return !slices.Contains(names, c.Name)
+				})
+			}
+
+			healthy := report.Healthy()
+			if live {
+				healthy = !slices.ContainsFunc(report.Checks, func(c HealthCheck) bool {
+					return c.Status == HealthFailed
+				})
+			}
+
+			status := http.StatusOK
+			if !healthy {
+				status = http.StatusServiceUnavailable
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(report)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /livez", probe(options.Liveness, true))
+	mux.Handle("GET /readyz", probe(options.Readiness, false))
+
+	return mux
+}
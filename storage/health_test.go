@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthNotStarted(t *testing.T) {
+	node := StorageNode{state: &atomic.Int32{}}
+	node.state.Store(int32(NodeStopped))
+
+	report := node.Health(context.Background(), HealthOptions{})
+
+	if c, _ := report.Check(HealthState); c.Status != HealthFailed || c.Message != "node is stopped" {
+		t.Fatalf("unexpected state check %+v", c)
+	}
+
+	if c, _ := report.Check(HealthQuota); c.Status != HealthSkipped {
+		t.Fatalf("expected the quota check to be skipped, got %+v", c)
+	}
+
+	if report.Healthy() || report.Healthy(HealthBridge) {
+		t.Fatal("expected the report to be unhealthy")
+	}
+
+	server := httptest.NewServer(HealthHandler(&node, HealthHandlerOptions{}))
+	defer server.Close()
+
+	// A stopped node is alive but not ready
+	for path, status := range map[string]int{"/livez": http.StatusOK, "/readyz": http.StatusServiceUnavailable} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != status {
+			t.Fatalf("expected %d for %s, got %d", status, path, resp.StatusCode)
+		}
+
+		if path != "/livez" {
+			continue
+		}
+
+		var body struct {
+			State  string        `json:"state"`
+			Checks []HealthCheck `json:"checks"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if body.State != "stopped" || len(body.Checks) != 1 || body.Checks[0].Name != HealthBridge {
+			t.Fatalf("expected the liveness checks of a stopped node, got %+v", body)
+		}
+	}
+}
+
+func TestHealthConnectedPeers(t *testing.T) {
+	for metrics, expected := range map[string]int{
+		testMetrics: 3,
+		strings.ReplaceAll(testMetrics, "libp2p_peers", "other_peers"): -1,
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(metrics))
+		}))
+		defer server.Close()
+
+		host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+		p, _ := strconv.Atoi(port)
+
+		node := StorageNode{config: Config{MetricsEnabled: true, MetricsAddress: host, MetricsPort: p}}
+
+		peers, err := node.connectedPeers(time.Second)
+		if expected < 0 && err == nil {
+			t.Fatalf("expected an error without the libp2p_peers metric, got %d", peers)
+		}
+		if expected >= 0 && (err != nil || peers != expected) {
+			t.Fatalf("expected %d connected peers, got %d %v", expected, peers, err)
+		}
+
+		node.config.MetricsEnabled = false
+		if _, err := node.connectedPeers(time.Second); !errors.Is(err, ErrMetricsDisabled) {
+			t.Fatalf("expected ErrMetricsDisabled, got %v", err)
+		}
+	}
+}
+
+func TestHealthProbeInFlight(t *testing.T) {
+	p := newHealthProbe()
+
+	var calls atomic.Int32
+	unblock := make(chan struct{})
+	blocked := func() healthResult {
+		calls.Add(1)
+		<-unblock
+		return healthResult{info: DebugInfo{ID: "blocked"}}
+	}
+
+	// The concurrent checks share the probe in flight
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := p.wait(context.Background(), 50*time.Millisecond, blocked)
+			errs <- err
+		}()
+	}
+
+	for range 2 {
+		if err := <-errs; !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a timeout, got %v", err)
+		}
+	}
+
+	// The hung probe fails at once, without a new call
+	start := time.Now()
+	if _, err := p.wait(context.Background(), 50*time.Millisecond, blocked); err == nil || time.Since(start) > 40*time.Millisecond {
+		t.Fatalf("expected an immediate error, got %v after %v", err, time.Since(start))
+	}
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected one probe in flight, got %d", n)
+	}
+
+	close(unblock)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r, err := p.wait(context.Background(), time.Second, func() healthResult {
+			return healthResult{info: DebugInfo{ID: "next"}}
+		})
+		if err == nil && r.info.ID == "next" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a new probe after the hung one, got %+v %v", r, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCallWithTimeout(t *testing.T) {
+	slow := func() (int, error) {
+		time.Sleep(time.Second)
+		return 1, nil
+	}
+
+	if _, err := callWithTimeout(context.Background(), 10*time.Millisecond, slow); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+
+	fast := func() (int, error) { return 2, nil }
+	if v, err := callWithTimeout(context.Background(), time.Second, fast); err != nil || v != 2 {
+		t.Fatalf("unexpected result %d %v", v, err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	node := newStorageNode(t, Config{MetricsEnabled: true})
+
+	report := node.Health(context.Background(), HealthOptions{MinPeers: 1000})
+
+	if !report.Healthy(HealthState, HealthBridge, HealthQuota, HealthAddresses) {
+		t.Fatalf("expected the node to be healthy, got %+v", report)
+	}
+
+	if c, _ := report.Check(HealthPeers); c.Status != HealthFailed {
+		t.Fatalf("expected the peers check to fail, got %+v", c)
+	}
+
+	server := httptest.NewServer(HealthHandler(node, HealthHandlerOptions{Health: HealthOptions{MinPeers: 1000}}))
+	defer server.Close()
+
+	for path, status := range map[string]int{"/livez": http.StatusOK, "/readyz": http.StatusServiceUnavailable} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != status {
+			t.Fatalf("expected %d for %s, got %d", status, path, resp.StatusCode)
+		}
+	}
+}
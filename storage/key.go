@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+)
+
+// ErrKeyExists is returned when a key file would be overwritten.
+var ErrKeyExists = errors.New("key file already exists")
+
+const (
+	// The library refuses the key files readable by others,
+	// and the data dirs accessible by others.
+	keyFileMode = 0600
+	dataDirMode = 0700
+
+	secpPrivateKeySize = 32
+)
+
+// PrivateKey is a secp256k1 network key, the identity of a node.
+type PrivateKey struct {
+	d *big.Int
+}
+
+// GenerateKey generates a random secp256k1 key.
+func GenerateKey() (PrivateKey, error) {
+	return generateKey(rand.Reader)
+}
+
+func generateKey(r io.Reader) (PrivateKey, error) {
+	b := make([]byte, secpPrivateKeySize)
+
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return PrivateKey{}, err
+		}
+
+		// Retry in the unlikely case the bytes are not in [1, N)
+		d := new(big.Int).SetBytes(b)
+		if d.Sign() > 0 && d.Cmp(secpN) < 0 {
+			return PrivateKey{d}, nil
+		}
+	}
+}
+
+// ParsePrivateKey decodes a key in the format of the key files: a
+// protobuf encoded libp2p private key. Only secp256k1 keys are supported.
+func ParsePrivateKey(data []byte) (PrivateKey, error) {
+	keyType, raw, err := decodeKey(data)
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	if keyType != KeySecp256k1 {
+		return PrivateKey{}, fmt.Errorf("unsupported %s private key", keyType)
+	}
+
+	if len(raw) != secpPrivateKeySize {
+		return PrivateKey{}, fmt.Errorf("invalid secp256k1 private key length %d", len(raw))
+	}
+
+	d := new(big.Int).SetBytes(raw)
+	if d.Sign() == 0 || d.Cmp(secpN) >= 0 {
+		return PrivateKey{}, errors.New("invalid secp256k1 private key")
+	}
+
+	return PrivateKey{d}, nil
+}
+
+// Marshal encodes the key in the format of the key files.
+func (k PrivateKey) Marshal() []byte {
+	raw := make([]byte, secpPrivateKeySize)
+	k.d.FillBytes(raw)
+
+	b := appendProtoVarint(nil, 1, uint64(KeySecp256k1))
+	return appendProtoBytes(b, 2, raw)
+}
+
+// PublicKey returns the 33 bytes compressed public key.
+func (k PrivateKey) PublicKey() []byte {
+	d := make([]byte, secpPrivateKeySize)
+	k.d.FillBytes(d)
+
+	return secpCompress(secpScalarBaseMult(d))
+}
+
+// PeerID returns the peer id of the node using the key.
+func (k PrivateKey) PeerID() PeerID {
+	pub := appendProtoVarint(nil, 1, uint64(KeySecp256k1))
+	pub = appendProtoBytes(pub, 2, k.PublicKey())
+
+	return peerIDFromPublicKey(pub)
+}
+
+// String does not print the key.
+func (k PrivateKey) String() string {
+	return "secp256k1 private key of " + k.PeerID().String()
+}
+
+// LoadKeyFile reads a key file, like the one created by the node.
+func LoadKeyFile(path string) (PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return key, nil
+}
+
+// WriteKeyFile writes the key readable only by its owner.
+// It never overwrites an existing file and returns ErrKeyExists.
+func WriteKeyFile(path string, key PrivateKey) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, keyFileMode)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s: %w", path, ErrKeyExists)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(key.Marshal()); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+
+	return f.Close()
+}
+
+// GenerateKeyFile generates a key and writes it, see WriteKeyFile.
+func GenerateKeyFile(path string) (PrivateKey, error) {
+	key, err := GenerateKey()
+	if err != nil {
+		return PrivateKey{}, err
+	}
+
+	return key, WriteKeyFile(path, key)
+}
+
+// ImportKey writes the key where the node created with the config
+// will load it: NetPrivKeyFile, relative to the data dir. The data dir
+// is created if needed, and restricted to its owner like the library
+// expects. It returns ErrKeyExists if the node already has a key.
+func ImportKey(config Config, key PrivateKey) error {
+	if config.DataDir == "" {
+		return errors.New("missing data dir")
+	}
+
+	if err := os.MkdirAll(config.DataDir, dataDirMode); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(config.DataDir, dataDirMode); err != nil {
+		return err
+	}
+
+	return WriteKeyFile(config.keyPath(), key)
+}
+
+// PeerIDFromConfig derives the peer id of the node created with
+// the config from its key file, without starting it.
+func PeerIDFromConfig(config Config) (PeerID, error) {
+	key, err := LoadKeyFile(config.keyPath())
+	if err != nil {
+		return "", err
+	}
+
+	return key.PeerID(), nil
+}
+
+// keyPath returns the path of the network key file.
+func (c Config) keyPath() string {
+	path := c.NetPrivKeyFile
+	if path == "" {
+		path = defaultNetPrivKeyFile
+	}
+
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(c.DataDir, path)
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrivateKey(t *testing.T) {
+	one := make([]byte, 32)
+	one[31] = 1
+
+	key, err := generateKey(bytes.NewReader(append(make([]byte, 32), one...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The public key of 1 is the generator
+	if pub := hex.EncodeToString(key.PublicKey()); pub != "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" {
+		t.Fatalf("unexpected public key %s", pub)
+	}
+
+	if err := key.PeerID().Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParsePrivateKey(key.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.PeerID() != key.PeerID() {
+		t.Fatal("expected the parsed key to have the same peer id")
+	}
+
+	if _, err := ParsePrivateKey(append([]byte{0x08, 0x01, 0x12, 0x20}, one...)); err == nil {
+		t.Fatal("expected an ed25519 key to be unsupported")
+	}
+
+	if _, err := ParsePrivateKey([]byte{0x08, 0x02, 0x12, 0x01, 0x01}); err == nil {
+		t.Fatal("expected an error for a short key")
+	}
+}
+
+func TestSecpScalarBaseMult(t *testing.T) {
+	scalars := []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3), new(big.Int).Sub(secpN, big.NewInt(1))}
+	for seed := range 20 {
+		sum := sha256.Sum256([]byte{byte(seed)})
+		scalars = append(scalars, new(big.Int).Mod(new(big.Int).SetBytes(sum[:]), secpN))
+	}
+
+	for _, k := range scalars {
+		b := make([]byte, 32)
+		k.FillBytes(b)
+
+		got, expected := secpScalarBaseMult(b), secpMul(k, secpG())
+		if got.x.Cmp(expected.x) != 0 || got.y.Cmp(expected.y) != 0 {
+			t.Fatalf("unexpected point for %x", k)
+		}
+	}
+}
+
+func TestSecpFe(t *testing.T) {
+	values := []*big.Int{big.NewInt(0), big.NewInt(1), new(big.Int).Sub(secpP, big.NewInt(1)), new(big.Int).Sub(secpP, big.NewInt(secpC))}
+	for seed := range 20 {
+		sum := sha256.Sum256([]byte{byte(seed)})
+		values = append(values, new(big.Int).Mod(new(big.Int).SetBytes(sum[:]), secpP))
+	}
+
+	mod := func(x *big.Int) *big.Int { return x.Mod(x, secpP) }
+
+	for _, a := range values {
+		for _, b := range values {
+			fa, fb := secpFeFromBig(a), secpFeFromBig(b)
+
+			if got := fa.add(fb).big(); got.Cmp(mod(new(big.Int).Add(a, b))) != 0 {
+				t.Fatalf("%x + %x: unexpected %x", a, b, got)
+			}
+
+			if got := fa.sub(fb).big(); got.Cmp(mod(new(big.Int).Sub(a, b))) != 0 {
+				t.Fatalf("%x - %x: unexpected %x", a, b, got)
+			}
+
+			if got := fa.mul(fb).big(); got.Cmp(mod(new(big.Int).Mul(a, b))) != 0 {
+				t.Fatalf("%x * %x: unexpected %x", a, b, got)
+			}
+		}
+
+		if a.Sign() != 0 {
+			if got := secpFeFromBig(a).inv().big(); got.Cmp(new(big.Int).ModInverse(a, secpP)) != 0 {
+				t.Fatalf("1 / %x: unexpected %x", a, got)
+			}
+		}
+	}
+}
+
+func TestImportKey(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{DataDir: dir}
+	if err := ImportKey(config, key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ImportKey(config, key); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+
+	for path, mode := range map[string]os.FileMode{dir: 0700, filepath.Join(dir, "key"): 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != mode {
+			t.Fatalf("expected %s to have mode %v, got %v", path, mode, info.Mode().Perm())
+		}
+	}
+
+	peerId, err := PeerIDFromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if peerId != key.PeerID() {
+		t.Fatalf("expected %s, got %s", key.PeerID(), peerId)
+	}
+}
+
+func TestImportKeyPeerId(t *testing.T) {
+	dir := t.TempDir()
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ImportKey(Config{DataDir: dir}, key); err != nil {
+		t.Fatal(err)
+	}
+
+	node := newStorageNode(t, Config{DataDir: dir})
+
+	peerId, err := node.PeerId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if peerId != key.PeerID().String() {
+		t.Fatalf("expected the node to use the imported key %s, got %s", key.PeerID(), peerId)
+	}
+}
+
+func TestGeneratedKeyFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// Let the node generate its key
+	node := newStorageNode(t, Config{DataDir: dir})
+
+	peerId, err := node.PeerId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := LoadKeyFile(filepath.Join(dir, "key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if peerId != key.PeerID().String() {
+		t.Fatalf("expected the peer id %s derived from the key file, got %s", key.PeerID(), peerId)
+	}
+}
@@ -0,0 +1,463 @@
+package storage
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrMetricsDisabled is returned by Metrics when MetricsEnabled is not set.
+var ErrMetricsDisabled = errors.New("metrics are disabled")
+
+// MetricsPortFree is the MetricsPort that makes New pick a free port,
+// like for tests running several nodes. See MetricsURL for the port used.
+//
+// The library does not report the port it binds, so New looks for a port
+// that is free at that time and the node binds it when it starts. Another
+// process can take the port in between, then Start fails and the node
+// must be created again.
+const MetricsPortFree = -1
+
+const (
+	defaultMetricsAddress = "127.0.0.1"
+	defaultMetricsPort    = 8008
+)
+
+// freeMetricsPort returns a free TCP port on the metrics address,
+// used when MetricsPort is MetricsPortFree.
+func freeMetricsPort(address string) (int, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(cmp.Or(address, defaultMetricsAddress), "0"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free metrics port: %w", err)
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+type MetricType string
+
+const (
+	MetricCounter   MetricType = "counter"
+	MetricGauge     MetricType = "gauge"
+	MetricHistogram MetricType = "histogram"
+	MetricSummary   MetricType = "summary"
+	MetricUntyped   MetricType = "untyped"
+)
+
+// Bucket is a cumulative bucket of a histogram.
+type Bucket struct {
+	// UpperBound is the value of the le label, +Inf for the last bucket.
+	UpperBound float64
+	Count      float64
+}
+
+// Quantile is a quantile of a summary.
+type Quantile struct {
+	Quantile float64
+	Value    float64
+}
+
+// Metric is a sample of a family, identified by its labels.
+type Metric struct {
+	Labels map[string]string
+
+	// Value is the value of the counters, gauges and untyped metrics.
+	Value float64
+
+	// Buckets, Sum and Count are set for the histograms,
+	// Quantiles, Sum and Count for the summaries.
+	Buckets   []Bucket
+	Quantiles []Quantile
+	Sum       float64
+	Count     float64
+}
+
+// MetricFamily is a set of metrics with the same name.
+type MetricFamily struct {
+	Name    string
+	Help    string
+	Type    MetricType
+	Metrics []Metric
+}
+
+// Value returns the sum of the values of the metrics matching the
+// labels, given as name and value pairs.
+func (f MetricFamily) Value(labels ...string) (float64, bool) {
+	var sum float64
+	var found bool
+
+	for _, m := range f.Metrics {
+		if matchLabels(m.Labels, labels) {
+			sum += m.Value
+			found = true
+		}
+	}
+
+	return sum, found
+}
+
+func matchLabels(labels map[string]string, pairs []string) bool {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if labels[pairs[i]] != pairs[i+1] {
+			return false
+		}
+	}
+	return true
+}
+
+// Metrics are the metric families scraped from the node, in the
+// order of the endpoint.
+type Metrics struct {
+	Families []MetricFamily
+}
+
+// Family returns the family with the name.
+func (m Metrics) Family(name string) (MetricFamily, bool) {
+	for _, f := range m.Families {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return MetricFamily{}, false
+}
+
+// Value returns the value of the first family found among the names,
+// see MetricFamily.Value.
+func (m Metrics) Value(names []string, labels ...string) (float64, bool) {
+	for _, name := range names {
+		if f, ok := m.Family(name); ok {
+			if v, ok := f.Value(labels...); ok {
+				return v, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// The well-known metrics of the node. The storage prefix
+// replaced the codex one, both are accepted.
+var (
+	metricBlocksStored   = []string{"storage_repostore_blocks", "codex_repostore_blocks"}
+	metricBytesUsed      = []string{"storage_repostore_bytes_used", "codex_repostore_bytes_used"}
+	metricBlocksSent     = []string{"storage_block_exchange_blocks_sent", "codex_block_exchange_blocks_sent"}
+	metricBlocksReceived = []string{"storage_block_exchange_blocks_received", "codex_block_exchange_blocks_received"}
+	metricNetworkBytes   = []string{"libp2p_network_bytes"}
+	metricPeers          = []string{"libp2p_peers"}
+)
+
+// BlocksStored returns the number of blocks in the repo.
+func (m Metrics) BlocksStored() (float64, bool) {
+	return m.Value(metricBlocksStored)
+}
+
+// BytesUsed returns the number of bytes used by the repo.
+func (m Metrics) BytesUsed() (float64, bool) {
+	return m.Value(metricBytesUsed)
+}
+
+// BlocksSent returns the number of blocks sent to the other peers.
+func (m Metrics) BlocksSent() (float64, bool) {
+	return m.Value(metricBlocksSent)
+}
+
+// BlocksReceived returns the number of blocks received from the other peers.
+func (m Metrics) BlocksReceived() (float64, bool) {
+	return m.Value(metricBlocksReceived)
+}
+
+// BytesIn returns the number of bytes received by the network.
+func (m Metrics) BytesIn() (float64, bool) {
+	return m.Value(metricNetworkBytes, "direction", "in")
+}
+
+// BytesOut returns the number of bytes sent by the network.
+func (m Metrics) BytesOut() (float64, bool) {
+	return m.Value(metricNetworkBytes, "direction", "out")
+}
+
+// Peers returns the number of connected peers.
+func (m Metrics) Peers() (float64, bool) {
+	return m.Value(metricPeers)
+}
+
+// MetricsURL returns the URL of the metrics endpoint of the node.
+// An unspecified MetricsAddress, like 0.0.0.0, is reached with the loopback.
+func (node StorageNode) MetricsURL() (string, error) {
+	if !node.config.MetricsEnabled {
+		return "", ErrMetricsDisabled
+	}
+
+	addr, err := netip.ParseAddr(cmp.Or(node.config.MetricsAddress, defaultMetricsAddress))
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case addr.IsUnspecified() && addr.Is6():
+		addr = netip.IPv6Loopback()
+	case addr.IsUnspecified():
+		addr = netip.MustParseAddr(defaultMetricsAddress)
+	}
+
+	port := cmp.Or(node.config.MetricsPort, defaultMetricsPort)
+
+	host := net.JoinHostPort(addr.String(), strconv.Itoa(port))
+	return "http://" + host + "/metrics", nil
+}
+
+// Metrics scrapes the metrics endpoint of the node, see MetricsURL.
+func (node StorageNode) Metrics(ctx context.Context) (Metrics, error) {
+	url, err := node.MetricsURL()
+	if err != nil {
+		return Metrics{}, err
+	}
+
+	return scrapeMetrics(ctx, url)
+}
+
+func scrapeMetrics(ctx context.Context, url string) (Metrics, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Metrics{}, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Metrics{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Metrics{}, fmt.Errorf("metrics endpoint returned %s", resp.Status)
+	}
+
+	return ParseMetrics(resp.Body)
+}
+
+// metricSuffixes are the suffixes of the samples of a family.
+var metricSuffixes = []string{"_bucket", "_sum", "_count", "_total", "_created"}
+
+// ParseMetrics parses metrics in the Prometheus text format.
+func ParseMetrics(r io.Reader) (Metrics, error) {
+	var families []*MetricFamily
+	byName := map[string]*MetricFamily{}
+	byLabels := map[*MetricFamily]map[string]int{}
+
+	family := func(name string) *MetricFamily {
+		f, ok := byName[name]
+		if !ok {
+			f = &MetricFamily{Name: name, Type: MetricUntyped}
+			byName[name] = f
+			byLabels[f] = map[string]int{}
+			families = append(families, f)
+		}
+		return f
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if comment, ok := strings.CutPrefix(line, "#"); ok {
+			fields := strings.Fields(comment)
+			if len(fields) < 3 {
+				continue
+			}
+
+			switch fields[0] {
+			case "HELP":
+				_, help, _ := strings.Cut(strings.TrimSpace(comment), fields[1])
+				family(fields[1]).Help = strings.TrimSpace(help)
+			case "TYPE":
+				family(fields[1]).Type = MetricType(fields[2])
+			}
+			continue
+		}
+
+		name, labels, value, err := parseMetricLine(line)
+		if err != nil {
+			return Metrics{}, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		f, suffix := byName[name], ""
+		if f == nil {
+			for _, s := range metricSuffixes {
+				if base, ok := strings.CutSuffix(name, s); ok && byName[base] != nil {
+					f, suffix = byName[base], s
+					break
+				}
+			}
+		}
+
+		if f == nil {
+			f = family(name)
+		}
+
+		if suffix == "_created" {
+			continue
+		}
+
+		le, quantile := labels["le"], labels["quantile"]
+		if suffix == "_bucket" {
+			delete(labels, "le")
+		}
+
+		if f.Type == MetricSummary && suffix == "" {
+			delete(labels, "quantile")
+		}
+
+		key := labelsKey(labels)
+		i, ok := byLabels[f][key]
+		if !ok {
+			i = len(f.Metrics)
+			byLabels[f][key] = i
+			f.Metrics = append(f.Metrics, Metric{Labels: labels})
+		}
+		m := &f.Metrics[i]
+
+		switch {
+		case suffix == "_bucket":
+			bound, err := parseMetricValue(le)
+			if err != nil {
+				return Metrics{}, fmt.Errorf("line %d: invalid bucket %q", n, le)
+			}
+			m.Buckets = append(m.Buckets, Bucket{UpperBound: bound, Count: value})
+		case suffix == "_sum":
+			m.Sum = value
+		case suffix == "_count":
+			m.Count = value
+		case f.Type == MetricSummary:
+			q, err := parseMetricValue(quantile)
+			if err != nil {
+				return Metrics{}, fmt.Errorf("line %d: invalid quantile %q", n, quantile)
+			}
+			m.Quantiles = append(m.Quantiles, Quantile{Quantile: q, Value: value})
+		default:
+			m.Value = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Metrics{}, err
+	}
+
+	res := Metrics{Families: make([]MetricFamily, 0, len(families))}
+	for _, f := range families {
+		res.Families = append(res.Families, *f)
+	}
+
+	return res, nil
+}
+
+// parseMetricLine parses a sample: name{labels} value [timestamp].
+func parseMetricLine(line string) (string, map[string]string, float64, error) {
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return "", nil, 0, fmt.Errorf("invalid sample %q", line)
+	}
+
+	name, rest := line[:end], line[end:]
+	labels := map[string]string{}
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		labels, rest, err = parseMetricLabels(rest[1:])
+		if err != nil {
+			return "", nil, 0, err
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", nil, 0, fmt.Errorf("invalid sample %q", line)
+	}
+
+	value, err := parseMetricValue(fields[0])
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("invalid value in sample %q", line)
+	}
+
+	return name, labels, value, nil
+}
+
+// parseMetricLabels parses the labels after the opening brace
+// and returns the rest of the line after the closing one.
+func parseMetricLabels(s string) (map[string]string, string, error) {
+	labels := map[string]string{}
+
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if rest, ok := strings.CutPrefix(s, "}"); ok {
+			return labels, rest, nil
+		}
+
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok || !strings.HasPrefix(rest, `"`) {
+			return nil, "", errors.New("invalid labels")
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				switch rest[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(rest[i])
+				}
+				continue
+			}
+			value.WriteByte(rest[i])
+		}
+
+		if i >= len(rest) {
+			return nil, "", errors.New("unterminated label value")
+		}
+
+		labels[strings.TrimSpace(name)] = value.String()
+		s = rest[i+1:]
+	}
+}
+
+func parseMetricValue(s string) (float64, error) {
+	switch s {
+	case "+Inf", "Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// labelsKey identifies a metric of a family by its labels.
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%s=%q,", k, labels[k])
+	}
+	return sb.String()
+}
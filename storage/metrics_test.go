@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testMetrics = `# HELP storage_repostore_blocks Number of blocks in the repo.
+# TYPE storage_repostore_blocks gauge
+storage_repostore_blocks 42.0
+storage_repostore_blocks_created 1.7e9
+# HELP libp2p_network_bytes total traffic
+# TYPE libp2p_network_bytes counter
+libp2p_network_bytes_total{direction="in"} 1024.0
+libp2p_network_bytes_total{direction="out"} 512.0
+libp2p_network_bytes_created{direction="in"} 1.7e9
+# TYPE libp2p_peers gauge
+libp2p_peers 3
+# TYPE storage_block_exchange_latency histogram
+storage_block_exchange_latency_bucket{peer="a\"b",le="0.1"} 1
+storage_block_exchange_latency_bucket{peer="a\"b",le="+Inf"} 4
+storage_block_exchange_latency_sum{peer="a\"b"} 2.5
+storage_block_exchange_latency_count{peer="a\"b"} 4
+# TYPE rpc_duration summary
+rpc_duration{quantile="0.5"} 0.2
+rpc_duration_sum 10
+rpc_duration_count 30
+process_start_time_seconds 1700000000 1700000000000
+`
+
+func TestParseMetrics(t *testing.T) {
+	metrics, err := ParseMetrics(strings.NewReader(testMetrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metrics.Families) != 6 {
+		t.Fatalf("expected 6 families, got %+v", metrics.Families)
+	}
+
+	blocks, _ := metrics.Family("storage_repostore_blocks")
+	if blocks.Type != MetricGauge || blocks.Help != "Number of blocks in the repo." || len(blocks.Metrics) != 1 {
+		t.Fatalf("unexpected family %+v", blocks)
+	}
+
+	latency, _ := metrics.Family("storage_block_exchange_latency")
+	if latency.Type != MetricHistogram || len(latency.Metrics) != 1 {
+		t.Fatalf("unexpected histogram %+v", latency)
+	}
+
+	h := latency.Metrics[0]
+	if h.Labels["peer"] != `a"b` || h.Sum != 2.5 || h.Count != 4 || len(h.Buckets) != 2 || !math.IsInf(h.Buckets[1].UpperBound, 1) {
+		t.Fatalf("unexpected histogram metric %+v", h)
+	}
+
+	rpc, _ := metrics.Family("rpc_duration")
+	if s := rpc.Metrics[0]; len(s.Quantiles) != 1 || s.Quantiles[0] != (Quantile{0.5, 0.2}) || s.Count != 30 {
+		t.Fatalf("unexpected summary %+v", rpc)
+	}
+
+	untyped, _ := metrics.Family("process_start_time_seconds")
+	if untyped.Type != MetricUntyped || untyped.Metrics[0].Value != 1700000000 {
+		t.Fatalf("unexpected untyped family %+v", untyped)
+	}
+
+	for name, fn := range map[string]func() (float64, bool){
+		"blocks":    metrics.BlocksStored,
+		"bytes in":  metrics.BytesIn,
+		"bytes out": metrics.BytesOut,
+		"peers":     metrics.Peers,
+	} {
+		expected := map[string]float64{"blocks": 42, "bytes in": 1024, "bytes out": 512, "peers": 3}[name]
+		if v, ok := fn(); !ok || v != expected {
+			t.Fatalf("expected %s to be %v, got %v", name, expected, v)
+		}
+	}
+
+	if _, ok := metrics.BlocksSent(); ok {
+		t.Fatal("expected no blocks sent metric")
+	}
+
+	if _, err := ParseMetrics(strings.NewReader(`broken{a="b 1`)); err == nil {
+		t.Fatal("expected an error for unterminated labels")
+	}
+}
+
+func TestNodeMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testMetrics))
+	}))
+	defer server.Close()
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	node := StorageNode{config: Config{MetricsEnabled: true, MetricsAddress: host, MetricsPort: p}}
+
+	metrics, err := node.Metrics(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := metrics.Peers(); v != 3 {
+		t.Fatalf("expected 3 peers, got %v", v)
+	}
+
+	node.config.MetricsEnabled = false
+	if _, err := node.Metrics(context.Background()); !errors.Is(err, ErrMetricsDisabled) {
+		t.Fatalf("expected ErrMetricsDisabled, got %v", err)
+	}
+}
+
+func TestMetricsURL(t *testing.T) {
+	for address, expected := range map[string]string{
+		"":          "http://127.0.0.1:8008/metrics",
+		"0.0.0.0":   "http://127.0.0.1:8008/metrics",
+		"::":        "http://[::1]:8008/metrics",
+		"10.0.0.42": "http://10.0.0.42:8008/metrics",
+	} {
+		node := StorageNode{config: Config{MetricsEnabled: true, MetricsAddress: address, MetricsPort: 8008}}
+
+		url, err := node.MetricsURL()
+		if err != nil || url != expected {
+			t.Fatalf("expected %s for %q, got %s %v", expected, address, url, err)
+		}
+	}
+
+	// 0 is the default port of the library
+	node := StorageNode{config: Config{MetricsEnabled: true}}
+	if url, err := node.MetricsURL(); err != nil || url != "http://127.0.0.1:8008/metrics" {
+		t.Fatalf("expected the default port, got %s %v", url, err)
+	}
+}
+
+func TestMetricsFreePort(t *testing.T) {
+	node := newStorageNode(t, Config{MetricsEnabled: true})
+
+	if node.config.MetricsPort <= 0 {
+		t.Fatal("expected a free metrics port")
+	}
+
+	metrics, err := node.Metrics(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metrics.Families) == 0 {
+		t.Fatal("expected metrics")
+	}
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+)
+
+type MigrationStatus string
+
+const (
+	// MigrationMigrated means that the dataset was copied with its cid.
+	MigrationMigrated MigrationStatus = "migrated"
+
+	// MigrationSkipped means that the dataset was not copied,
+	// see MigrationItem.Reason.
+	MigrationSkipped MigrationStatus = "skipped"
+
+	// MigrationFailed means that the dataset could not be copied
+	// or got another cid, see MigrationItem.Err.
+	MigrationFailed MigrationStatus = "failed"
+)
+
+// MigrationItem is the result of the migration of a dataset.
+type MigrationItem struct {
+	Manifest Manifest
+	Status   MigrationStatus
+
+	// Reason explains why the dataset was skipped.
+	Reason string
+
+	// NewCid is the cid computed by the destination node.
+	NewCid string
+
+	Err error
+}
+
+// MigrationReport is the result of a migration.
+type MigrationReport struct {
+	Items []MigrationItem
+}
+
+// Count returns the number of items with the status.
+func (r MigrationReport) Count(status MigrationStatus) int {
+	count := 0
+	for _, item := range r.Items {
+		if item.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// MigrationProgress describes the progress of a migration.
+type MigrationProgress struct {
+	// Manifest is the dataset being migrated.
+	Manifest Manifest
+
+	// Index is the position of the dataset, starting at 1, and
+	// Total the number of datasets to migrate.
+	Index int
+	Total int
+
+	// Bytes is the number of bytes of the dataset copied so far.
+	Bytes int
+}
+
+type MigrationOptions struct {
+	// OnProgress is a callback function called after each chunk copied.
+	OnProgress func(progress MigrationProgress)
+
+	// OnItem is a callback function called after each dataset.
+	OnItem func(item MigrationItem)
+}
+
+// MigrateRepo creates and starts a node for each configuration, typically
+// with different RepoKind, and migrates the datasets of the source node
+// into the destination node with MigrateDatasets. Both nodes are stopped
+// and destroyed at the end.
+//
+// The nodes run in the same process, so they need different DataDir
+// and DiscoveryPort.
+func MigrateRepo(ctx context.Context, srcConfig, dstConfig Config, options MigrationOptions) (MigrationReport, error) {
+	if srcConfig.DataDir == dstConfig.DataDir {
+		return MigrationReport{}, errors.New("the source and destination data dirs must be different")
+	}
+
+	if srcConfig.DiscoveryPort == dstConfig.DiscoveryPort {
+		return MigrationReport{}, errors.New("the source and destination discovery ports must be different")
+	}
+
+	src, err := startNode(srcConfig)
+	if err != nil {
+		return MigrationReport{}, fmt.Errorf("failed to start the source node: %w", err)
+	}
+	defer stopNode(src)
+
+	dst, err := startNode(dstConfig)
+	if err != nil {
+		return MigrationReport{}, fmt.Errorf("failed to start the destination node: %w", err)
+	}
+	defer stopNode(dst)
+
+	return MigrateDatasets(ctx, src, dst, options)
+}
+
+// MigrateDatasets copies every dataset of the source node into the
+// destination node. Each dataset is streamed from the source local store
+// and uploaded with its filename and block size, and the cid computed
+// by the destination must be the original one.
+//
+// The migration is resumable: the datasets already stored by the
+// destination are skipped. The protected datasets are skipped too because
+// their erasure coding cannot be reproduced by an upload, and so are the
+// datasets with a mimetype but a filename without extension, as the
+// mimetype is detected from the filename. A dataset migrated with
+// another cid is deleted from the destination, unless the destination
+// already stored that cid before the migration.
+// The returned error joins the errors of the failed datasets.
+func MigrateDatasets(ctx context.Context, src, dst *StorageNode, options MigrationOptions) (MigrationReport, error) {
+	var report MigrationReport
+
+	manifests, err := src.Manifests()
+	if err != nil {
+		return report, err
+	}
+
+	// The cids stored by the destination, which must not be
+	// deleted when a dataset is migrated with another cid
+	stored, err := dst.Manifests()
+	if err != nil {
+		return report, err
+	}
+
+	existing := make(map[string]bool, len(stored))
+	for _, m := range stored {
+		existing[m.Cid] = true
+	}
+
+	var errs []error
+	for i, m := range manifests {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		item := migrateDataset(ctx, src, dst, m, existing, func(bytes int) {
+			if options.OnProgress != nil {
+				options.OnProgress(MigrationProgress{Manifest: m, Index: i + 1, Total: len(manifests), Bytes: bytes})
+			}
+		})
+
+		if item.Status == MigrationMigrated {
+			existing[item.NewCid] = true
+		}
+
+		if item.Err != nil {
+			errs = append(errs, fmt.Errorf("failed to migrate %s: %w", m.Cid, item.Err))
+		}
+
+		report.Items = append(report.Items, item)
+
+		if options.OnItem != nil {
+			options.OnItem(item)
+		}
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// migrateDataset copies a dataset. The existing cids of the destination
+// are kept if the dataset is uploaded with one of them instead of its own.
+func migrateDataset(ctx context.Context, src, dst *StorageNode, m Manifest, existing map[string]bool, onProgress func(bytes int)) MigrationItem {
+	item := MigrationItem{Manifest: m}
+
+	if m.Protected {
+		item.Status = MigrationSkipped
+		item.Reason = "protected dataset"
+		return item
+	}
+
+	// The library detects the mimetype from the extension of the filename,
+	// without extension the dataset would get another cid.
+	if m.Mimetype != "" && path.Ext(m.Filename) == "" {
+		item.Status = MigrationSkipped
+		item.Reason = fmt.Sprintf("mimetype %s cannot be restored from the filename %q", m.Mimetype, m.Filename)
+		return item
+	}
+
+	exists, err := dst.Exists(m.Cid)
+	if err != nil {
+		item.Status = MigrationFailed
+		item.Err = err
+		return item
+	}
+
+	if exists {
+		item.Status = MigrationSkipped
+		item.Reason = "already migrated"
+		return item
+	}
+
+	pr, pw := io.Pipe()
+
+	channelError := make(chan error, 1)
+	go func() {
+		err := src.DownloadStream(ctx, m.Cid, DownloadStreamOptions{Writer: pw, Local: true})
+		pw.CloseWithError(err)
+		channelError <- err
+	}()
+
+	item.NewCid, err = dst.reupload(ctx, m, pr, func(read, total int, percent float64, err error) {
+		onProgress(total)
+	})
+
+	// Unblock the download if the upload failed
+	pr.CloseWithError(err)
+
+	if downloadErr := <-channelError; err == nil && downloadErr != nil {
+		err = downloadErr
+	}
+
+	if err == nil && item.NewCid != m.Cid {
+		err = fmt.Errorf("%w: %s was migrated as %s", ErrCidMismatch, m.Cid, item.NewCid)
+
+		// The copy under another cid is not the migrated dataset,
+		// unless the destination already had it
+		if !existing[item.NewCid] {
+			if deleteErr := dst.Delete(item.NewCid); deleteErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to delete %s: %w", item.NewCid, deleteErr))
+			}
+		}
+	}
+
+	if err != nil {
+		item.Status = MigrationFailed
+		item.Err = err
+		return item
+	}
+
+	item.Status = MigrationMigrated
+	return item
+}
+
+func startNode(config Config) (*StorageNode, error) {
+	node, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := node.Start(); err != nil {
+		node.Destroy()
+		return nil, err
+	}
+
+	return node, nil
+}
+
+func stopNode(node *StorageNode) {
+	node.Stop()
+	node.Destroy()
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMigrateDatasets(t *testing.T) {
+	src := newStorageNode(t, Config{RepoKind: FS})
+	cid, _ := uploadHelper(t, src)
+	bigCid, _ := uploadBigFileHelper(t, src)
+
+	dst := newStorageNode(t, Config{RepoKind: SQLite})
+
+	progress := 0
+	report, err := MigrateDatasets(context.Background(), src, dst, MigrationOptions{
+		OnProgress: func(p MigrationProgress) {
+			progress++
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Count(MigrationMigrated) != 2 {
+		t.Fatalf("expected 2 datasets migrated, got %+v", report.Items)
+	}
+
+	if progress == 0 {
+		t.Error("expected progress updates")
+	}
+
+	for _, c := range []string{cid, bigCid} {
+		exists, err := dst.Exists(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Fatalf("expected %s to be migrated", c)
+		}
+	}
+
+	// A second migration resumes and skips everything
+	report, err = MigrateDatasets(context.Background(), src, dst, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Count(MigrationSkipped) != 2 {
+		t.Fatalf("expected 2 datasets skipped, got %+v", report.Items)
+	}
+}
+
+func TestMigrateRepoSameDataDir(t *testing.T) {
+	dataDir := t.TempDir()
+
+	_, err := MigrateRepo(context.Background(), Config{DataDir: dataDir}, Config{DataDir: dataDir, DiscoveryPort: 8091}, MigrationOptions{})
+	if err == nil {
+		t.Fatal("expected an error when migrating into the same data dir")
+	}
+}
+
+func TestMigrateDatasetMimetypeSkipped(t *testing.T) {
+	m := Manifest{Cid: "cid", Filename: "README", Mimetype: "text/markdown"}
+
+	// Skipped before the nodes are used
+	item := migrateDataset(context.Background(), &StorageNode{}, &StorageNode{}, m, nil, func(int) {})
+	if item.Status != MigrationSkipped || item.Reason == "" {
+		t.Fatalf("expected the dataset to be skipped, got %+v", item)
+	}
+}
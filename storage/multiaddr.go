@@ -0,0 +1,379 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// multiaddrValue describes the value expected after a multiaddr protocol.
+type multiaddrValue int
+
+const (
+	multiaddrNoValue multiaddrValue = iota
+	multiaddrIP4
+	multiaddrIP6
+	multiaddrPort
+	multiaddrString
+	multiaddrPeerID
+
+	// multiaddrPath consumes the rest of the address, like /unix.
+	multiaddrPath
+)
+
+// multiaddrProtocols are the protocols accepted in the multiaddrs.
+var multiaddrProtocols = map[string]multiaddrValue{
+	"ip4":          multiaddrIP4,
+	"ip6":          multiaddrIP6,
+	"dns":          multiaddrString,
+	"dns4":         multiaddrString,
+	"dns6":         multiaddrString,
+	"dnsaddr":      multiaddrString,
+	"tcp":          multiaddrPort,
+	"udp":          multiaddrPort,
+	"quic":         multiaddrNoValue,
+	"quic-v1":      multiaddrNoValue,
+	"ws":           multiaddrNoValue,
+	"wss":          multiaddrNoValue,
+	"tls":          multiaddrNoValue,
+	"noise":        multiaddrNoValue,
+	"webtransport": multiaddrNoValue,
+	"certhash":     multiaddrString,
+	"p2p":          multiaddrPeerID,
+	"ipfs":         multiaddrPeerID,
+	"p2p-circuit":  multiaddrNoValue,
+	"unix":         multiaddrPath,
+}
+
+// multiaddrTransports are the transport protocols, from the
+// highest level to the lowest, see Multiaddr.Transport.
+var multiaddrTransports = []string{"webtransport", "quic-v1", "quic", "wss", "ws", "tcp", "udp", "unix"}
+
+// MultiaddrComponent is a protocol of a multiaddr with its value, if any.
+type MultiaddrComponent struct {
+	Protocol string
+	Value    string
+}
+
+// Multiaddr is a parsed multiaddr, like /ip4/127.0.0.1/tcp/8070.
+// The zero value is an empty, invalid, multiaddr.
+type Multiaddr struct {
+	components []MultiaddrComponent
+}
+
+// ErrUnknownProtocol is returned by ParseMultiaddr for a protocol
+// that is not known by the Go parser.
+var ErrUnknownProtocol = errors.New("unknown multiaddr protocol")
+
+// ParseMultiaddr parses and validates a textual multiaddr.
+// The protocols unknown by the parser, like a misspelled one,
+// are rejected with ErrUnknownProtocol.
+func ParseMultiaddr(s string) (Multiaddr, error) {
+	if !strings.HasPrefix(s, "/") {
+		return Multiaddr{}, fmt.Errorf("multiaddr %q must start with /", s)
+	}
+
+	var m Multiaddr
+	parts := strings.Split(s[1:], "/")
+
+	for i := 0; i < len(parts); i++ {
+		name := parts[i]
+
+		kind, ok := multiaddrProtocols[name]
+		if !ok {
+			return Multiaddr{}, fmt.Errorf("%w %q in multiaddr %q", ErrUnknownProtocol, name, s)
+		}
+
+		if kind == multiaddrNoValue {
+			m.components = append(m.components, MultiaddrComponent{Protocol: name})
+			continue
+		}
+
+		if i+1 >= len(parts) || parts[i+1] == "" {
+			return Multiaddr{}, fmt.Errorf("missing value for %s in multiaddr %q", name, s)
+		}
+
+		i++
+		value := parts[i]
+
+		switch kind {
+		case multiaddrIP4:
+			ip, err := netip.ParseAddr(value)
+			if err != nil || !ip.Is4() {
+				return Multiaddr{}, fmt.Errorf("invalid ip4 %q in multiaddr %q", value, s)
+			}
+		case multiaddrIP6:
+			ip, err := netip.ParseAddr(value)
+			if err != nil || !ip.Is6() {
+				return Multiaddr{}, fmt.Errorf("invalid ip6 %q in multiaddr %q", value, s)
+			}
+		case multiaddrPort:
+			if _, err := strconv.ParseUint(value, 10, 16); err != nil {
+				return Multiaddr{}, fmt.Errorf("invalid %s port %q in multiaddr %q", name, value, s)
+			}
+		case multiaddrPeerID:
+			if _, err := ParsePeerID(value); err != nil {
+				return Multiaddr{}, fmt.Errorf("invalid peer id in multiaddr %q: %w", s, err)
+			}
+		case multiaddrPath:
+			value = "/" + strings.Join(parts[i:], "/")
+			i = len(parts)
+		}
+
+		m.components = append(m.components, MultiaddrComponent{Protocol: name, Value: value})
+	}
+
+	return m, nil
+}
+
+// MustParseMultiaddr is like ParseMultiaddr but panics on error.
+func MustParseMultiaddr(s string) Multiaddr {
+	m, err := ParseMultiaddr(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// ParseMultiaddrs parses a list of textual multiaddrs.
+func ParseMultiaddrs(addrs []string) ([]Multiaddr, error) {
+	res := make([]Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		m, err := ParseMultiaddr(addr)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+// validateMultiaddr checks a textual multiaddr, see ParseMultiaddr.
+func validateMultiaddr(addr string) error {
+	_, err := ParseMultiaddr(addr)
+	return err
+}
+
+func (m Multiaddr) IsZero() bool {
+	return len(m.components) == 0
+}
+
+func (m Multiaddr) String() string {
+	var sb strings.Builder
+	for _, c := range m.components {
+		sb.WriteString("/")
+		sb.WriteString(c.Protocol)
+
+		if c.Value != "" && multiaddrProtocols[c.Protocol] != multiaddrPath {
+			sb.WriteString("/")
+		}
+		sb.WriteString(c.Value)
+	}
+	return sb.String()
+}
+
+// Components returns the protocols of the multiaddr.
+func (m Multiaddr) Components() []MultiaddrComponent {
+	return append([]MultiaddrComponent(nil), m.components...)
+}
+
+// value returns the value of the first component with the protocol.
+func (m Multiaddr) value(protocols ...string) (string, string, bool) {
+	for _, c := range m.components {
+		for _, p := range protocols {
+			if c.Protocol == p {
+				return p, c.Value, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// IP returns the ip4 or ip6 address.
+func (m Multiaddr) IP() (netip.Addr, bool) {
+	_, v, ok := m.value("ip4", "ip6")
+	if !ok {
+		return netip.Addr{}, false
+	}
+
+	ip, err := netip.ParseAddr(v)
+	return ip, err == nil
+}
+
+// Host returns the IP address or the DNS name.
+func (m Multiaddr) Host() (string, bool) {
+	_, v, ok := m.value("ip4", "ip6", "dns", "dns4", "dns6", "dnsaddr")
+	return v, ok
+}
+
+// Port returns the tcp or udp port.
+func (m Multiaddr) Port() (int, bool) {
+	_, v, ok := m.value("tcp", "udp")
+	if !ok {
+		return 0, false
+	}
+
+	port, err := strconv.Atoi(v)
+	return port, err == nil
+}
+
+// Transport returns the highest level transport protocol,
+// like quic-v1, ws or tcp, or an empty string.
+func (m Multiaddr) Transport() string {
+	for _, t := range multiaddrTransports {
+		if _, _, ok := m.value(t); ok {
+			return t
+		}
+	}
+	return ""
+}
+
+// PeerID returns the peer id of the /p2p component.
+func (m Multiaddr) PeerID() (PeerID, bool) {
+	_, v, ok := m.value("p2p", "ipfs")
+	return PeerID(v), ok
+}
+
+func (m Multiaddr) MarshalText() ([]byte, error) {
+	if m.IsZero() {
+		return nil, errors.New("empty multiaddr")
+	}
+	return []byte(m.String()), nil
+}
+
+func (m *Multiaddr) UnmarshalText(data []byte) error {
+	v, err := ParseMultiaddr(string(data))
+	if err != nil {
+		return err
+	}
+
+	*m = v
+	return nil
+}
+
+func (m Multiaddr) MarshalJSON() ([]byte, error) {
+	data, err := m.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(data))
+}
+
+func (m *Multiaddr) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return m.UnmarshalText([]byte(s))
+}
+
+// MultiaddrStrings returns the textual multiaddrs,
+// like the ones of Config.ListenAddrs.
+func MultiaddrStrings(addrs []Multiaddr) []string {
+	res := make([]string, len(addrs))
+	for i, m := range addrs {
+		res[i] = m.String()
+	}
+	return res
+}
+
+// multiaddrCodes are the binary codes of the protocols.
+var multiaddrCodes = map[uint64]string{
+	4:   "ip4",
+	6:   "tcp",
+	41:  "ip6",
+	53:  "dns",
+	54:  "dns4",
+	55:  "dns6",
+	56:  "dnsaddr",
+	273: "udp",
+	290: "p2p-circuit",
+	400: "unix",
+	421: "p2p",
+	448: "tls",
+	454: "noise",
+	460: "quic",
+	461: "quic-v1",
+	465: "webtransport",
+	466: "certhash",
+	477: "ws",
+	478: "wss",
+}
+
+// decodeMultiaddr decodes a binary multiaddr, as found in the peer records.
+func decodeMultiaddr(data []byte) (Multiaddr, error) {
+	var m Multiaddr
+
+	for len(data) > 0 {
+		code, n := binary.Uvarint(data)
+		if n <= 0 {
+			return Multiaddr{}, errors.New("invalid multiaddr protocol code")
+		}
+		data = data[n:]
+
+		name, ok := multiaddrCodes[code]
+		if !ok {
+			return Multiaddr{}, fmt.Errorf("unknown multiaddr protocol code %d", code)
+		}
+
+		var size int
+		switch multiaddrProtocols[name] {
+		case multiaddrNoValue:
+			m.components = append(m.components, MultiaddrComponent{Protocol: name})
+			continue
+		case multiaddrIP4:
+			size = 4
+		case multiaddrIP6:
+			size = 16
+		case multiaddrPort:
+			size = 2
+		default:
+			length, n := binary.Uvarint(data)
+			if n <= 0 {
+				return Multiaddr{}, fmt.Errorf("invalid multiaddr length for %s", name)
+			}
+			data = data[n:]
+			size = int(length)
+		}
+
+		if size < 0 || size > len(data) {
+			return Multiaddr{}, fmt.Errorf("truncated multiaddr value for %s", name)
+		}
+		raw := data[:size]
+		data = data[size:]
+
+		var value string
+		switch multiaddrProtocols[name] {
+		case multiaddrIP4:
+			value = netip.AddrFrom4([4]byte(raw)).String()
+		case multiaddrIP6:
+			value = netip.AddrFrom16([16]byte(raw)).String()
+		case multiaddrPort:
+			value = strconv.Itoa(int(binary.BigEndian.Uint16(raw)))
+		case multiaddrPeerID:
+			value = base58Encode(raw)
+		case multiaddrString:
+			value = string(raw)
+		case multiaddrPath:
+			value = "/" + strings.TrimPrefix(string(raw), "/")
+		}
+
+		if name == "certhash" {
+			// Multibase base64url
+			value = "u" + base64.RawURLEncoding.EncodeToString(raw)
+		}
+
+		m.components = append(m.components, MultiaddrComponent{Protocol: name, Value: value})
+	}
+
+	if m.IsZero() {
+		return Multiaddr{}, errors.New("empty multiaddr")
+	}
+
+	return m, nil
+}
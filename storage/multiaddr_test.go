@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMultiaddr(t *testing.T) {
+	peerId := testPeerID(t, 2)
+
+	m, err := ParseMultiaddr("/ip4/192.168.1.2/udp/8070/quic-v1/p2p/" + peerId.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ip, ok := m.IP(); !ok || ip.String() != "192.168.1.2" {
+		t.Fatalf("unexpected ip %v", ip)
+	}
+
+	if port, ok := m.Port(); !ok || port != 8070 {
+		t.Fatalf("unexpected port %d", port)
+	}
+
+	if m.Transport() != "quic-v1" {
+		t.Fatalf("unexpected transport %s", m.Transport())
+	}
+
+	if id, ok := m.PeerID(); !ok || id != peerId {
+		t.Fatalf("unexpected peer id %s", id)
+	}
+
+	for _, addr := range []string{"/ip4/0.0.0.0/tcp/0", "/ip6/::1/tcp/8070/ws", "/dns4/example.com/tcp/443/wss", "/unix/tmp/storage.sock"} {
+		m, err := ParseMultiaddr(addr)
+		if err != nil {
+			t.Fatalf("%s: %v", addr, err)
+		}
+
+		if m.String() != addr {
+			t.Fatalf("expected %s, got %s", addr, m)
+		}
+	}
+
+	for _, addr := range []string{"", "ip4/0.0.0.0", "/ip4/::1/tcp/0", "/ip4/0.0.0.0/tcp/70000", "/ip4/0.0.0.0/tcp", "/foo/bar", "/ip4/0.0.0.0/", "/ip4/1.2.3.4/tcp/1/p2p/abc"} {
+		if _, err := ParseMultiaddr(addr); err == nil {
+			t.Fatalf("expected an error for %q", addr)
+		}
+	}
+}
+
+func TestMultiaddrJSON(t *testing.T) {
+	addrs := []Multiaddr{MustParseMultiaddr("/ip4/127.0.0.1/tcp/8070")}
+
+	data, err := json.Marshal(addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `["/ip4/127.0.0.1/tcp/8070"]` {
+		t.Fatalf("unexpected JSON %s", data)
+	}
+
+	var decoded []Multiaddr
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded) != 1 || decoded[0].String() != addrs[0].String() {
+		t.Fatalf("unexpected multiaddrs %v", decoded)
+	}
+
+	if err := json.Unmarshal([]byte(`["127.0.0.1:8070"]`), &decoded); err == nil {
+		t.Fatal("expected an error for an invalid multiaddr")
+	}
+
+	if _, err := json.Marshal(Multiaddr{}); err == nil {
+		t.Fatal("expected an error for an empty multiaddr")
+	}
+}
+
+func TestDebugInfoTyped(t *testing.T) {
+	storage := newStorageNode(t)
+
+	info, err := storage.Debug()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := info.PeerID(); err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := info.Multiaddrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(addrs) == 0 || addrs[0].Transport() == "" {
+		t.Fatalf("expected typed listen addresses, got %v", addrs)
+	}
+}
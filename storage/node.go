@@ -58,6 +58,11 @@ package storage
 import "C"
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 )
 
@@ -92,7 +97,7 @@ const (
 
 type Config struct {
 	// Default: INFO
-	LogLevel string `json:"log-level,omitempty"`
+	LogLevel LogLevel `json:"log-level,omitempty"`
 
 	// Specifies what kind of logs should be written to stdout
 	// Default: auto
@@ -106,7 +111,7 @@ type Config struct {
 	// Default: 127.0.0.1
 	MetricsAddress string `json:"metrics-address,omitempty"`
 
-	// Listening HTTP port of the metrics server
+	// Listening HTTP port of the metrics server, see MetricsPortFree
 	// Default: 8008
 	MetricsPort int `json:"metrics-port,omitempty"`
 
@@ -117,14 +122,14 @@ type Config struct {
 	// $HOME/.cache/storage on Linux
 	DataDir string `json:"data-dir,omitempty"`
 
-	// Multi Addresses to listen on
+	// Multi Addresses to listen on, see ListenMultiaddrs
 	// Default: ["/ip4/0.0.0.0/tcp/0"]
 	ListenAddrs []string `json:"listen-addrs,omitempty"`
 
 	// Specify method to use for determining public address.
-	// Must be one of: any, none, upnp, pmp, extip:<IP>
+	// Must be one of: any, none, upnp, pmp, extip:<IP>, see NatExtIP
 	// Default: any
-	Nat string `json:"nat,omitempty"`
+	Nat NatOption `json:"nat,omitempty"`
 
 	// Discovery (UDP) port
 	// Default: 8090
@@ -155,16 +160,18 @@ type Config struct {
 
 	// The size of the total storage quota dedicated to the node
 	// Default: 20 GiBs
-	StorageQuota int `json:"storage-quota,omitempty"`
+	StorageQuota ByteSize `json:"storage-quota,omitempty"`
 
-	// Default block timeout in seconds - 0 disables the ttl
+	// Default block timeout - nil uses the default, 0 disables the ttl
+	// so the blocks never expire
 	// Default: 30 days
-	BlockTtl string `json:"block-ttl,omitempty"`
+	BlockTtl *Duration `json:"block-ttl,omitempty"`
 
-	// Time interval in seconds - determines frequency of block
-	// maintenance cycle: how often blocks are checked for expiration and cleanup
+	// Determines frequency of block maintenance cycle:
+	// how often blocks are checked for expiration and cleanup
+	// - nil uses the default, 0 is rejected by Validate
 	// Default: 10 minutes
-	BlockMaintenanceInterval string `json:"block-mi,omitempty"`
+	BlockMaintenanceInterval *Duration `json:"block-mi,omitempty"`
 
 	// Number of blocks to check every maintenance cycle
 	// Default: 1000
@@ -183,8 +190,107 @@ type Config struct {
 	LogFile string `json:"log-file,omitempty"`
 }
 
+// NodeState is the lifecycle state of a node.
+type NodeState int32
+
+const (
+	NodeCreated NodeState = iota
+	NodeStarted
+	NodeStopped
+	NodeDestroyed
+)
+
+func (s NodeState) String() string {
+	switch s {
+	case NodeCreated:
+		return "created"
+	case NodeStarted:
+		return "started"
+	case NodeStopped:
+		return "stopped"
+	case NodeDestroyed:
+		return "destroyed"
+	default:
+		return "unknown"
+	}
+}
+
+func (s NodeState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 type StorageNode struct {
 	ctx unsafe.Pointer
+
+	// config is the configuration used to create the node.
+	config Config
+
+	// state is the NodeState, shared by the copies of the node.
+	state *atomic.Int32
+
+	// downloads tracks the download sessions, shared by the
+	// copies of the node.
+	downloads *downloadMux
+
+	// accesses records the accesses to the datasets.
+	accesses *AccessLog
+
+	// catalog is the catalog filled in by the uploads, if any.
+	catalog *atomic.Pointer[Catalog]
+
+	// stops are the functions called when the node is stopped.
+	stops *stopHooks
+
+	// health runs the health probes, see Health.
+	health *healthProbe
+
+	// observer is notified of the operations, see SetObserver.
+	observer *atomic.Pointer[Observer]
+}
+
+// stopHooks are called by Stop, before the node is stopped,
+// to shut down the helpers bound to the node.
+type stopHooks struct {
+	mu    sync.Mutex
+	next  int
+	hooks map[int]func()
+}
+
+func newStopHooks() *stopHooks {
+	return &stopHooks{hooks: map[int]func(){}}
+}
+
+// onStop registers a function called when the node is stopped.
+// It returns a function to unregister it.
+func (node StorageNode) onStop(fn func()) func() {
+	h := node.stops
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	id := h.next
+	h.next++
+	h.hooks[id] = fn
+
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.hooks, id)
+	}
+}
+
+func (h *stopHooks) run() {
+	h.mu.Lock()
+	hooks := make([]func(), 0, len(h.hooks))
+	for _, fn := range h.hooks {
+		hooks = append(hooks, fn)
+	}
+	h.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
 }
 
 type ChunkSize int
@@ -206,7 +312,25 @@ func (c ChunkSize) toSizeT() C.size_t {
 // to start it.
 // It returns a Logos Storage node that can be used to interact
 // with the Logos Storage network.
+// The configuration is checked first with Config.Validate, and
+// MetricsPortFree is replaced by a free port.
 func New(config Config) (*StorageNode, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if config.MetricsPort == MetricsPortFree {
+		config.MetricsPort = 0
+
+		if config.MetricsEnabled {
+			port, err := freeMetricsPort(config.MetricsAddress)
+			if err != nil {
+				return nil, err
+			}
+			config.MetricsPort = port
+		}
+	}
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -224,11 +348,37 @@ func New(config Config) (*StorageNode, error) {
 		return nil, bridge.err
 	}
 
-	return &StorageNode{ctx: ctx}, bridge.err
+	node := &StorageNode{
+		ctx:       ctx,
+		config:    config,
+		state:     &atomic.Int32{},
+		downloads: newDownloadMux(),
+		accesses:  newAccessLog(),
+		catalog:   &atomic.Pointer[Catalog]{},
+		stops:     newStopHooks(),
+		health:    newHealthProbe(),
+		observer:  &atomic.Pointer[Observer]{},
+	}
+
+	// The access log is kept in the data dir of the node
+	repo, err := node.Repo()
+	if err == nil {
+		err = node.accesses.load(filepath.Join(repo, accessLogFilename))
+	}
+
+	if err != nil {
+		node.Destroy()
+		return nil, err
+	}
+
+	return node, nil
 }
 
 // Start starts the Logos Storage node.
-func (node StorageNode) Start() error {
+func (node StorageNode) Start() (err error) {
+	op := node.observe(OpStart, nil)
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -236,8 +386,12 @@ func (node StorageNode) Start() error {
 		return bridge.callError("cGoStorageStart")
 	}
 
-	_, err := bridge.wait()
-	return err
+	if _, err := bridge.wait(); err != nil {
+		return err
+	}
+
+	node.state.Store(int32(NodeStarted))
+	return nil
 }
 
 // StartAsync is the asynchronous version of Start.
@@ -249,7 +403,24 @@ func (node StorageNode) StartAsync(onDone func(error)) {
 }
 
 // Stop stops the Logos Storage node.
-func (node StorageNode) Stop() error {
+// The helpers bound to the node, like the PeerManager, are closed first,
+// and the AccessLog is saved.
+func (node StorageNode) Stop() (err error) {
+	op := node.observe(OpStop, nil)
+	defer op.end(&err)
+
+	node.stops.run()
+
+	if err := node.accesses.Save(); err != nil {
+		return errors.Join(fmt.Errorf("failed to save the access log: %w", err), node.stop())
+	}
+
+	return node.stop()
+}
+
+// stop stops the node without closing the helpers bound to it,
+// for the callers that start it again, like Backup.
+func (node StorageNode) stop() error {
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -257,13 +428,20 @@ func (node StorageNode) Stop() error {
 		return bridge.callError("cGoStorageStop")
 	}
 
-	_, err := bridge.wait()
-	return err
+	if _, err := bridge.wait(); err != nil {
+		return err
+	}
+
+	node.state.Store(int32(NodeStopped))
+	return nil
 }
 
 // Destroy destroys the Logos Storage node, freeing all resources.
 // The node must be stopped before calling this method.
-func (node StorageNode) Destroy() error {
+func (node StorageNode) Destroy() (err error) {
+	op := node.observe(OpDestroy, nil)
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -271,7 +449,7 @@ func (node StorageNode) Destroy() error {
 		return bridge.callError("cGoStorageClose")
 	}
 
-	_, err := bridge.wait()
+	_, err = bridge.wait()
 	if err != nil {
 		return err
 	}
@@ -285,9 +463,20 @@ func (node StorageNode) Destroy() error {
 	// it destroys the context directly and return the return
 	// value synchronously.
 
+	node.state.Store(int32(NodeDestroyed))
 	return nil
 }
 
+// State returns the lifecycle state of the node.
+func (node StorageNode) State() NodeState {
+	return NodeState(node.state.Load())
+}
+
+// Config returns the configuration used to create the node.
+func (node StorageNode) Config() Config {
+	return node.config
+}
+
 // Version returns the version of the Logos Storage node.
 func (node StorageNode) Version() string {
 	cStr := C.cGoStorageVersion(node.ctx)
@@ -304,7 +493,10 @@ func (node StorageNode) Revision() string {
 }
 
 // Repo returns the path of the data dir folder.
-func (node StorageNode) Repo() (string, error) {
+func (node StorageNode) Repo() (_ string, err error) {
+	op := node.observe(OpRepo, nil)
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -315,7 +507,10 @@ func (node StorageNode) Repo() (string, error) {
 	return bridge.wait()
 }
 
-func (node StorageNode) Spr() (string, error) {
+func (node StorageNode) Spr() (_ string, err error) {
+	op := node.observe(OpSpr, nil)
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -326,7 +521,10 @@ func (node StorageNode) Spr() (string, error) {
 	return bridge.wait()
 }
 
-func (node StorageNode) PeerId() (string, error) {
+func (node StorageNode) PeerId() (_ string, err error) {
+	op := node.observe(OpPeerId, nil)
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -134,8 +134,9 @@ func TestNumThreads(t *testing.T) {
 }
 
 func TestBlockTtl(t *testing.T) {
+	ttl := Duration(10 * time.Hour)
 	node := newStorageNode(t, Config{
-		BlockTtl: "10H",
+		BlockTtl: &ttl,
 	})
 
 	if node == nil {
@@ -144,8 +145,9 @@ func TestBlockTtl(t *testing.T) {
 }
 
 func TestBlockMaintenanceInterval(t *testing.T) {
+	mi := Duration(10 * time.Hour)
 	node := newStorageNode(t, Config{
-		BlockMaintenanceInterval: "10H",
+		BlockMaintenanceInterval: &mi,
 	})
 
 	if node == nil {
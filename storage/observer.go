@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// The operation names passed to the Observer.
+const (
+	OpStart     = "start"
+	OpStop      = "stop"
+	OpDestroy   = "destroy"
+	OpRepo      = "repo"
+	OpSpr       = "spr"
+	OpPeerId    = "peer_id"
+	OpDebug     = "debug"
+	OpLogLevel  = "log_level"
+	OpPeerDebug = "peer_debug"
+	OpConnect   = "connect"
+
+	OpUploadInit     = "upload.init"
+	OpUploadChunk    = "upload.chunk"
+	OpUploadFinalize = "upload.finalize"
+	OpUploadCancel   = "upload.cancel"
+	OpUploadReader   = "upload.reader"
+	OpUploadFile     = "upload.file"
+
+	OpDownloadManifest = "download.manifest"
+	OpDownloadStream   = "download.stream"
+	OpDownloadInit     = "download.init"
+	OpDownloadChunk    = "download.chunk"
+	OpDownloadCancel   = "download.cancel"
+
+	OpManifests = "manifests"
+	OpFetch     = "fetch"
+	OpSpace     = "space"
+	OpDelete    = "delete"
+	OpExists    = "exists"
+)
+
+// The attribute names passed to the Observer.
+const (
+	AttrCid       = "cid"
+	AttrSessionId = "session_id"
+	AttrPeerId    = "peer_id"
+	AttrFilepath  = "filepath"
+
+	// AttrBytes is the number of bytes sent to or received from
+	// the library, set at the end of the operation.
+	AttrBytes = "bytes"
+
+	AttrLocal = "local"
+)
+
+// Attrs are the attributes of an operation, like its cid or session id.
+// Some attributes, like the cid of an upload or the number of bytes,
+// are only known at the end, so the map passed to OnStart can be
+// completed before OnEnd. It must not be modified by the observer.
+type Attrs map[string]any
+
+// Observer is notified of the operations of the node, to record
+// metrics or tracing spans. The methods are called synchronously,
+// from the goroutine calling the node, so they must be fast and
+// safe for concurrent use.
+//
+// The operations can be nested: UploadReader calls UploadInit,
+// UploadChunk and UploadFinalize, which are observed too.
+type Observer interface {
+	OnStart(op string, attrs Attrs)
+	OnEnd(op string, attrs Attrs, err error, duration time.Duration)
+}
+
+// SetObserver sets the observer of the node, shared by its copies.
+// A nil observer removes it.
+func (node StorageNode) SetObserver(o Observer) {
+	if o == nil {
+		node.observer.Store(nil)
+		return
+	}
+	node.observer.Store(&o)
+}
+
+// operation is an observed call, nil when the node has no observer.
+type operation struct {
+	observer Observer
+	name     string
+	attrs    Attrs
+	start    time.Time
+}
+
+// observe notifies the start of an operation. The caller must
+// call end with its error when it returns.
+func (node StorageNode) observe(name string, attrs Attrs) *operation {
+	if node.observer == nil {
+		return nil
+	}
+
+	o := node.observer.Load()
+	if o == nil {
+		return nil
+	}
+
+	if attrs == nil {
+		attrs = Attrs{}
+	}
+
+	(*o).OnStart(name, attrs)
+
+	return &operation{observer: *o, name: name, attrs: attrs, start: time.Now()}
+}
+
+// set adds an attribute known during the operation.
+func (op *operation) set(key string, value any) {
+	if op != nil {
+		op.attrs[key] = value
+	}
+}
+
+// end notifies the end of the operation, it is meant to be
+// deferred with a pointer to the named error result.
+func (op *operation) end(err *error) {
+	if op != nil {
+		op.observer.OnEnd(op.name, op.attrs, *err, time.Since(op.start))
+	}
+}
+
+// DefaultLatencyBuckets are the upper bounds of the latency
+// histograms of the MemoryObserver.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// LatencyBucket is a bucket of a latency histogram.
+type LatencyBucket struct {
+	UpperBound time.Duration
+
+	// Count is the number of operations that lasted at most
+	// UpperBound, without the ones of the previous buckets.
+	Count int64
+}
+
+// OperationStats are the statistics of an operation recorded
+// by the MemoryObserver.
+type OperationStats struct {
+	Count  int64
+	Errors int64
+
+	// InFlight is the number of operations started and not ended.
+	InFlight int64
+
+	Total time.Duration
+	Min   time.Duration
+	Max   time.Duration
+
+	// Buckets is the latency histogram. The operations lasting more
+	// than the last bound are only in Count.
+	Buckets []LatencyBucket
+
+	// Bytes is the sum of the AttrBytes attributes.
+	Bytes int64
+}
+
+// Mean returns the mean duration of the operations.
+func (s OperationStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// MemoryObserver is an Observer recording counters and latency
+// histograms per operation in memory.
+type MemoryObserver struct {
+	buckets []time.Duration
+
+	mu  sync.Mutex
+	ops map[string]*OperationStats
+}
+
+// NewMemoryObserver creates an observer with the latency bucket bounds,
+// in increasing order.
+// Default: DefaultLatencyBuckets
+func NewMemoryObserver(buckets ...time.Duration) *MemoryObserver {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+
+	return &MemoryObserver{
+		buckets: append([]time.Duration(nil), buckets...),
+		ops:     map[string]*OperationStats{},
+	}
+}
+
+func (m *MemoryObserver) stats(op string) *OperationStats {
+	s, ok := m.ops[op]
+	if !ok {
+		s = &OperationStats{Buckets: make([]LatencyBucket, len(m.buckets))}
+		for i, b := range m.buckets {
+			s.Buckets[i].UpperBound = b
+		}
+		m.ops[op] = s
+	}
+	return s
+}
+
+func (m *MemoryObserver) OnStart(op string, attrs Attrs) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stats(op).InFlight++
+}
+
+func (m *MemoryObserver) OnEnd(op string, attrs Attrs, err error, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stats(op)
+	s.InFlight--
+	s.Count++
+	s.Total += duration
+
+	if err != nil {
+		s.Errors++
+	}
+
+	if s.Count == 1 || duration < s.Min {
+		s.Min = duration
+	}
+
+	if duration > s.Max {
+		s.Max = duration
+	}
+
+	for i := range s.Buckets {
+		if duration <= s.Buckets[i].UpperBound {
+			s.Buckets[i].Count++
+			break
+		}
+	}
+
+	if n, ok := attrs[AttrBytes].(int); ok {
+		s.Bytes += int64(n)
+	}
+}
+
+// Stats returns the statistics of an operation.
+func (m *MemoryObserver) Stats(op string) (OperationStats, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.ops[op]
+	if !ok {
+		return OperationStats{}, false
+	}
+
+	return s.clone(), true
+}
+
+// All returns the statistics of all the operations, by name.
+func (m *MemoryObserver) All() map[string]OperationStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := make(map[string]OperationStats, len(m.ops))
+	for op, s := range m.ops {
+		all[op] = s.clone()
+	}
+	return all
+}
+
+// Reset clears the statistics.
+func (m *MemoryObserver) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ops = map[string]*OperationStats{}
+}
+
+func (s *OperationStats) clone() OperationStats {
+	c := *s
+	c.Buckets = append([]LatencyBucket(nil), s.Buckets...)
+	return c
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type recordingObserver struct {
+	events []string
+	attrs  Attrs
+	err    error
+}
+
+func (r *recordingObserver) OnStart(op string, attrs Attrs) {
+	r.events = append(r.events, "start "+op)
+}
+
+func (r *recordingObserver) OnEnd(op string, attrs Attrs, err error, duration time.Duration) {
+	r.events = append(r.events, "end "+op)
+	r.attrs, r.err = attrs, err
+}
+
+func TestObserve(t *testing.T) {
+	node := StorageNode{observer: &atomic.Pointer[Observer]{}}
+
+	// Without observer, the operation is a no-op
+	err := errors.New("failed")
+	op := node.observe(OpDelete, Attrs{AttrCid: "cid"})
+	op.set(AttrBytes, 1)
+	op.end(&err)
+
+	recorder := &recordingObserver{}
+	node.SetObserver(recorder)
+
+	func() (err error) {
+		op := node.observe(OpUploadFinalize, Attrs{AttrSessionId: "session"})
+		defer op.end(&err)
+
+		op.set(AttrCid, "cid")
+		return errors.New("failed")
+	}()
+
+	if len(recorder.events) != 2 || recorder.events[0] != "start upload.finalize" || recorder.events[1] != "end upload.finalize" {
+		t.Fatalf("unexpected events %v", recorder.events)
+	}
+
+	if recorder.attrs[AttrCid] != "cid" || recorder.attrs[AttrSessionId] != "session" || recorder.err == nil {
+		t.Fatalf("unexpected end %v %v", recorder.attrs, recorder.err)
+	}
+
+	node.SetObserver(nil)
+	if op := node.observe(OpDelete, nil); op != nil {
+		t.Fatal("expected the observer to be removed")
+	}
+}
+
+func TestMemoryObserver(t *testing.T) {
+	m := NewMemoryObserver(10*time.Millisecond, time.Second)
+
+	m.OnStart(OpUploadChunk, nil)
+	m.OnStart(OpUploadChunk, nil)
+	m.OnEnd(OpUploadChunk, Attrs{AttrBytes: 100}, nil, 5*time.Millisecond)
+	m.OnEnd(OpUploadChunk, Attrs{AttrBytes: 50}, errors.New("failed"), 500*time.Millisecond)
+	m.OnStart(OpUploadChunk, nil)
+	m.OnEnd(OpUploadChunk, Attrs{}, nil, 2*time.Second)
+
+	s, ok := m.Stats(OpUploadChunk)
+	if !ok {
+		t.Fatal("expected stats")
+	}
+
+	if s.Count != 3 || s.Errors != 1 || s.InFlight != 0 || s.Bytes != 150 {
+		t.Fatalf("unexpected counters %+v", s)
+	}
+
+	if s.Min != 5*time.Millisecond || s.Max != 2*time.Second || s.Mean() != 835*time.Millisecond {
+		t.Fatalf("unexpected latencies %+v", s)
+	}
+
+	if s.Buckets[0].Count != 1 || s.Buckets[1].Count != 1 {
+		t.Fatalf("unexpected histogram %+v", s.Buckets)
+	}
+
+	if _, ok := m.Stats(OpDelete); ok {
+		t.Fatal("expected no stats for an operation not observed")
+	}
+
+	m.Reset()
+	if len(m.All()) != 0 {
+		t.Fatal("expected the stats to be cleared")
+	}
+}
+
+func TestNodeObserver(t *testing.T) {
+	node := newStorageNode(t)
+
+	observer := NewMemoryObserver()
+	node.SetObserver(observer)
+
+	data := []byte("Hello World!")
+	cid, err := node.UploadReader(context.Background(), UploadOptions{Filepath: "hello.txt"}, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := node.DownloadStream(context.Background(), cid, DownloadStreamOptions{Writer: &buf, Local: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := node.Exists(cid); err != nil {
+		t.Fatal(err)
+	}
+
+	for op, count := range map[string]int64{
+		OpUploadReader:   1,
+		OpUploadInit:     1,
+		OpUploadChunk:    1,
+		OpUploadFinalize: 1,
+		OpDownloadStream: 1,
+		OpExists:         1,
+	} {
+		s, _ := observer.Stats(op)
+		if s.Count != count || s.Errors != 0 {
+			t.Fatalf("expected %d %s without error, got %+v", count, op, s)
+		}
+	}
+
+	if s, _ := observer.Stats(OpDownloadStream); s.Bytes != int64(len(data)) {
+		t.Fatalf("expected %d bytes downloaded, got %d", len(data), s.Bytes)
+	}
+}
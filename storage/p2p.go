@@ -10,6 +10,7 @@ package storage
 */
 import "C"
 import (
+	"errors"
 	"unsafe"
 )
 
@@ -19,7 +20,10 @@ import (
 // the returned addresses will be used to dial.
 // `peerAddresses` the listening addresses of the peers to dial,
 // eg the one specified with `ListenAddresses` in `StorageConfig`.
-func (node StorageNode) Connect(peerId string, peerAddresses []string) error {
+func (node StorageNode) Connect(peerId string, peerAddresses []string) (err error) {
+	op := node.observe(OpConnect, Attrs{AttrPeerId: peerId})
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -42,6 +46,22 @@ func (node StorageNode) Connect(peerId string, peerAddresses []string) error {
 		}
 	}
 
-	_, err := bridge.wait()
+	_, err = bridge.wait()
 	return err
 }
+
+// ConnectPeer is like Connect with a typed peer id and multiaddrs,
+// which are validated before calling the library.
+func (node StorageNode) ConnectPeer(peerId PeerID, addrs ...Multiaddr) error {
+	if err := peerId.Validate(); err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		if addr.IsZero() {
+			return errors.New("empty multiaddr")
+		}
+	}
+
+	return node.Connect(peerId.String(), MultiaddrStrings(addrs))
+}
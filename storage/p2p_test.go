@@ -1,64 +1,51 @@
 package storage
 
 import (
-	"log"
 	"testing"
+	"time"
 )
 
-func TestConnectWithAddress(t *testing.T) {
-	var node1, node2 *StorageNode
-	var err error
-
-	t.Cleanup(func() {
-		if node1 != nil {
-			if err := node1.Stop(); err != nil {
-				t.Logf("cleanup storage1: %v", err)
-			}
-
-			if err := node1.Destroy(); err != nil {
-				t.Logf("cleanup storage1: %v", err)
-			}
-		}
-
-		if node2 != nil {
-			if err := node2.Stop(); err != nil {
-				t.Logf("cleanup storage2: %v", err)
-			}
+// waitConnectedPeers waits until the node is connected to at least
+// n peers, read from the libp2p_peers metric.
+func waitConnectedPeers(t *testing.T, node *StorageNode, n int) {
+	t.Helper()
 
-			if err := node2.Destroy(); err != nil {
-				t.Logf("cleanup storage2: %v", err)
-			}
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		peers, err := node.connectedPeers(time.Second)
+		if err == nil && peers >= n {
+			return
 		}
-	})
 
-	node1, err = New(Config{
-		DataDir:        t.TempDir(),
-		LogFormat:      LogFormatNoColors,
-		MetricsEnabled: false,
-		DiscoveryPort:  8090,
-		Nat:            "none",
-	})
-	if err != nil {
-		t.Fatalf("Failed to create Logos Storage node 1: %v", err)
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d connected peers, got %d %v", n, peers, err)
+		}
+		time.Sleep(100 * time.Millisecond)
 	}
+}
 
-	if err := node1.Start(); err != nil {
-		t.Fatalf("Failed to start Logos Storage node 1: %v", err)
-	}
+// waitRoutingTable waits until the peer is in the routing table
+// of the node, like storagetest.NewCluster.
+func waitRoutingTable(t *testing.T, node *StorageNode, peerId string) {
+	t.Helper()
 
-	node2, err = New(Config{
-		DataDir:        t.TempDir(),
-		LogFormat:      LogFormatNoColors,
-		MetricsEnabled: false,
-		DiscoveryPort:  8091,
-	})
-	if err != nil {
-		t.Fatalf("Failed to create Logos Storage node 2: %v", err)
-	}
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		info, err := node.Debug()
+		if err == nil && inRoutingTable(info, peerId) {
+			return
+		}
 
-	if err := node2.Start(); err != nil {
-		t.Fatalf("Failed to start Logos Storage node 2: %v", err)
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s in the routing table, got %+v %v", peerId, info.PeersTable, err)
+		}
+		time.Sleep(100 * time.Millisecond)
 	}
+}
+
+func TestConnectWithAddress(t *testing.T) {
+	node1 := newStorageNode(t, Config{MetricsEnabled: true})
+	node2 := newStorageNode(t, Config{MetricsEnabled: true})
 
 	info2, err := node2.Debug()
 	if err != nil {
@@ -68,15 +55,13 @@ func TestConnectWithAddress(t *testing.T) {
 	if err := node1.Connect(info2.ID, info2.Addrs); err != nil {
 		t.Fatalf("connect failed: %v", err)
 	}
+
+	waitConnectedPeers(t, node1, 1)
+	waitConnectedPeers(t, node2, 1)
 }
 
 func TestStorageWithPeerId(t *testing.T) {
-	var bootstrap, node1, node2 *StorageNode
-	var err error
-
-	bootstrap = newStorageNode(t, Config{
-		DiscoveryPort: 8092,
-	})
+	bootstrap := newStorageNode(t)
 
 	spr, err := bootstrap.Spr()
 	if err != nil {
@@ -85,13 +70,11 @@ func TestStorageWithPeerId(t *testing.T) {
 
 	bootstrapNodes := []string{spr}
 
-	node1 = newStorageNode(t, Config{
-		DiscoveryPort:  8090,
+	node1 := newStorageNode(t, Config{
 		BootstrapNodes: bootstrapNodes,
 	})
 
-	node2 = newStorageNode(t, Config{
-		DiscoveryPort:  8091,
+	node2 := newStorageNode(t, Config{
 		BootstrapNodes: bootstrapNodes,
 	})
 
@@ -100,7 +83,10 @@ func TestStorageWithPeerId(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	// Without addresses, the peer is found by the discovery
+	waitRoutingTable(t, node1, peerId)
+
 	if err := node1.Connect(peerId, []string{}); err != nil {
-		log.Println(err)
+		t.Fatalf("connect failed: %v", err)
 	}
 }
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// multihashIdentity embeds the public key when it is small enough,
+	// like the secp256k1 keys of the storage nodes.
+	multihashIdentity = 0x00
+
+	multihashSha256 = 0x12
+)
+
+// PeerID is the base58 encoded multihash of the public key of a peer,
+// like 16Uiu2HAm...
+type PeerID string
+
+// ParsePeerID parses and validates a peer id.
+func ParsePeerID(s string) (PeerID, error) {
+	id := PeerID(s)
+	if err := id.Validate(); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Validate checks that the peer id is a base58 encoded identity
+// or sha2-256 multihash.
+func (id PeerID) Validate() error {
+	if id == "" {
+		return errors.New("empty peer id")
+	}
+
+	data, err := base58Decode(string(id))
+	if err != nil {
+		return fmt.Errorf("invalid peer id %q: %w", string(id), err)
+	}
+
+	code, digest, err := decodeMultihash(data)
+	if err != nil {
+		return fmt.Errorf("invalid peer id %q: %w", string(id), err)
+	}
+
+	switch code {
+	case multihashIdentity:
+	case multihashSha256:
+		if len(digest) != 32 {
+			return fmt.Errorf("invalid peer id %q: sha2-256 digest of %d bytes", string(id), len(digest))
+		}
+	default:
+		return fmt.Errorf("invalid peer id %q: unsupported multihash 0x%x", string(id), code)
+	}
+
+	return nil
+}
+
+func (id PeerID) String() string {
+	return string(id)
+}
+
+// Multihash returns the decoded multihash of the peer id.
+func (id PeerID) Multihash() ([]byte, error) {
+	if err := id.Validate(); err != nil {
+		return nil, err
+	}
+	return base58Decode(string(id))
+}
+
+// PublicKey returns the protobuf encoded public key embedded
+// in an identity peer id.
+func (id PeerID) PublicKey() ([]byte, bool) {
+	data, err := base58Decode(string(id))
+	if err != nil {
+		return nil, false
+	}
+
+	code, digest, err := decodeMultihash(data)
+	if err != nil || code != multihashIdentity {
+		return nil, false
+	}
+
+	return digest, true
+}
+
+func decodeMultihash(data []byte) (uint64, []byte, error) {
+	code, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, nil, errors.New("invalid multihash code")
+	}
+	data = data[n:]
+
+	length, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, nil, errors.New("invalid multihash length")
+	}
+	data = data[n:]
+
+	if uint64(len(data)) != length {
+		return 0, nil, fmt.Errorf("multihash length %d does not match the digest of %d bytes", length, len(data))
+	}
+
+	return code, data, nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func base58Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+
+	for i := 0; i < len(s); i++ {
+		v := -1
+		for j := 0; j < len(base58Alphabet); j++ {
+			if base58Alphabet[j] == s[i] {
+				v = j
+				break
+			}
+		}
+
+		if v < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", s[i])
+		}
+
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(v)))
+	}
+
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testPeerID returns an identity peer id for a fake secp256k1 public key.
+func testPeerID(t *testing.T, seed byte) PeerID {
+	t.Helper()
+
+	pub := append([]byte{0x08, 0x02, 0x12, 0x21, 0x02}, bytes.Repeat([]byte{seed}, 32)...)
+	data := binary.AppendUvarint(nil, multihashIdentity)
+	data = binary.AppendUvarint(data, uint64(len(pub)))
+
+	return PeerID(base58Encode(append(data, pub...)))
+}
+
+func TestBase58(t *testing.T) {
+	for _, data := range [][]byte{{}, {0}, {0, 0, 1}, []byte("hello world"), bytes.Repeat([]byte{0xff}, 40)} {
+		decoded, err := base58Decode(base58Encode(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(decoded, data) {
+			t.Fatalf("expected %x, got %x", data, decoded)
+		}
+	}
+
+	if base58Encode([]byte("hello world")) != "StV1DL6CwTryKyV" {
+		t.Fatalf("unexpected encoding %s", base58Encode([]byte("hello world")))
+	}
+
+	if _, err := base58Decode("0OIl"); err == nil {
+		t.Fatal("expected an error for characters outside of the alphabet")
+	}
+}
+
+func TestParsePeerID(t *testing.T) {
+	id := testPeerID(t, 1)
+	if id[:8] != "16Uiu2HA" {
+		t.Fatalf("expected a secp256k1 peer id, got %s", id)
+	}
+
+	if _, err := ParsePeerID(id.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	if pub, ok := id.PublicKey(); !ok || len(pub) != 37 {
+		t.Fatalf("expected the public key to be embedded, got %x", pub)
+	}
+
+	if _, err := ParsePeerID("QmYyQSo1c1Ym7orWxLYvCrM2EmxFTANf8wXmmE7DWjhx5N"); err != nil {
+		t.Fatalf("expected a sha2-256 peer id to be valid: %v", err)
+	}
+
+	for _, s := range []string{"", "not a peer id", id.String()[:20], "StV1DL6CwTryKyV"} {
+		if _, err := ParsePeerID(s); err == nil {
+			t.Fatalf("expected an error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrPeerManagerClosed is returned when a peer is added to a closed manager.
+var ErrPeerManagerClosed = errors.New("peer manager closed")
+
+// PeerTarget is a peer that the PeerManager keeps connected.
+type PeerTarget struct {
+	PeerId string
+
+	// Addrs are the multiaddrs used to dial the peer. If empty,
+	// the peer is found with the discovery, see Connect.
+	Addrs []string
+
+	// Spr is a signed peer record of the peer, used for the peer id
+	// and the addresses when they are not set. It is verified with
+	// ParseSPR, and its peer id must match PeerId if both are set.
+	Spr string
+}
+
+type PeerState string
+
+const (
+	// PeerConnecting means that the connection is being attempted.
+	PeerConnecting PeerState = "connecting"
+
+	// PeerConnected means that the peer was dialed and is
+	// present in the routing table.
+	PeerConnected PeerState = "connected"
+
+	// PeerDisconnected means that the last attempt failed or that the
+	// peer left the routing table, a new attempt is scheduled.
+	PeerDisconnected PeerState = "disconnected"
+)
+
+// PeerStatus is the connection status of a managed peer.
+type PeerStatus struct {
+	Target PeerTarget
+	State  PeerState
+
+	// Attempts is the number of failed attempts since the last connection.
+	Attempts int
+
+	// LastError is the error of the last failed attempt.
+	LastError error
+
+	LastAttempt time.Time
+	ConnectedAt time.Time
+
+	// NextAttempt is the time of the next attempt when disconnected.
+	NextAttempt time.Time
+}
+
+const (
+	defaultPeerCheckInterval = 30 * time.Second
+	defaultPeerMinBackoff    = time.Second
+	defaultPeerMaxBackoff    = 5 * time.Minute
+	defaultPeerJitter        = 0.2
+)
+
+type PeerManagerOptions struct {
+	// CheckInterval is the time between two checks of the routing
+	// table for a connected peer.
+	// Default: 30 seconds
+	CheckInterval time.Duration
+
+	// MinBackoff is the delay after the first failed attempt,
+	// doubled after each failure up to MaxBackoff.
+	// Default: 1 second
+	MinBackoff time.Duration
+
+	// Default: 5 minutes
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction of the backoff randomly added or
+	// removed, so the peers do not reconnect all at once.
+	// Default: 0.2
+	Jitter float64
+
+	// OnStatus is a callback function called when the status
+	// of a peer changes.
+	OnStatus func(status PeerStatus)
+}
+
+// PeerManager keeps a set of peers connected to the node.
+// Each peer is dialed concurrently with Connect, then the connection is
+// verified with the routing table returned by Debug. When an attempt
+// fails or the peer leaves the routing table, it is reconnected with an
+// exponential backoff.
+//
+// The manager is closed when the node is stopped.
+type PeerManager struct {
+	node    StorageNode
+	options PeerManagerOptions
+
+	ctx          context.Context
+	cancel       context.CancelFunc
+	removeOnStop func()
+
+	mu    sync.Mutex
+	peers map[string]*managedPeer
+	wg    sync.WaitGroup
+}
+
+type managedPeer struct {
+	status PeerStatus
+	cancel context.CancelFunc
+}
+
+// NewPeerManager creates a peer manager for the node.
+func NewPeerManager(node *StorageNode, options PeerManagerOptions) (*PeerManager, error) {
+	if options.CheckInterval <= 0 {
+		options.CheckInterval = defaultPeerCheckInterval
+	}
+
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = defaultPeerMinBackoff
+	}
+
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = defaultPeerMaxBackoff
+	}
+
+	if options.MaxBackoff < options.MinBackoff {
+		return nil, fmt.Errorf("max backoff %v is below the min backoff %v", options.MaxBackoff, options.MinBackoff)
+	}
+
+	if options.Jitter == 0 {
+		options.Jitter = defaultPeerJitter
+	}
+
+	if options.Jitter < 0 || options.Jitter > 1 {
+		return nil, fmt.Errorf("jitter %v must be between 0 and 1", options.Jitter)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m := &PeerManager{
+		node:    *node,
+		options: options,
+		ctx:     ctx,
+		cancel:  cancel,
+		peers:   map[string]*managedPeer{},
+	}
+
+	m.removeOnStop = node.onStop(m.close)
+
+	return m, nil
+}
+
+// Add adds a peer to keep connected, or replaces its addresses
+// if it is already managed.
+func (m *PeerManager) Add(target PeerTarget) error {
+	if target.Spr != "" {
+		spr, err := ParseSPR(target.Spr)
+		if err != nil {
+			return err
+		}
+
+		if target.PeerId == "" {
+			target.PeerId = spr.PeerID.String()
+		} else if target.PeerId != spr.PeerID.String() {
+			return fmt.Errorf("peer id %s does not match the record of %s", target.PeerId, spr.PeerID)
+		}
+
+		if len(target.Addrs) == 0 {
+			target.Addrs = MultiaddrStrings(spr.Addrs)
+		}
+	}
+
+	if target.PeerId == "" {
+		return errors.New("missing peer id")
+	}
+
+	for _, addr := range target.Addrs {
+		if err := validateMultiaddr(addr); err != nil {
+			return err
+		}
+	}
+
+	target.Addrs = slices.Clone(target.Addrs)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ctx.Err() != nil {
+		return ErrPeerManagerClosed
+	}
+
+	if p, ok := m.peers[target.PeerId]; ok {
+		p.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	p := &managedPeer{
+		status: PeerStatus{Target: target, State: PeerConnecting},
+		cancel: cancel,
+	}
+	m.peers[target.PeerId] = p
+
+	m.wg.Add(1)
+	go m.run(ctx, p)
+
+	return nil
+}
+
+// Remove stops managing a peer. The current connection is not closed.
+func (m *PeerManager) Remove(peerId string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if p, ok := m.peers[peerId]; ok {
+		p.cancel()
+		delete(m.peers, peerId)
+	}
+}
+
+// Status returns the status of a managed peer.
+func (m *PeerManager) Status(peerId string) (PeerStatus, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.peers[peerId]
+	if !ok {
+		return PeerStatus{}, false
+	}
+
+	return p.status, true
+}
+
+// Statuses returns the status of all the managed peers, by peer id.
+func (m *PeerManager) Statuses() []PeerStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]PeerStatus, 0, len(m.peers))
+	for _, p := range m.peers {
+		statuses = append(statuses, p.status)
+	}
+
+	slices.SortFunc(statuses, func(a, b PeerStatus) int {
+		return strings.Compare(a.Target.PeerId, b.Target.PeerId)
+	})
+
+	return statuses
+}
+
+// Close stops the reconnections and waits for the pending attempts.
+func (m *PeerManager) Close() {
+	m.removeOnStop()
+	m.close()
+}
+
+func (m *PeerManager) close() {
+	m.mu.Lock()
+	m.cancel()
+	m.mu.Unlock()
+
+	m.wg.Wait()
+}
+
+func (m *PeerManager) run(ctx context.Context, p *managedPeer) {
+	defer m.wg.Done()
+
+	target := p.status.Target
+
+	for {
+		if err := m.connect(ctx, p, target); err != nil {
+			wait := peerBackoff(m.attempts(p), m.options, rand.Float64)
+
+			m.update(ctx, p, func(s *PeerStatus) {
+				s.NextAttempt = time.Now().Add(wait)
+			})
+
+			if !sleep(ctx, wait) {
+				return
+			}
+
+			continue
+		}
+
+		// A connected peer is only checked, it is dialed
+		// again when it left the routing table.
+		for {
+			if !sleep(ctx, m.options.CheckInterval) {
+				return
+			}
+
+			if err := m.verify(target.PeerId); err != nil {
+				m.update(ctx, p, func(s *PeerStatus) {
+					s.State = PeerDisconnected
+					s.LastError = err
+				})
+				break
+			}
+		}
+	}
+}
+
+// connect dials the peer and checks the routing table.
+func (m *PeerManager) connect(ctx context.Context, p *managedPeer, target PeerTarget) error {
+	m.update(ctx, p, func(s *PeerStatus) {
+		s.State = PeerConnecting
+		s.LastAttempt = time.Now()
+		s.NextAttempt = time.Time{}
+	})
+
+	err := m.node.Connect(target.PeerId, target.Addrs)
+	if err == nil {
+		err = m.verify(target.PeerId)
+	}
+
+	m.update(ctx, p, func(s *PeerStatus) {
+		if err != nil {
+			s.State = PeerDisconnected
+			s.Attempts++
+			s.LastError = err
+			return
+		}
+
+		s.State = PeerConnected
+		s.Attempts = 0
+		s.ConnectedAt = time.Now()
+	})
+
+	return err
+}
+
+// sleep waits for the duration and returns false
+// if the context is done before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (m *PeerManager) verify(peerId string) error {
+	info, err := m.node.Debug()
+	if err != nil {
+		return err
+	}
+
+	if !inRoutingTable(info, peerId) {
+		return fmt.Errorf("peer %s is not in the routing table", peerId)
+	}
+
+	return nil
+}
+
+func (m *PeerManager) attempts(p *managedPeer) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return p.status.Attempts
+}
+
+// update changes the status of a peer still managed
+// and calls OnStatus.
+func (m *PeerManager) update(ctx context.Context, p *managedPeer, fn func(s *PeerStatus)) {
+	m.mu.Lock()
+
+	if ctx.Err() != nil {
+		m.mu.Unlock()
+		return
+	}
+
+	fn(&p.status)
+	status := p.status
+	m.mu.Unlock()
+
+	if m.options.OnStatus != nil {
+		m.options.OnStatus(status)
+	}
+}
+
+// inRoutingTable returns true if the peer is a node of the routing table.
+func inRoutingTable(info DebugInfo, peerId string) bool {
+	for _, n := range info.PeersTable.Nodes {
+		if n.PeerId == peerId {
+			return true
+		}
+	}
+	return false
+}
+
+// peerBackoff returns the delay before the next attempt after the
+// given number of failed attempts.
+func peerBackoff(attempts int, options PeerManagerOptions, random func() float64) time.Duration {
+	d := options.MinBackoff
+	for i := 1; i < attempts && d < options.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, options.MaxBackoff)
+
+	jitter := float64(d) * options.Jitter * (2*random() - 1)
+	return max(d+time.Duration(jitter), 0)
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPeerBackoff(t *testing.T) {
+	options := PeerManagerOptions{MinBackoff: time.Second, MaxBackoff: 10 * time.Second, Jitter: 0.5}
+	middle := func() float64 { return 0.5 }
+
+	expected := []time.Duration{time.Second, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for attempts, d := range expected {
+		if got := peerBackoff(attempts, options, middle); got != d {
+			t.Fatalf("attempt %d: expected %v, got %v", attempts, d, got)
+		}
+	}
+
+	if got := peerBackoff(1, options, func() float64 { return 1 }); got != 1500*time.Millisecond {
+		t.Fatalf("expected the jitter to add 50%%, got %v", got)
+	}
+
+	if got := peerBackoff(1, options, func() float64 { return 0 }); got != 500*time.Millisecond {
+		t.Fatalf("expected the jitter to remove 50%%, got %v", got)
+	}
+}
+
+func TestInRoutingTable(t *testing.T) {
+	info := DebugInfo{PeersTable: RoutingTable{Nodes: []Node{{PeerId: "a"}, {PeerId: "b"}}}}
+
+	if !inRoutingTable(info, "b") || inRoutingTable(info, "c") {
+		t.Fatal("unexpected routing table lookup")
+	}
+}
+
+func TestPeerManager(t *testing.T) {
+	peer := newStorageNode(t)
+
+	spr, err := peer.Spr()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := peer.Debug()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := newStorageNode(t, Config{BootstrapNodes: []string{spr}})
+
+	manager, err := NewPeerManager(node, PeerManagerOptions{CheckInterval: 100 * time.Millisecond, MinBackoff: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	if err := manager.Add(PeerTarget{PeerId: info.ID, Addrs: []string{"not-a-multiaddr"}}); err == nil {
+		t.Fatal("expected an error for an invalid multiaddr")
+	}
+
+	if err := manager.Add(PeerTarget{PeerId: info.ID, Addrs: info.Addrs}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status, ok := manager.Status(info.ID)
+		if !ok {
+			t.Fatal("expected the peer to be managed")
+		}
+
+		if status.State == PeerConnected {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the peer to be connected, got %+v", status)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	manager.Remove(info.ID)
+	if len(manager.Statuses()) != 0 {
+		t.Fatal("expected no managed peer after remove")
+	}
+
+	if err := node.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manager.Add(PeerTarget{PeerId: info.ID}); !errors.Is(err, ErrPeerManagerClosed) {
+		t.Fatalf("expected the manager to be closed by Stop, got %v", err)
+	}
+}
+
+func TestPeerManagerSprTarget(t *testing.T) {
+	m, err := NewPeerManager(&StorageNode{stops: newStopHooks()}, PeerManagerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Closed, so the targets are resolved without being dialed
+	m.Close()
+
+	if err := m.Add(PeerTarget{Spr: testnetSPR}); !errors.Is(err, ErrPeerManagerClosed) {
+		t.Fatalf("expected the record to provide the peer id, got %v", err)
+	}
+
+	if err := m.Add(PeerTarget{PeerId: "16Uiu2HAmOther", Spr: testnetSPR}); err == nil || errors.Is(err, ErrPeerManagerClosed) {
+		t.Fatalf("expected a peer id mismatch, got %v", err)
+	}
+
+	if err := m.Add(PeerTarget{Spr: "spr:invalid"}); err == nil || errors.Is(err, ErrPeerManagerClosed) {
+		t.Fatalf("expected an invalid record error, got %v", err)
+	}
+}
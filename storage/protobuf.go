@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	protoVarint = 0
+	protoBytes  = 2
+)
+
+// protoField is a field of a protobuf message.
+// Only the varint and length-delimited wire types are supported,
+// which is enough for the libp2p records and keys.
+type protoField struct {
+	num    int
+	wire   int
+	varint uint64
+	bytes  []byte
+}
+
+func decodeProto(data []byte) ([]protoField, error) {
+	var fields []protoField
+
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid protobuf field key")
+		}
+		data = data[n:]
+
+		f := protoField{num: int(key >> 3), wire: int(key & 7)}
+
+		switch f.wire {
+		case protoVarint:
+			f.varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid protobuf varint for field %d", f.num)
+			}
+			data = data[n:]
+		case protoBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, fmt.Errorf("invalid protobuf length for field %d", f.num)
+			}
+			f.bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d for field %d", f.wire, f.num)
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+func appendProtoVarint(b []byte, num int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|protoVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendProtoBytes(b []byte, num int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|protoBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
@@ -0,0 +1,407 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRendezvousInterval = 30 * time.Second
+	defaultRendezvousExpiry   = 2 * time.Minute
+
+	rendezvousExt = ".json"
+)
+
+// RendezvousEntry is the file published by a node in a rendezvous directory.
+type RendezvousEntry struct {
+	PeerId string   `json:"peerId"`
+	Spr    string   `json:"spr"`
+	Addrs  []string `json:"addrs,omitempty"`
+
+	// Heartbeat is the last time the node refreshed its entry.
+	Heartbeat time.Time `json:"heartbeat"`
+}
+
+// Stale returns true if the heartbeat is older than maxAge.
+func (e RendezvousEntry) Stale(maxAge time.Duration, now time.Time) bool {
+	return now.Sub(e.Heartbeat) > maxAge
+}
+
+// validate checks that the record is signed by the peer of the entry.
+func (e RendezvousEntry) validate() error {
+	spr, err := ParseSPR(e.Spr)
+	if err != nil {
+		return err
+	}
+
+	if spr.PeerID.String() != e.PeerId {
+		return fmt.Errorf("peer id %s does not match the record of %s", e.PeerId, spr.PeerID)
+	}
+
+	return nil
+}
+
+// RendezvousScan is the result of a scan of the rendezvous directory.
+type RendezvousScan struct {
+	Time time.Time
+
+	// Added are the peers found since the previous scan,
+	// or whose record changed.
+	Added []RendezvousEntry
+
+	// Expired are the peer ids whose heartbeat is older than the expiry.
+	Expired []string
+
+	// Invalid maps the files that cannot be used to their error.
+	Invalid map[string]error
+}
+
+type RendezvousOptions struct {
+	// Interval is the interval between two heartbeats,
+	// and two scans of the directory.
+	// Default: 30 seconds
+	Interval time.Duration
+
+	// Expiry is the age of the heartbeat after which an entry is
+	// ignored, and its peer is no longer reconnected. It must be
+	// greater than the interval.
+	// Default: 2 minutes
+	Expiry time.Duration
+
+	// Peers configures the PeerManager connecting to the entries.
+	Peers PeerManagerOptions
+
+	// OnScan is a callback function called after each scan.
+	OnScan func(scan RendezvousScan, err error)
+}
+
+// Rendezvous lets the nodes of a network without stable bootstrap node
+// find each other through a shared directory, like an NFS share or a
+// mounted volume. Each node publishes its SPR, peer id and listen
+// addresses in <dir>/<peerId>.json with a heartbeat, and keeps the
+// fresh entries of the other nodes connected with a PeerManager.
+type Rendezvous struct {
+	node    StorageNode
+	dir     string
+	options RendezvousOptions
+	peers   *PeerManager
+
+	// known maps the peer ids connected by the rendezvous to their record.
+	known map[string]string
+}
+
+// NewRendezvous creates a rendezvous for the node in the directory,
+// which is created if needed.
+func NewRendezvous(node *StorageNode, dir string, options RendezvousOptions) (*Rendezvous, error) {
+	if options.Interval <= 0 {
+		options.Interval = defaultRendezvousInterval
+	}
+
+	if options.Expiry <= 0 {
+		options.Expiry = defaultRendezvousExpiry
+	}
+
+	if options.Expiry <= options.Interval {
+		return nil, fmt.Errorf("expiry %v must be greater than the interval %v", options.Expiry, options.Interval)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	peers, err := NewPeerManager(node, options.Peers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Rendezvous{
+		node:    *node,
+		dir:     dir,
+		options: options,
+		peers:   peers,
+		known:   map[string]string{},
+	}, nil
+}
+
+// Peers returns the manager of the connections to the entries.
+func (r *Rendezvous) Peers() *PeerManager {
+	return r.peers
+}
+
+// Run publishes the entry of the node and scans the directory every
+// interval until the context is done. The entry is then removed
+// and the peer manager closed. It returns the context error.
+func (r *Rendezvous) Run(ctx context.Context) error {
+	defer r.peers.Close()
+
+	ticker := time.NewTicker(r.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		var scan RendezvousScan
+		err := r.Publish()
+		if err == nil {
+			scan, err = r.Scan()
+		}
+
+		if r.options.OnScan != nil {
+			r.options.OnScan(scan, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), r.Unpublish())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Publish writes the entry of the node with a new heartbeat.
+func (r *Rendezvous) Publish() error {
+	info, err := r.node.Debug()
+	if err != nil {
+		return err
+	}
+
+	return WriteRendezvousEntry(r.dir, RendezvousEntry{
+		PeerId:    info.ID,
+		Spr:       info.Spr,
+		Addrs:     info.Addrs,
+		Heartbeat: time.Now(),
+	})
+}
+
+// Unpublish removes the entry of the node, so the other nodes
+// stop connecting to it before its expiry.
+func (r *Rendezvous) Unpublish() error {
+	peerId, err := r.node.PeerId()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(rendezvousPath(r.dir, peerId))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// Scan reads the directory, adds the new entries to the peer manager
+// and removes the expired ones. The entries that cannot be read or are
+// rejected by the peer manager are reported in Invalid.
+func (r *Rendezvous) Scan() (RendezvousScan, error) {
+	now := time.Now()
+
+	peerId, err := r.node.PeerId()
+	if err != nil {
+		return RendezvousScan{Time: now}, err
+	}
+
+	entries, invalid, err := readRendezvousDir(r.dir)
+	if err != nil {
+		return RendezvousScan{Time: now}, err
+	}
+
+	entries = slices.DeleteFunc(entries, func(e RendezvousEntry) bool {
+		return e.PeerId == peerId
+	})
+
+	scan := diffRendezvous(r.known, entries, r.options.Expiry, now)
+	scan.Invalid = invalid
+
+	for _, id := range scan.Expired {
+		r.peers.Remove(id)
+		delete(r.known, id)
+	}
+
+	err = r.addPeers(&scan)
+	return scan, err
+}
+
+// addPeers adds the new peers of the scan to the peer manager. An entry
+// rejected by the peer manager is moved to the invalid ones, and tried
+// again at the next scan.
+func (r *Rendezvous) addPeers(scan *RendezvousScan) error {
+	added := scan.Added[:0]
+	for _, e := range scan.Added {
+		err := r.peers.Add(PeerTarget{PeerId: e.PeerId, Addrs: e.Addrs, Spr: e.Spr})
+		if errors.Is(err, ErrPeerManagerClosed) {
+			return err
+		}
+
+		if err != nil {
+			scan.Invalid[e.PeerId+rendezvousExt] = err
+			continue
+		}
+
+		r.known[e.PeerId] = e.Spr
+		added = append(added, e)
+	}
+	scan.Added = added
+
+	return nil
+}
+
+// diffRendezvous compares the fresh entries with the known peers.
+func diffRendezvous(known map[string]string, entries []RendezvousEntry, expiry time.Duration, now time.Time) RendezvousScan {
+	scan := RendezvousScan{Time: now}
+	fresh := map[string]struct{}{}
+
+	for _, e := range entries {
+		if e.Stale(expiry, now) {
+			continue
+		}
+		fresh[e.PeerId] = struct{}{}
+
+		if spr, ok := known[e.PeerId]; !ok || spr != e.Spr {
+			scan.Added = append(scan.Added, e)
+		}
+	}
+
+	for id := range known {
+		if _, ok := fresh[id]; !ok {
+			scan.Expired = append(scan.Expired, id)
+		}
+	}
+	slices.Sort(scan.Expired)
+
+	return scan
+}
+
+// WriteRendezvousEntry writes the entry in the directory. The file is
+// replaced atomically, so the readers never see a partial entry.
+func WriteRendezvousEntry(dir string, entry RendezvousEntry) error {
+	if err := entry.validate(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+entry.PeerId+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), rendezvousPath(dir, entry.PeerId))
+}
+
+// ReadRendezvousDir returns the valid entries of the directory whose
+// heartbeat is not older than maxAge, the most recent first.
+func ReadRendezvousDir(dir string, maxAge time.Duration) ([]RendezvousEntry, error) {
+	entries, _, err := readRendezvousDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return slices.DeleteFunc(entries, func(e RendezvousEntry) bool {
+		return e.Stale(maxAge, now)
+	}), nil
+}
+
+// BootstrapFromDir returns the records of the fresh entries of a
+// rendezvous directory, to be used as Config.BootstrapNodes.
+// A missing directory has no entry.
+func BootstrapFromDir(dir string, maxAge time.Duration) ([]string, error) {
+	entries, err := ReadRendezvousDir(dir, maxAge)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sprs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		sprs = append(sprs, e.Spr)
+	}
+
+	return sprs, nil
+}
+
+// readRendezvousDir reads the entries of the directory, the most recent
+// first. The files that cannot be decoded or whose record is invalid
+// are returned separately.
+func readRendezvousDir(dir string) ([]RendezvousEntry, map[string]error, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []RendezvousEntry
+	invalid := map[string]error{}
+
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != rendezvousExt {
+			continue
+		}
+
+		entry, err := readRendezvousEntry(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			// Removed since the listing
+			continue
+		}
+
+		if err != nil {
+			invalid[name] = err
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	slices.SortFunc(entries, func(a, b RendezvousEntry) int {
+		return b.Heartbeat.Compare(a.Heartbeat)
+	})
+
+	return entries, invalid, nil
+}
+
+func readRendezvousEntry(path string) (RendezvousEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RendezvousEntry{}, err
+	}
+
+	var entry RendezvousEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return RendezvousEntry{}, err
+	}
+
+	if name := strings.TrimSuffix(filepath.Base(path), rendezvousExt); name != entry.PeerId {
+		return RendezvousEntry{}, fmt.Errorf("entry of %s in the file of %s", entry.PeerId, name)
+	}
+
+	return entry, entry.validate()
+}
+
+func rendezvousPath(dir, peerId string) string {
+	return filepath.Join(dir, peerId+rendezvousExt)
+}
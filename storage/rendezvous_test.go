@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testRendezvousEntry(t *testing.T, seed byte, heartbeat time.Time) RendezvousEntry {
+	t.Helper()
+
+	record := testSPR(t, seed, uint64(heartbeat.Unix()), netip.MustParseAddrPort("10.0.0.1:8090"))
+	spr, err := ParseSPR(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return RendezvousEntry{PeerId: spr.PeerID.String(), Spr: record, Heartbeat: heartbeat}
+}
+
+func TestRendezvousDir(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	fresh := testRendezvousEntry(t, 1, now)
+	older := testRendezvousEntry(t, 2, now.Add(-time.Minute))
+	stale := testRendezvousEntry(t, 3, now.Add(-time.Hour))
+
+	for _, e := range []RendezvousEntry{older, fresh, stale} {
+		if err := WriteRendezvousEntry(dir, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mismatch := testRendezvousEntry(t, 4, now)
+	mismatch.PeerId = fresh.PeerId
+	if err := WriteRendezvousEntry(dir, mismatch); err == nil {
+		t.Fatal("expected an error for a record of another peer")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "garbage.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadRendezvousDir(dir, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].PeerId != fresh.PeerId || entries[1].PeerId != older.PeerId {
+		t.Fatalf("expected the fresh entries, the most recent first, got %+v", entries)
+	}
+
+	_, invalid, err := readRendezvousDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := invalid["garbage.json"]; !ok || len(invalid) != 1 {
+		t.Fatalf("expected the garbage file to be invalid, got %v", invalid)
+	}
+
+	sprs, err := BootstrapFromDir(dir, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sprs) != 2 || sprs[0] != fresh.Spr {
+		t.Fatalf("unexpected bootstrap nodes %v", sprs)
+	}
+
+	if sprs, err := BootstrapFromDir(filepath.Join(dir, "missing"), time.Minute); err != nil || len(sprs) != 0 {
+		t.Fatalf("expected no bootstrap node for a missing directory, got %v %v", sprs, err)
+	}
+}
+
+func TestDiffRendezvous(t *testing.T) {
+	now := time.Now()
+
+	a := testRendezvousEntry(t, 1, now)
+	b := testRendezvousEntry(t, 2, now)
+	c := testRendezvousEntry(t, 3, now.Add(-time.Hour))
+	renewed := testRendezvousEntry(t, 2, now.Add(time.Second))
+
+	known := map[string]string{a.PeerId: a.Spr, b.PeerId: b.Spr, c.PeerId: c.Spr}
+
+	scan := diffRendezvous(known, []RendezvousEntry{a, renewed, c}, time.Minute, now)
+
+	if len(scan.Added) != 1 || scan.Added[0].PeerId != b.PeerId {
+		t.Fatalf("expected the renewed record to be added, got %+v", scan.Added)
+	}
+
+	if len(scan.Expired) != 1 || scan.Expired[0] != c.PeerId {
+		t.Fatalf("expected the stale entry to expire, got %v", scan.Expired)
+	}
+}
+
+func TestRendezvous(t *testing.T) {
+	dir := t.TempDir()
+
+	node1 := newStorageNode(t)
+	node2 := newStorageNode(t)
+
+	options := RendezvousOptions{
+		Interval: 100 * time.Millisecond,
+		Expiry:   time.Second,
+		Peers:    PeerManagerOptions{CheckInterval: 100 * time.Millisecond, MinBackoff: 100 * time.Millisecond},
+	}
+
+	r1, err := NewRendezvous(node1, dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r2, err := NewRendezvous(node2, dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go r1.Run(ctx)
+	go r2.Run(ctx)
+
+	peerId, err := node2.PeerId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status, ok := r1.Peers().Status(peerId)
+		if ok && status.State == PeerConnected {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected node 2 to be connected, got %+v", status)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestRendezvousAddPeers(t *testing.T) {
+	m, err := NewPeerManager(&StorageNode{stops: newStopHooks()}, PeerManagerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Closed, so the valid entries are rejected after the invalid ones
+	m.Close()
+
+	r := &Rendezvous{peers: m, known: map[string]string{}}
+
+	bad := testRendezvousEntry(t, 1, time.Now())
+	bad.Addrs = []string{"not a multiaddr"}
+	good := testRendezvousEntry(t, 2, time.Now())
+
+	scan := RendezvousScan{Added: []RendezvousEntry{bad, good}, Invalid: map[string]error{}}
+
+	if err := r.addPeers(&scan); !errors.Is(err, ErrPeerManagerClosed) {
+		t.Fatalf("expected the scan to continue after the invalid entry, got %v", err)
+	}
+
+	if scan.Invalid[bad.PeerId+".json"] == nil {
+		t.Fatalf("expected the invalid entry to be reported, got %v", scan.Invalid)
+	}
+
+	if _, ok := r.known[bad.PeerId]; ok {
+		t.Fatal("expected the invalid entry to be tried again")
+	}
+}
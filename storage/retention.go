@@ -0,0 +1,421 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EvictionStrategy defines the order in which the datasets are
+// evicted when the quota usage is above the high watermark.
+type EvictionStrategy string
+
+const (
+	// EvictLRU evicts the least recently accessed datasets first.
+	EvictLRU EvictionStrategy = "lru"
+
+	// EvictOldestFirst evicts the datasets seen first by the node first.
+	EvictOldestFirst EvictionStrategy = "oldest-first"
+
+	// EvictSizeWeighted evicts first the datasets with the highest
+	// idle time multiplied by their size, so big and unused datasets
+	// go before small ones.
+	EvictSizeWeighted EvictionStrategy = "size-weighted"
+)
+
+// EvictionReason is the reason why a dataset is evicted.
+type EvictionReason string
+
+const (
+	// EvictionQuota means that the dataset was evicted to bring the
+	// quota usage below the low watermark.
+	EvictionQuota EvictionReason = "quota"
+
+	// EvictionMaxAge means that the dataset was not accessed for
+	// longer than the maximum age of the policy.
+	EvictionMaxAge EvictionReason = "max-age"
+)
+
+const (
+	defaultHighWatermark     = 0.9
+	defaultLowWatermark      = 0.7
+	defaultRetentionInterval = time.Minute
+)
+
+// RetentionPolicy defines which datasets are evicted by the RetentionManager.
+type RetentionPolicy struct {
+	// Strategy is the eviction order.
+	// Default: EvictLRU
+	Strategy EvictionStrategy
+
+	// HighWatermark is the fraction of QuotaMaxBytes used that starts
+	// the eviction. nil uses the default, 0 evicts as soon as a
+	// dataset is stored.
+	// Default: 0.9
+	HighWatermark *float64
+
+	// LowWatermark is the fraction of QuotaMaxBytes used that stops
+	// the eviction. nil uses the default, capped to the high watermark.
+	// Default: 0.7
+	LowWatermark *float64
+
+	// MaxAge evicts the datasets not accessed for longer than MaxAge,
+	// regardless of the quota usage. 0 disables it.
+	MaxAge time.Duration
+
+	// Pinned is the list of cids that are never evicted.
+	Pinned []string
+}
+
+// EvictionEvent describes the eviction of a dataset.
+type EvictionEvent struct {
+	// Manifest is the manifest of the evicted dataset.
+	Manifest Manifest
+
+	// Reason is the reason of the eviction.
+	Reason EvictionReason
+
+	// LastAccess is the last access of the dataset known by the node.
+	LastAccess time.Time
+
+	// DryRun is true if the dataset was not actually deleted.
+	DryRun bool
+
+	// Err is the error returned by Delete, if any.
+	Err error
+}
+
+// RetentionReport is the result of a retention cycle.
+type RetentionReport struct {
+	// Time is the start of the cycle.
+	Time time.Time
+
+	// Space is the space information before the cycle.
+	Space Space
+
+	// TargetBytes is the quota usage targeted by the eviction,
+	// i.e the low watermark in bytes.
+	TargetBytes int64
+
+	// Evictions lists the evicted datasets, in eviction order.
+	Evictions []EvictionEvent
+
+	// FreedBytes is the sum of the dataset sizes evicted.
+	FreedBytes int64
+
+	// DryRun is true if the datasets were not actually deleted.
+	DryRun bool
+}
+
+type RetentionOptions struct {
+	// Policy defines the datasets to evict.
+	Policy RetentionPolicy
+
+	// Interval is the time between two retention cycles in Run.
+	// Default: 1 minute
+	Interval time.Duration
+
+	// DryRun reports the datasets that would be evicted
+	// without deleting them.
+	DryRun bool
+
+	// OnEvict is a callback function called for each evicted dataset.
+	OnEvict func(event EvictionEvent)
+
+	// OnReport is a callback function called at the end of each cycle of Run.
+	OnReport func(report RetentionReport, err error)
+}
+
+// RetentionManager deletes datasets from the node to keep the quota
+// usage under control. It combines Space, Manifests and the node
+// AccessLog to decide which datasets to evict.
+//
+// The datasets unknown by the access log, for example the ones stored
+// before the log was saved in the data dir, are considered accessed when
+// the manager observes them for the first time.
+type RetentionManager struct {
+	node    StorageNode
+	options RetentionOptions
+
+	mu     sync.Mutex
+	pinned map[string]struct{}
+}
+
+// NewRetentionManager creates a retention manager for the node.
+func NewRetentionManager(node *StorageNode, options RetentionOptions) (*RetentionManager, error) {
+	policy := &options.Policy
+
+	if policy.Strategy == "" {
+		policy.Strategy = EvictLRU
+	}
+
+	switch policy.Strategy {
+	case EvictLRU, EvictOldestFirst, EvictSizeWeighted:
+	default:
+		return nil, fmt.Errorf("unknown eviction strategy %q", policy.Strategy)
+	}
+
+	high, low := policy.watermarks()
+
+	if high < 0 || high > 1 {
+		return nil, fmt.Errorf("high watermark %v must be between 0 and 1", high)
+	}
+
+	if low < 0 || low > high {
+		return nil, fmt.Errorf("low watermark %v must be between 0 and the high watermark %v", low, high)
+	}
+
+	if options.Interval <= 0 {
+		options.Interval = defaultRetentionInterval
+	}
+
+	pinned := make(map[string]struct{}, len(policy.Pinned))
+	for _, cid := range policy.Pinned {
+		pinned[cid] = struct{}{}
+	}
+
+	return &RetentionManager{
+		node:    *node,
+		options: options,
+		pinned:  pinned,
+	}, nil
+}
+
+// Pin protects a cid from the eviction.
+func (r *RetentionManager) Pin(cid string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pinned[cid] = struct{}{}
+}
+
+// Unpin removes the protection of a cid.
+func (r *RetentionManager) Unpin(cid string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.pinned, cid)
+}
+
+// Pinned returns the pinned cids.
+func (r *RetentionManager) Pinned() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var cids []string
+	for cid := range r.pinned {
+		cids = append(cids, cid)
+	}
+	slices.Sort(cids)
+
+	return cids
+}
+
+// Run applies the policy every interval until the context is done.
+// It returns the context error.
+func (r *RetentionManager) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := r.Enforce(ctx)
+		if r.options.OnReport != nil {
+			r.options.OnReport(report, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Plan returns the datasets that the policy would evict now,
+// without deleting anything.
+func (r *RetentionManager) Plan() (RetentionReport, error) {
+	return r.cycle(context.Background(), true)
+}
+
+// Enforce runs one retention cycle. The datasets are deleted one by one
+// and the space is refreshed after each deletion, so the eviction stops
+// as soon as the usage is below the low watermark.
+// If DryRun is set, it behaves like Plan.
+func (r *RetentionManager) Enforce(ctx context.Context) (RetentionReport, error) {
+	return r.cycle(ctx, r.options.DryRun)
+}
+
+func (r *RetentionManager) cycle(ctx context.Context, dryRun bool) (RetentionReport, error) {
+	now := time.Now()
+	report := RetentionReport{Time: now, DryRun: dryRun}
+
+	space, err := r.node.Space()
+	if err != nil {
+		return report, err
+	}
+	report.Space = space
+
+	manifests, err := r.node.Manifests()
+	if err != nil {
+		return report, err
+	}
+
+	records := make(map[string]AccessRecord, len(manifests))
+	for _, m := range manifests {
+		records[m.Cid] = r.node.accesses.observe(m.Cid, now)
+	}
+
+	r.mu.Lock()
+	candidates := planEvictions(space, manifests, records, r.options.Policy, r.pinned, now)
+	r.mu.Unlock()
+
+	report.TargetBytes = lowWatermarkBytes(space, r.options.Policy)
+	used := space.QuotaUsedBytes
+
+	var errs []error
+	for _, c := range candidates {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+
+		// The max age candidates come first, then the quota candidates
+		// are evicted until the usage reached the target.
+		if c.reason == EvictionQuota && used <= report.TargetBytes {
+			break
+		}
+
+		event := EvictionEvent{
+			Manifest:   c.manifest,
+			Reason:     c.reason,
+			LastAccess: c.record.LastAccess,
+			DryRun:     dryRun,
+		}
+
+		if dryRun {
+			used -= int64(c.manifest.DatasetSize)
+		} else {
+			event.Err = r.node.Delete(c.manifest.Cid)
+			if event.Err != nil {
+				errs = append(errs, fmt.Errorf("failed to evict %s: %w", c.manifest.Cid, event.Err))
+			} else if space, err := r.node.Space(); err == nil {
+				used = space.QuotaUsedBytes
+			} else {
+				used -= int64(c.manifest.DatasetSize)
+			}
+		}
+
+		if event.Err == nil {
+			report.FreedBytes += int64(c.manifest.DatasetSize)
+		}
+
+		report.Evictions = append(report.Evictions, event)
+
+		if r.options.OnEvict != nil {
+			r.options.OnEvict(event)
+		}
+	}
+
+	// Keep the observed datasets across the restarts
+	if err := r.node.accesses.Save(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save the access log: %w", err))
+	}
+
+	return report, errors.Join(errs...)
+}
+
+type evictionCandidate struct {
+	manifest Manifest
+	record   AccessRecord
+	reason   EvictionReason
+}
+
+// watermarks returns the high and low watermarks of the policy,
+// with the defaults applied to the unset ones.
+func (p RetentionPolicy) watermarks() (high, low float64) {
+	high = defaultHighWatermark
+	if p.HighWatermark != nil {
+		high = *p.HighWatermark
+	}
+
+	low = min(defaultLowWatermark, high)
+	if p.LowWatermark != nil {
+		low = *p.LowWatermark
+	}
+
+	return high, low
+}
+
+func highWatermarkBytes(space Space, policy RetentionPolicy) int64 {
+	high, _ := policy.watermarks()
+	return int64(float64(space.QuotaMaxBytes) * high)
+}
+
+func lowWatermarkBytes(space Space, policy RetentionPolicy) int64 {
+	_, low := policy.watermarks()
+	return int64(float64(space.QuotaMaxBytes) * low)
+}
+
+// planEvictions returns the eviction candidates: first the datasets
+// older than the max age, then, if the usage is above the high
+// watermark, the other datasets in the strategy order.
+// The caller stops evicting quota candidates once the usage is
+// below the low watermark. Without a known quota, only the max age
+// applies.
+func planEvictions(space Space, manifests []Manifest, records map[string]AccessRecord, policy RetentionPolicy, pinned map[string]struct{}, now time.Time) []evictionCandidate {
+	var expired, others []evictionCandidate
+
+	for _, m := range manifests {
+		if _, ok := pinned[m.Cid]; ok {
+			continue
+		}
+
+		c := evictionCandidate{manifest: m, record: records[m.Cid]}
+
+		if policy.MaxAge > 0 && now.Sub(c.record.LastAccess) > policy.MaxAge {
+			c.reason = EvictionMaxAge
+			expired = append(expired, c)
+		} else {
+			c.reason = EvictionQuota
+			others = append(others, c)
+		}
+	}
+
+	candidates := expired
+
+	if space.QuotaMaxBytes <= 0 || space.QuotaUsedBytes < highWatermarkBytes(space, policy) {
+		return candidates
+	}
+
+	slices.SortFunc(others, func(a, b evictionCandidate) int {
+		var order int
+
+		switch policy.Strategy {
+		case EvictOldestFirst:
+			order = a.record.FirstSeen.Compare(b.record.FirstSeen)
+		case EvictSizeWeighted:
+			order = cmp.Compare(evictionWeight(b, now), evictionWeight(a, now))
+		default:
+			order = a.record.LastAccess.Compare(b.record.LastAccess)
+		}
+
+		if order == 0 {
+			order = strings.Compare(a.manifest.Cid, b.manifest.Cid)
+		}
+
+		return order
+	})
+
+	return append(candidates, others...)
+}
+
+// evictionWeight is the idle time in seconds multiplied by the dataset size.
+func evictionWeight(c evictionCandidate, now time.Time) float64 {
+	idle := now.Sub(c.record.LastAccess).Seconds() + 1
+	return idle * float64(c.manifest.DatasetSize)
+}
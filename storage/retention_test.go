@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func watermark(v float64) *float64 {
+	return &v
+}
+
+func candidateCids(candidates []evictionCandidate) []string {
+	var cids []string
+	for _, c := range candidates {
+		cids = append(cids, c.manifest.Cid)
+	}
+	return cids
+}
+
+func TestPlanEvictions(t *testing.T) {
+	now := time.Now()
+	space := Space{QuotaMaxBytes: 1000, QuotaUsedBytes: 950}
+
+	manifests := []Manifest{
+		{Cid: "a", DatasetSize: 100},
+		{Cid: "b", DatasetSize: 500},
+		{Cid: "c", DatasetSize: 10},
+	}
+
+	records := map[string]AccessRecord{
+		"a": {FirstSeen: now.Add(-3 * time.Hour), LastAccess: now.Add(-1 * time.Minute)},
+		"b": {FirstSeen: now.Add(-1 * time.Hour), LastAccess: now.Add(-30 * time.Minute)},
+		"c": {FirstSeen: now.Add(-2 * time.Hour), LastAccess: now.Add(-2 * time.Hour)},
+	}
+
+	tests := []struct {
+		name     string
+		policy   RetentionPolicy
+		pinned   []string
+		space    Space
+		expected []string
+	}{
+		{"lru", RetentionPolicy{Strategy: EvictLRU, HighWatermark: watermark(0.9)}, nil, space, []string{"c", "b", "a"}},
+		{"oldest-first", RetentionPolicy{Strategy: EvictOldestFirst, HighWatermark: watermark(0.9)}, nil, space, []string{"a", "c", "b"}},
+		{"size-weighted", RetentionPolicy{Strategy: EvictSizeWeighted, HighWatermark: watermark(0.9)}, nil, space, []string{"b", "c", "a"}},
+		{"pinned", RetentionPolicy{Strategy: EvictLRU, HighWatermark: watermark(0.9)}, []string{"c"}, space, []string{"b", "a"}},
+		{"below high watermark", RetentionPolicy{Strategy: EvictLRU, HighWatermark: watermark(0.99)}, nil, space, nil},
+		{"max age", RetentionPolicy{Strategy: EvictLRU, HighWatermark: watermark(0.9), MaxAge: time.Hour}, nil, Space{QuotaMaxBytes: 1000}, []string{"c"}},
+		{"max age first", RetentionPolicy{Strategy: EvictOldestFirst, HighWatermark: watermark(0.9), MaxAge: time.Hour}, nil, space, []string{"c", "a", "b"}},
+		{"default watermark", RetentionPolicy{Strategy: EvictLRU}, nil, space, []string{"c", "b", "a"}},
+		{"zero watermark", RetentionPolicy{Strategy: EvictLRU, HighWatermark: watermark(0)}, nil, Space{QuotaMaxBytes: 1000}, []string{"c", "b", "a"}},
+		{"unknown quota", RetentionPolicy{Strategy: EvictLRU, HighWatermark: watermark(0)}, nil, Space{}, nil},
+		{"unknown quota max age", RetentionPolicy{Strategy: EvictLRU, MaxAge: time.Hour}, nil, Space{QuotaUsedBytes: 950}, []string{"c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinned := make(map[string]struct{})
+			for _, cid := range tt.pinned {
+				pinned[cid] = struct{}{}
+			}
+
+			cids := candidateCids(planEvictions(tt.space, manifests, records, tt.policy, pinned, now))
+			if !slices.Equal(cids, tt.expected) {
+				t.Fatalf("expected evictions %v, got %v", tt.expected, cids)
+			}
+		})
+	}
+}
+
+func TestNewRetentionManagerInvalidPolicy(t *testing.T) {
+	policies := []RetentionPolicy{
+		{Strategy: "random"},
+		{HighWatermark: watermark(1.5)},
+		{HighWatermark: watermark(0.5), LowWatermark: watermark(0.8)},
+		{HighWatermark: watermark(-0.1)},
+	}
+
+	for _, policy := range policies {
+		if _, err := NewRetentionManager(&StorageNode{}, RetentionOptions{Policy: policy}); err == nil {
+			t.Errorf("expected an error for policy %+v", policy)
+		}
+	}
+}
+
+func TestRetentionManager(t *testing.T) {
+	storage := newStorageNode(t)
+
+	pinned, _ := uploadHelper(t, storage)
+	cid, _ := uploadBigFileHelper(t, storage)
+
+	var events []EvictionEvent
+	manager, err := NewRetentionManager(storage, RetentionOptions{
+		Policy: RetentionPolicy{
+			HighWatermark: watermark(0.000001),
+			LowWatermark:  watermark(0.000001),
+			Pinned:        []string{pinned},
+		},
+		OnEvict: func(event EvictionEvent) {
+			events = append(events, event)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := manager.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Evictions) != 1 || report.Evictions[0].Manifest.Cid != cid || !report.Evictions[0].DryRun {
+		t.Fatalf("expected a dry run eviction of %s, got %+v", cid, report.Evictions)
+	}
+
+	exists, err := storage.Exists(cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("expected cid to exist after a dry run")
+	}
+
+	report, err = manager.Enforce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Evictions) != 1 || report.Evictions[0].Manifest.Cid != cid || report.Evictions[0].DryRun {
+		t.Fatalf("expected the eviction of %s, got %+v", cid, report.Evictions)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 eviction events, got %d", len(events))
+	}
+
+	exists, err = storage.Exists(cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("expected cid to be evicted")
+	}
+
+	exists, err = storage.Exists(pinned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("expected pinned cid to be kept")
+	}
+}
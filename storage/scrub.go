@@ -0,0 +1,340 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ScrubStatus is the state of a dataset checked by the Scrubber.
+type ScrubStatus string
+
+const (
+	// ScrubOK means that the full dataset was read without error.
+	ScrubOK ScrubStatus = "ok"
+
+	// ScrubCorrupt means that the dataset could not be read entirely,
+	// or that its content does not match its manifest.
+	ScrubCorrupt ScrubStatus = "corrupt"
+
+	// ScrubMissing means that the manifest of the dataset is listed
+	// but cannot be read from the local store anymore.
+	ScrubMissing ScrubStatus = "missing"
+)
+
+const (
+	defaultScrubInterval = 24 * time.Hour
+
+	// scrubRetryDelay is the time between two attempts to read
+	// a dataset that is being downloaded.
+	scrubRetryDelay = time.Second
+)
+
+// ScrubResult is the result of the check of a dataset.
+type ScrubResult struct {
+	Manifest Manifest
+	Status   ScrubStatus
+
+	// Bytes is the number of bytes read from the local store.
+	Bytes int
+
+	// Err describes the problem found for a corrupt or missing dataset.
+	Err error
+
+	// Repaired is true if the dataset was fetched again from the network.
+	Repaired bool
+
+	// RepairErr is the error of the repair, if any.
+	RepairErr error
+}
+
+// ScrubReport is the result of a scrub cycle.
+type ScrubReport struct {
+	// Time is the start of the cycle.
+	Time time.Time
+
+	// Duration is the time taken by the cycle.
+	Duration time.Duration
+
+	Results []ScrubResult
+}
+
+// Filter returns the results with the status.
+func (r ScrubReport) Filter(status ScrubStatus) []ScrubResult {
+	var results []ScrubResult
+	for _, res := range r.Results {
+		if res.Status == status {
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+type ScrubOptions struct {
+	// Interval is the time between two scrub cycles in Run.
+	// Default: 24 hours
+	Interval time.Duration
+
+	// RateLimit is the maximum number of bytes read per second,
+	// so the scrubbing does not starve the other transfers. The chunks
+	// are pulled from the local store at this rate.
+	// 0 means no limit.
+	RateLimit int64
+
+	// Repair deletes the corrupt and missing datasets and fetches
+	// them again from the network.
+	Repair bool
+
+	// RepairTimeout is the maximum duration of the fetch of a dataset
+	// during a repair, 0 means no timeout.
+	RepairTimeout time.Duration
+
+	// OnResult is a callback function called after each dataset checked.
+	OnResult func(result ScrubResult)
+
+	// OnReport is a callback function called at the end of each cycle of Run.
+	OnReport func(report ScrubReport, err error)
+}
+
+// Scrubber re-reads the datasets of the local store to detect silent
+// corruption.
+//
+// Each dataset is read chunk by chunk from the local store and must produce
+// exactly its DatasetSize. The manifest is read again and compared with the
+// listed one, so a dataset whose TreeCid changed is reported as corrupt. The
+// content of the blocks is not hashed by the scrubber: the library does not
+// expose the merkle proofs of the local blocks.
+//
+// A dataset is read with a manual download session, see DownloadInit:
+// meanwhile, DownloadStream and DownloadInit return ErrDownloadInProgress
+// for its cid. A dataset that is being downloaded is checked once its
+// transfer is over.
+type Scrubber struct {
+	node    StorageNode
+	options ScrubOptions
+}
+
+// NewScrubber creates a scrubber for the node.
+func NewScrubber(node *StorageNode, options ScrubOptions) (*Scrubber, error) {
+	if options.RateLimit < 0 {
+		return nil, fmt.Errorf("invalid scrub rate limit %d", options.RateLimit)
+	}
+
+	if options.Interval <= 0 {
+		options.Interval = defaultScrubInterval
+	}
+
+	return &Scrubber{node: *node, options: options}, nil
+}
+
+// Run scrubs the datasets every interval until the context is done.
+// It returns the context error.
+func (s *Scrubber) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := s.Scrub(ctx)
+		if s.options.OnReport != nil {
+			s.options.OnReport(report, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scrub runs one scrub cycle over all the datasets of the node.
+// The returned error is not nil if the datasets could not be listed or
+// if the context is done; the problems found are in the report.
+func (s *Scrubber) Scrub(ctx context.Context) (ScrubReport, error) {
+	report := ScrubReport{Time: time.Now()}
+	defer func() {
+		report.Duration = time.Since(report.Time)
+	}()
+
+	limiter := newRateLimiter(s.options.RateLimit)
+
+	for m, err := range s.node.ManifestsSeq(ManifestFilter{}) {
+		if err != nil {
+			return report, err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		res := s.check(ctx, m, limiter)
+
+		// An interrupted read says nothing about the dataset
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		if res.Status != ScrubOK && s.options.Repair {
+			res.RepairErr = s.repair(ctx, m.Cid)
+			res.Repaired = res.RepairErr == nil
+		}
+
+		report.Results = append(report.Results, res)
+
+		if s.options.OnResult != nil {
+			s.options.OnResult(res)
+		}
+	}
+
+	return report, ctx.Err()
+}
+
+// ScrubDataset checks a single dataset, without repairing it.
+func (s *Scrubber) ScrubDataset(ctx context.Context, manifest Manifest) ScrubResult {
+	return s.check(ctx, manifest, newRateLimiter(s.options.RateLimit))
+}
+
+func (s *Scrubber) check(ctx context.Context, m Manifest, limiter *rateLimiter) ScrubResult {
+	res := ScrubResult{Manifest: m, Status: ScrubOK}
+
+	current, err := s.node.DownloadManifest(m.Cid)
+	if err != nil {
+		res.Status = ScrubMissing
+		res.Err = err
+		return res
+	}
+
+	if current.TreeCid != m.TreeCid || current.DatasetSize != m.DatasetSize {
+		res.Status = ScrubCorrupt
+		res.Err = fmt.Errorf("manifest of %s changed: tree cid %s, size %d", m.Cid, current.TreeCid, current.DatasetSize)
+		return res
+	}
+
+	res.Bytes, err = s.read(ctx, m, limiter)
+
+	switch {
+	case err != nil:
+		res.Status = ScrubCorrupt
+		res.Err = fmt.Errorf("failed to read %s: %w", m.Cid, err)
+	case res.Bytes != m.DatasetSize:
+		res.Status = ScrubCorrupt
+		res.Err = fmt.Errorf("read %d bytes of %s, expected %d", res.Bytes, m.Cid, m.DatasetSize)
+	}
+
+	return res
+}
+
+// read pulls the chunks of the dataset from the local store and returns
+// the number of bytes read. It waits for the rate limiter before pulling
+// the next chunk, and stops once more than DatasetSize bytes were read.
+func (s *Scrubber) read(ctx context.Context, m Manifest, limiter *rateLimiter) (n int, err error) {
+	if err := s.init(ctx, m.Cid); err != nil {
+		return 0, err
+	}
+
+	// An empty chunk ends the session, otherwise it must be cancelled
+	released := false
+	defer func() {
+		if !released {
+			s.node.DownloadCancel(m.Cid)
+		}
+	}()
+
+	for n <= m.DatasetSize {
+		chunk, err := s.node.DownloadChunk(m.Cid)
+		if err != nil {
+			return n, err
+		}
+
+		if len(chunk) == 0 {
+			released = true
+			return n, nil
+		}
+
+		n += len(chunk)
+
+		if err := limiter.wait(ctx, len(chunk)); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// init starts a manual download session for the cid, waiting
+// for the end of the transfers in progress for the cid.
+func (s *Scrubber) init(ctx context.Context, cid string) error {
+	for {
+		err := s.node.DownloadInit(cid, DownloadInitOptions{Local: true})
+		if !errors.Is(err, ErrDownloadInProgress) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(scrubRetryDelay):
+		}
+	}
+}
+
+func (s *Scrubber) repair(ctx context.Context, cid string) error {
+	if err := s.node.Delete(cid); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", cid, err)
+	}
+
+	if _, err := s.node.FetchContext(ctx, cid, FetchOptions{Timeout: s.options.RepairTimeout}); err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", cid, err)
+	}
+
+	return nil
+}
+
+// rateLimiter spreads the bytes over time so the average
+// rate stays under the limit.
+type rateLimiter struct {
+	limit int64
+	start time.Time
+	bytes int64
+	now   func() time.Time
+}
+
+func newRateLimiter(limit int64) *rateLimiter {
+	return &rateLimiter{limit: limit, now: time.Now}
+}
+
+// delay records n bytes and returns the time to wait before
+// the bytes can be used.
+func (l *rateLimiter) delay(n int) time.Duration {
+	if l.limit <= 0 {
+		return 0
+	}
+
+	now := l.now()
+	if l.start.IsZero() {
+		l.start = now
+	}
+
+	l.bytes += int64(n)
+
+	expected := time.Duration(float64(l.bytes) / float64(l.limit) * float64(time.Second))
+	return max(expected-now.Sub(l.start), 0)
+}
+
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	d := l.delay(n)
+	if d == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
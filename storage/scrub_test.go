@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterDelay(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(1000)
+	l.now = func() time.Time { return now }
+
+	if d := l.delay(500); d != 500*time.Millisecond {
+		t.Fatalf("expected 500ms, got %v", d)
+	}
+
+	now = now.Add(2 * time.Second)
+	if d := l.delay(1000); d != 0 {
+		t.Fatalf("expected no delay under the limit, got %v", d)
+	}
+
+	if d := newRateLimiter(0).delay(1 << 30); d != 0 {
+		t.Fatalf("expected no delay without limit, got %v", d)
+	}
+}
+
+func TestScrub(t *testing.T) {
+	storage := newStorageNode(t)
+	cid, _ := uploadHelper(t, storage)
+
+	scrubber, err := NewScrubber(storage, ScrubOptions{RateLimit: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := scrubber.Scrub(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Results) != 1 || report.Results[0].Status != ScrubOK {
+		t.Fatalf("expected %s to be ok, got %+v", cid, report.Results)
+	}
+
+	if report.Results[0].Bytes != report.Results[0].Manifest.DatasetSize {
+		t.Fatalf("expected the full dataset to be read, got %d bytes", report.Results[0].Bytes)
+	}
+}
+
+func TestScrubDatasetMissing(t *testing.T) {
+	storage := newStorageNode(t)
+	cid, _ := uploadHelper(t, storage)
+
+	manifest, err := storage.DownloadManifest(cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.Delete(cid); err != nil {
+		t.Fatal(err)
+	}
+
+	scrubber, err := NewScrubber(storage, ScrubOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := scrubber.ScrubDataset(context.Background(), manifest)
+	if res.Status == ScrubOK {
+		t.Fatal("expected a deleted dataset not to be ok")
+	}
+}
+
+func TestScrubDatasetInProgress(t *testing.T) {
+	storage := newStorageNode(t)
+	cid, _ := uploadHelper(t, storage)
+
+	manifest, err := storage.DownloadManifest(cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.DownloadInit(cid, DownloadInitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	scrubber, err := NewScrubber(storage, ScrubOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan ScrubResult, 1)
+	go func() {
+		results <- scrubber.ScrubDataset(context.Background(), manifest)
+	}()
+
+	select {
+	case res := <-results:
+		t.Fatalf("expected the scrubber to wait for the download, got %+v", res)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := storage.DownloadCancel(cid); err != nil {
+		t.Fatal(err)
+	}
+
+	if res := <-results; res.Status != ScrubOK {
+		t.Fatalf("expected %s to be ok, got %+v", cid, res)
+	}
+}
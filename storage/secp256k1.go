@@ -0,0 +1,405 @@
+package storage
+
+import (
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"math/bits"
+)
+
+// The secp256k1 curve used by the libp2p keys of the nodes,
+// y² = x³ + 7 over the field of P.
+var (
+	secpP, _  = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F", 16)
+	secpN, _  = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+	secpGx, _ = new(big.Int).SetString("79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798", 16)
+	secpGy, _ = new(big.Int).SetString("483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8", 16)
+)
+
+// secpPoint is a point of the curve, x == nil is the point at infinity.
+type secpPoint struct {
+	x, y *big.Int
+}
+
+func secpG() secpPoint {
+	return secpPoint{secpGx, secpGy}
+}
+
+func (p secpPoint) infinity() bool {
+	return p.x == nil
+}
+
+func secpAdd(a, b secpPoint) secpPoint {
+	if a.infinity() {
+		return b
+	}
+
+	if b.infinity() {
+		return a
+	}
+
+	var lambda *big.Int
+
+	if a.x.Cmp(b.x) == 0 {
+		if a.y.Cmp(b.y) != 0 || a.y.Sign() == 0 {
+			return secpPoint{}
+		}
+
+		// lambda = 3x² / 2y
+		num := new(big.Int).Mul(a.x, a.x)
+		num.Mul(num, big.NewInt(3))
+		den := new(big.Int).Lsh(a.y, 1)
+		lambda = num.Mul(num, den.ModInverse(den.Mod(den, secpP), secpP))
+	} else {
+		// lambda = (yb - ya) / (xb - xa)
+		num := new(big.Int).Sub(b.y, a.y)
+		den := new(big.Int).Sub(b.x, a.x)
+		lambda = num.Mul(num, den.ModInverse(den.Mod(den, secpP), secpP))
+	}
+	lambda.Mod(lambda, secpP)
+
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, a.x).Sub(x, b.x).Mod(x, secpP)
+
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, lambda).Sub(y, a.y).Mod(y, secpP)
+
+	return secpPoint{x, y}
+}
+
+// secpMul is not constant time, it is only used with public values
+// to verify the signatures, see secpScalarBaseMult for the private keys.
+func secpMul(k *big.Int, p secpPoint) secpPoint {
+	var res secpPoint
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		res = secpAdd(res, res)
+		if k.Bit(i) == 1 {
+			res = secpAdd(res, p)
+		}
+	}
+	return res
+}
+
+// secpFe is an element of the field of P in little-endian 64 bits limbs.
+// Unlike big.Int, its operations run in constant time, which matters
+// for the computations with a private key.
+type secpFe [4]uint64
+
+// secpC is 2²⁵⁶ - P, so 2²⁵⁶ = secpC mod P.
+const secpC = 0x1000003D1
+
+var secpFeP = secpFe{0xFFFFFFFEFFFFFC2F, 0xFFFFFFFFFFFFFFFF, 0xFFFFFFFFFFFFFFFF, 0xFFFFFFFFFFFFFFFF}
+
+func secpFeFromBig(x *big.Int) secpFe {
+	var b [32]byte
+	x.FillBytes(b[:])
+
+	var a secpFe
+	for i := range a {
+		for _, v := range b[24-8*i : 32-8*i] {
+			a[i] = a[i]<<8 | uint64(v)
+		}
+	}
+	return a
+}
+
+func (a secpFe) big() *big.Int {
+	var b [32]byte
+	for i := range a {
+		for j := 0; j < 8; j++ {
+			b[31-8*i-j] = byte(a[i] >> (8 * j))
+		}
+	}
+	return new(big.Int).SetBytes(b[:])
+}
+
+// secpFeSelect returns a if cond is 1 and b if it is 0.
+func secpFeSelect(cond uint64, a, b secpFe) secpFe {
+	mask := -cond
+
+	var r secpFe
+	for i := range r {
+		r[i] = a[i]&mask | b[i]&^mask
+	}
+	return r
+}
+
+// reduce subtracts P from the value, with its carry above
+// the 256 bits, if it is not below P. The value must be below 2P.
+func (a secpFe) reduce(carry uint64) secpFe {
+	var t secpFe
+	var borrow uint64
+	t[0], borrow = bits.Sub64(a[0], secpFeP[0], 0)
+	t[1], borrow = bits.Sub64(a[1], secpFeP[1], borrow)
+	t[2], borrow = bits.Sub64(a[2], secpFeP[2], borrow)
+	t[3], borrow = bits.Sub64(a[3], secpFeP[3], borrow)
+
+	return secpFeSelect(carry|(borrow^1), t, a)
+}
+
+func (a secpFe) add(b secpFe) secpFe {
+	var r secpFe
+	var carry uint64
+	r[0], carry = bits.Add64(a[0], b[0], 0)
+	r[1], carry = bits.Add64(a[1], b[1], carry)
+	r[2], carry = bits.Add64(a[2], b[2], carry)
+	r[3], carry = bits.Add64(a[3], b[3], carry)
+
+	return r.reduce(carry)
+}
+
+func (a secpFe) sub(b secpFe) secpFe {
+	var r secpFe
+	var borrow uint64
+	r[0], borrow = bits.Sub64(a[0], b[0], 0)
+	r[1], borrow = bits.Sub64(a[1], b[1], borrow)
+	r[2], borrow = bits.Sub64(a[2], b[2], borrow)
+	r[3], borrow = bits.Sub64(a[3], b[3], borrow)
+
+	// Add P back if the difference is negative
+	mask := -borrow
+	var carry uint64
+	r[0], carry = bits.Add64(r[0], secpFeP[0]&mask, 0)
+	r[1], carry = bits.Add64(r[1], secpFeP[1]&mask, carry)
+	r[2], carry = bits.Add64(r[2], secpFeP[2]&mask, carry)
+	r[3], _ = bits.Add64(r[3], secpFeP[3]&mask, carry)
+
+	return r
+}
+
+func (a secpFe) mul(b secpFe) secpFe {
+	var t [8]uint64
+	for i := range a {
+		var carry uint64
+		for j := range b {
+			hi, lo := bits.Mul64(a[i], b[j])
+
+			var c uint64
+			lo, c = bits.Add64(lo, t[i+j], 0)
+			hi += c
+			lo, c = bits.Add64(lo, carry, 0)
+			hi += c
+
+			t[i+j] = lo
+			carry = hi
+		}
+		t[i+4] = carry
+	}
+
+	// Fold the high 256 bits with 2²⁵⁶ = secpC
+	var r secpFe
+	var carry uint64
+	for i := range r {
+		hi, lo := bits.Mul64(t[i+4], secpC)
+
+		var c uint64
+		lo, c = bits.Add64(lo, t[i], 0)
+		hi += c
+		lo, c = bits.Add64(lo, carry, 0)
+		hi += c
+
+		r[i] = lo
+		carry = hi
+	}
+
+	// The carry is below 2³⁴, fold it the same way
+	hi, lo := bits.Mul64(carry, secpC)
+	r[0], carry = bits.Add64(r[0], lo, 0)
+	r[1], carry = bits.Add64(r[1], hi, carry)
+	r[2], carry = bits.Add64(r[2], 0, carry)
+	r[3], carry = bits.Add64(r[3], 0, carry)
+
+	// On overflow the value is small, so a last fold cannot overflow
+	r[0], carry = bits.Add64(r[0], secpC&-carry, 0)
+	r[1], carry = bits.Add64(r[1], 0, carry)
+	r[2], carry = bits.Add64(r[2], 0, carry)
+	r[3], _ = bits.Add64(r[3], 0, carry)
+
+	return r.reduce(0)
+}
+
+// inv returns the inverse a^(P-2). The exponent is public,
+// so the branches do not depend on the value.
+func (a secpFe) inv() secpFe {
+	e := secpFeP
+	e[0] -= 2
+
+	r := secpFe{1}
+	for i := 255; i >= 0; i-- {
+		r = r.mul(r)
+		if e[i/64]>>(i%64)&1 == 1 {
+			r = r.mul(a)
+		}
+	}
+	return r
+}
+
+// secpProjective is a point in projective coordinates (X:Y:Z),
+// the point at infinity is (0:1:0).
+type secpProjective struct {
+	x, y, z secpFe
+}
+
+// secpB3 is 3b, with b = 7 in y² = x³ + b.
+var secpB3 = secpFe{21}
+
+// add uses the complete addition formulas for the curves with a = 0
+// of Renes, Costello and Batina (algorithm 7): they have no special
+// case for the doubling or the point at infinity.
+func (p secpProjective) add(q secpProjective) secpProjective {
+	t0 := p.x.mul(q.x)
+	t1 := p.y.mul(q.y)
+	t2 := p.z.mul(q.z)
+	t3 := p.x.add(p.y)
+	t4 := q.x.add(q.y)
+	t3 = t3.mul(t4)
+	t4 = t0.add(t1)
+	t3 = t3.sub(t4)
+	t4 = p.y.add(p.z)
+	x3 := q.y.add(q.z)
+	t4 = t4.mul(x3)
+	x3 = t1.add(t2)
+	t4 = t4.sub(x3)
+	x3 = p.x.add(p.z)
+	y3 := q.x.add(q.z)
+	x3 = x3.mul(y3)
+	y3 = t0.add(t2)
+	y3 = x3.sub(y3)
+	x3 = t0.add(t0)
+	t0 = x3.add(t0)
+	t2 = secpB3.mul(t2)
+	z3 := t1.add(t2)
+	t1 = t1.sub(t2)
+	y3 = secpB3.mul(y3)
+	x3 = t4.mul(y3)
+	t2 = t3.mul(t1)
+	x3 = t2.sub(x3)
+	y3 = y3.mul(t0)
+	t1 = t1.mul(z3)
+	y3 = t1.add(y3)
+	t0 = t0.mul(t3)
+	z3 = z3.mul(t4)
+	z3 = z3.add(t0)
+
+	return secpProjective{x3, y3, z3}
+}
+
+// secpScalarBaseMult returns k·G for a 32 bytes big-endian scalar in
+// constant time: the double-and-add always runs for the 256 bits, with
+// complete formulas and a constant time selection of the sum.
+// The scalar must be in [1, N).
+func secpScalarBaseMult(k []byte) secpPoint {
+	g := secpProjective{secpFeFromBig(secpGx), secpFeFromBig(secpGy), secpFe{1}}
+	r := secpProjective{y: secpFe{1}}
+
+	for i := range 256 {
+		bit := uint64(k[i/8]>>(7-i%8)) & 1
+
+		r = r.add(r)
+		sum := r.add(g)
+
+		r = secpProjective{
+			secpFeSelect(bit, sum.x, r.x),
+			secpFeSelect(bit, sum.y, r.y),
+			secpFeSelect(bit, sum.z, r.z),
+		}
+	}
+
+	zinv := r.z.inv()
+	return secpPoint{r.x.mul(zinv).big(), r.y.mul(zinv).big()}
+}
+
+func (p secpPoint) onCurve() bool {
+	if p.infinity() {
+		return false
+	}
+
+	y2 := new(big.Int).Mul(p.y, p.y)
+	y2.Mod(y2, secpP)
+
+	x3 := new(big.Int).Exp(p.x, big.NewInt(3), secpP)
+	x3.Add(x3, big.NewInt(7)).Mod(x3, secpP)
+
+	return y2.Cmp(x3) == 0
+}
+
+// secpParsePublicKey parses a compressed (33 bytes)
+// or uncompressed (65 bytes) public key.
+func secpParsePublicKey(data []byte) (secpPoint, error) {
+	var p secpPoint
+
+	switch {
+	case len(data) == 33 && (data[0] == 2 || data[0] == 3):
+		x := new(big.Int).SetBytes(data[1:])
+		if x.Cmp(secpP) >= 0 {
+			return p, errors.New("invalid secp256k1 public key")
+		}
+
+		// y = sqrt(x³ + 7), P = 3 mod 4
+		y := new(big.Int).Exp(x, big.NewInt(3), secpP)
+		y.Add(y, big.NewInt(7))
+		exp := new(big.Int).Add(secpP, big.NewInt(1))
+		y.Exp(y, exp.Rsh(exp, 2), secpP)
+
+		if y.Bit(0) != uint(data[0]&1) {
+			y.Sub(secpP, y)
+		}
+
+		p = secpPoint{x, y}
+	case len(data) == 65 && data[0] == 4:
+		p = secpPoint{new(big.Int).SetBytes(data[1:33]), new(big.Int).SetBytes(data[33:])}
+		if p.x.Cmp(secpP) >= 0 || p.y.Cmp(secpP) >= 0 {
+			return p, errors.New("invalid secp256k1 public key")
+		}
+	default:
+		return p, errors.New("invalid secp256k1 public key length")
+	}
+
+	if !p.onCurve() {
+		return p, errors.New("secp256k1 public key is not on the curve")
+	}
+
+	return p, nil
+}
+
+// secpCompress returns the 33 bytes compressed form of the point.
+func secpCompress(p secpPoint) []byte {
+	b := make([]byte, 33)
+	b[0] = 2 + byte(p.y.Bit(0))
+	p.x.FillBytes(b[1:])
+	return b
+}
+
+// secpVerify verifies a DER or 64 bytes r||s ECDSA signature of a hash.
+func secpVerify(pub secpPoint, hash, sig []byte) bool {
+	var r, s *big.Int
+
+	if len(sig) == 64 {
+		r, s = new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	} else {
+		var der struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(sig, &der); err != nil || len(rest) != 0 {
+			return false
+		}
+		r, s = der.R, der.S
+	}
+
+	if r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(secpN) >= 0 || s.Cmp(secpN) >= 0 {
+		return false
+	}
+
+	z := new(big.Int).SetBytes(hash)
+	w := new(big.Int).ModInverse(s, secpN)
+
+	u1 := new(big.Int).Mul(z, w)
+	u1.Mod(u1, secpN)
+	u2 := new(big.Int).Mul(r, w)
+	u2.Mod(u2, secpN)
+
+	p := secpAdd(secpMul(u1, secpG()), secpMul(u2, pub))
+	if p.infinity() {
+		return false
+	}
+
+	return new(big.Int).Mod(p.x, secpN).Cmp(r) == 0
+}
@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SpaceMetric is a value derived from Space watched by WatchSpace.
+type SpaceMetric string
+
+const (
+	// SpaceUsed is QuotaUsedBytes.
+	SpaceUsed SpaceMetric = "used"
+
+	// SpaceCommitted is QuotaUsedBytes + QuotaReservedBytes.
+	SpaceCommitted SpaceMetric = "committed"
+
+	// SpaceBlocks is TotalBlocks.
+	SpaceBlocks SpaceMetric = "blocks"
+)
+
+// value returns the value of the metric in the space.
+func (m SpaceMetric) value(space Space) int64 {
+	switch m {
+	case SpaceCommitted:
+		return space.QuotaUsedBytes + space.QuotaReservedBytes
+	case SpaceBlocks:
+		return int64(space.TotalBlocks)
+	default:
+		return space.QuotaUsedBytes
+	}
+}
+
+// SpaceThreshold defines the watermarks of a metric.
+// An event is emitted when the value reaches High, then no other event
+// is emitted until the value goes back to Low, which avoids flapping
+// when the value oscillates around High.
+type SpaceThreshold struct {
+	Metric SpaceMetric
+
+	// High is the value that triggers a SpaceHigh event.
+	High int64
+
+	// Low is the value that triggers a SpaceLow event after a SpaceHigh
+	// one. It must be lower or equal to High, nil uses High and 0 waits
+	// for the metric to go back to zero.
+	// Default: High
+	Low *int64
+}
+
+type SpaceEventKind string
+
+const (
+	// SpaceHigh is emitted when a metric reaches its high watermark.
+	SpaceHigh SpaceEventKind = "high"
+
+	// SpaceLow is emitted when a metric goes back to its low watermark.
+	SpaceLow SpaceEventKind = "low"
+)
+
+// SpaceEvent is emitted by the SpaceWatcher when a metric crosses a watermark.
+type SpaceEvent struct {
+	Kind      SpaceEventKind
+	Threshold SpaceThreshold
+
+	// Value is the value of the metric.
+	Value int64
+
+	// Space is the space information that triggered the event.
+	Space Space
+
+	Time time.Time
+}
+
+// SpaceSample is a Space value polled at a given time.
+type SpaceSample struct {
+	Time  time.Time
+	Space Space
+}
+
+// spaceHistorySize is the number of samples kept by the SpaceWatcher.
+const spaceHistorySize = 60
+
+// spaceTracker applies the thresholds to the samples
+// and keeps the rolling history.
+type spaceTracker struct {
+	thresholds []SpaceThreshold
+	low        []int64
+	high       []bool
+	history    []SpaceSample
+}
+
+func newSpaceTracker(thresholds []SpaceThreshold) (*spaceTracker, error) {
+	t := &spaceTracker{
+		thresholds: make([]SpaceThreshold, len(thresholds)),
+		low:        make([]int64, len(thresholds)),
+		high:       make([]bool, len(thresholds)),
+	}
+
+	for i, th := range thresholds {
+		switch th.Metric {
+		case SpaceUsed, SpaceCommitted, SpaceBlocks:
+		default:
+			return nil, fmt.Errorf("unknown space metric %q", th.Metric)
+		}
+
+		low := th.High
+		if th.Low != nil {
+			low = *th.Low
+		}
+
+		if low > th.High {
+			return nil, fmt.Errorf("low watermark %d of %s is above its high watermark %d", low, th.Metric, th.High)
+		}
+
+		t.thresholds[i] = th
+		t.low[i] = low
+	}
+
+	return t, nil
+}
+
+// observe records the sample and returns the events it triggers.
+func (t *spaceTracker) observe(sample SpaceSample) []SpaceEvent {
+	t.history = append(t.history, sample)
+	if len(t.history) > spaceHistorySize {
+		t.history = t.history[len(t.history)-spaceHistorySize:]
+	}
+
+	var events []SpaceEvent
+	for i, th := range t.thresholds {
+		value := th.Metric.value(sample.Space)
+
+		var kind SpaceEventKind
+		switch {
+		case !t.high[i] && value >= th.High:
+			kind = SpaceHigh
+		case t.high[i] && value <= t.low[i]:
+			kind = SpaceLow
+		default:
+			continue
+		}
+
+		t.high[i] = kind == SpaceHigh
+		events = append(events, SpaceEvent{
+			Kind:      kind,
+			Threshold: th,
+			Value:     value,
+			Space:     sample.Space,
+			Time:      sample.Time,
+		})
+	}
+
+	return events
+}
+
+// fillRate returns the evolution of QuotaUsedBytes in bytes
+// per second over the history.
+func (t *spaceTracker) fillRate() (float64, bool) {
+	if len(t.history) < 2 {
+		return 0, false
+	}
+
+	first, last := t.history[0], t.history[len(t.history)-1]
+	elapsed := last.Time.Sub(first.Time).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+
+	return float64(last.Space.QuotaUsedBytes-first.Space.QuotaUsedBytes) / elapsed, true
+}
+
+// timeToFull predicts when QuotaUsedBytes reaches QuotaMaxBytes
+// at the current fill rate.
+func (t *spaceTracker) timeToFull() (time.Duration, bool) {
+	rate, ok := t.fillRate()
+	if !ok || rate <= 0 {
+		return 0, false
+	}
+
+	last := t.history[len(t.history)-1].Space
+	free := max(last.QuotaMaxBytes-last.QuotaUsedBytes, 0)
+
+	return time.Duration(float64(free) / rate * float64(time.Second)), true
+}
+
+// SpaceWatcher polls the space of a node, see WatchSpace.
+type SpaceWatcher struct {
+	events chan SpaceEvent
+
+	mu      sync.Mutex
+	tracker *spaceTracker
+	err     error
+}
+
+// WatchSpace polls Space every interval until the context is done and
+// emits an event when a threshold is crossed. The events must be consumed
+// from Events, the polling waits for them to be received.
+// The watcher keeps a short history of the samples to compute the fill rate
+// and predict when the quota will be full.
+func (node StorageNode) WatchSpace(ctx context.Context, interval time.Duration, thresholds []SpaceThreshold) (*SpaceWatcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid space watch interval %v", interval)
+	}
+
+	tracker, err := newSpaceTracker(thresholds)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &SpaceWatcher{
+		events:  make(chan SpaceEvent, len(thresholds)),
+		tracker: tracker,
+	}
+
+	go w.run(ctx, node, interval)
+
+	return w, nil
+}
+
+func (w *SpaceWatcher) run(ctx context.Context, node StorageNode, interval time.Duration) {
+	defer close(w.events)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		space, err := node.Space()
+
+		w.mu.Lock()
+		w.err = err
+		var events []SpaceEvent
+		if err == nil {
+			events = w.tracker.observe(SpaceSample{Time: time.Now(), Space: space})
+		}
+		w.mu.Unlock()
+
+		for _, event := range events {
+			select {
+			case w.events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Events returns the channel of the events. It is closed
+// when the context of the watcher is done.
+func (w *SpaceWatcher) Events() <-chan SpaceEvent {
+	return w.events
+}
+
+// Err returns the error of the last poll, if any.
+func (w *SpaceWatcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// History returns the last samples, oldest first.
+func (w *SpaceWatcher) History() []SpaceSample {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]SpaceSample(nil), w.tracker.history...)
+}
+
+// FillRate returns the evolution of QuotaUsedBytes in bytes per second
+// over the history. It returns false if there are not enough samples.
+func (w *SpaceWatcher) FillRate() (float64, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.tracker.fillRate()
+}
+
+// TimeToFull predicts the time until QuotaUsedBytes reaches QuotaMaxBytes
+// at the current fill rate. It returns false if the usage is not growing.
+func (w *SpaceWatcher) TimeToFull() (time.Duration, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.tracker.timeToFull()
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func spaceWatermark(v int64) *int64 {
+	return &v
+}
+
+func TestSpaceTrackerHysteresis(t *testing.T) {
+	tracker, err := newSpaceTracker([]SpaceThreshold{{Metric: SpaceUsed, High: 90, Low: spaceWatermark(70)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	values := []int64{50, 95, 85, 91, 75, 65, 92}
+	expected := []SpaceEventKind{"", SpaceHigh, "", "", "", SpaceLow, SpaceHigh}
+
+	for i, v := range values {
+		events := tracker.observe(SpaceSample{Time: now.Add(time.Duration(i) * time.Second), Space: Space{QuotaUsedBytes: v}})
+
+		var kind SpaceEventKind
+		if len(events) > 0 {
+			kind = events[0].Kind
+		}
+
+		if kind != expected[i] {
+			t.Fatalf("sample %d (%d): expected event %q, got %q", i, v, expected[i], kind)
+		}
+	}
+}
+
+func TestSpaceTrackerMetrics(t *testing.T) {
+	tracker, err := newSpaceTracker([]SpaceThreshold{
+		{Metric: SpaceCommitted, High: 100},
+		{Metric: SpaceBlocks, High: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := tracker.observe(SpaceSample{Space: Space{QuotaUsedBytes: 60, QuotaReservedBytes: 40, TotalBlocks: 5}})
+	if len(events) != 1 || events[0].Threshold.Metric != SpaceCommitted || events[0].Value != 100 {
+		t.Fatalf("expected a committed event, got %+v", events)
+	}
+}
+
+func TestSpaceTrackerLow(t *testing.T) {
+	tracker, err := newSpaceTracker([]SpaceThreshold{
+		{Metric: SpaceUsed, High: 90},
+		{Metric: SpaceBlocks, High: 10, Low: spaceWatermark(0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if events := tracker.observe(SpaceSample{Space: Space{QuotaUsedBytes: 95, TotalBlocks: 20}}); len(events) != 2 {
+		t.Fatalf("expected two high events, got %+v", events)
+	}
+
+	// Without Low, the event is emitted back at High, a zero Low waits for zero
+	events := tracker.observe(SpaceSample{Space: Space{QuotaUsedBytes: 90, TotalBlocks: 5}})
+	if len(events) != 1 || events[0].Kind != SpaceLow || events[0].Threshold.Metric != SpaceUsed {
+		t.Fatalf("expected a low event of the used space, got %+v", events)
+	}
+
+	events = tracker.observe(SpaceSample{Space: Space{QuotaUsedBytes: 0, TotalBlocks: 0}})
+	if len(events) != 1 || events[0].Kind != SpaceLow || events[0].Threshold.Metric != SpaceBlocks {
+		t.Fatalf("expected a low event of the blocks, got %+v", events)
+	}
+}
+
+func TestSpaceTrackerInvalidThreshold(t *testing.T) {
+	if _, err := newSpaceTracker([]SpaceThreshold{{Metric: SpaceUsed, High: 10, Low: spaceWatermark(20)}}); err == nil {
+		t.Fatal("expected an error when the low watermark is above the high one")
+	}
+
+	if _, err := newSpaceTracker([]SpaceThreshold{{Metric: "free", High: 10}}); err == nil {
+		t.Fatal("expected an error for an unknown metric")
+	}
+}
+
+func TestSpaceTrackerTimeToFull(t *testing.T) {
+	tracker, err := newSpaceTracker(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := tracker.timeToFull(); ok {
+		t.Fatal("expected no prediction without samples")
+	}
+
+	now := time.Now()
+	tracker.observe(SpaceSample{Time: now, Space: Space{QuotaMaxBytes: 1000, QuotaUsedBytes: 100}})
+	tracker.observe(SpaceSample{Time: now.Add(10 * time.Second), Space: Space{QuotaMaxBytes: 1000, QuotaUsedBytes: 200}})
+
+	rate, ok := tracker.fillRate()
+	if !ok || rate != 10 {
+		t.Fatalf("expected a fill rate of 10 bytes/s, got %v", rate)
+	}
+
+	ttf, ok := tracker.timeToFull()
+	if !ok || ttf != 80*time.Second {
+		t.Fatalf("expected 80s to full, got %v", ttf)
+	}
+}
+
+func TestWatchSpace(t *testing.T) {
+	storage := newStorageNode(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher, err := storage.WatchSpace(ctx, 100*time.Millisecond, []SpaceThreshold{{Metric: SpaceBlocks, High: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploadHelper(t, storage)
+
+	select {
+	case event := <-watcher.Events():
+		if event.Kind != SpaceHigh {
+			t.Fatalf("expected a high event, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a space event after the upload")
+	}
+
+	if len(watcher.History()) == 0 {
+		t.Fatal("expected the history to be non-empty")
+	}
+}
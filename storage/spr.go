@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSignature is returned when the signature of
+// a signed peer record does not match its content.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+const (
+	sprPrefix = "spr:"
+
+	// maxInlineKeyLength is the maximum size of a protobuf encoded
+	// public key embedded in a peer id with the identity multihash.
+	maxInlineKeyLength = 42
+)
+
+// The payload type of the peer records is the multicodec 0x0301.
+// The nodes write it as two raw bytes, the libp2p spec as a varint.
+var sprPayloadTypes = [][]byte{{0x03, 0x01}, binary.AppendUvarint(nil, 0x0301)}
+
+// sprDomains are the signature domains of the peer records:
+// the one used by the nodes and the one of the libp2p spec.
+var sprDomains = []string{"libp2p-peer-record", "libp2p-routing-state"}
+
+// KeyType is the type of a libp2p public key.
+type KeyType int
+
+const (
+	KeyRSA KeyType = iota
+	KeyEd25519
+	KeySecp256k1
+	KeyECDSA
+)
+
+func (t KeyType) String() string {
+	switch t {
+	case KeyRSA:
+		return "rsa"
+	case KeyEd25519:
+		return "ed25519"
+	case KeySecp256k1:
+		return "secp256k1"
+	case KeyECDSA:
+		return "ecdsa"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(t))
+	}
+}
+
+// SPR is a decoded signed peer record, like the ones returned by
+// Spr and used in Config.BootstrapNodes.
+type SPR struct {
+	PeerID PeerID
+
+	// SeqNo is the sequence number of the record. The nodes use the unix
+	// time of the creation of the record, see Time.
+	SeqNo uint64
+
+	Addrs []Multiaddr
+
+	KeyType KeyType
+
+	// PublicKey is the raw public key, like the 33 bytes
+	// of a compressed secp256k1 key.
+	PublicKey []byte
+
+	raw string
+}
+
+// sprEnvelope is the signed envelope of a record.
+type sprEnvelope struct {
+	publicKey   []byte
+	payloadType []byte
+	payload     []byte
+	signature   []byte
+}
+
+// ParseSPR decodes a "spr:" record and verifies its signature
+// and that the peer id is the one of the signing key.
+func ParseSPR(s string) (SPR, error) {
+	record, envelope, err := decodeSPR(s)
+	if err != nil {
+		return SPR{}, err
+	}
+
+	if err := envelope.verify(record); err != nil {
+		return SPR{}, err
+	}
+
+	return record, nil
+}
+
+// decodeSPR decodes a "spr:" record without verifying it.
+func decodeSPR(s string) (SPR, sprEnvelope, error) {
+	var envelope sprEnvelope
+
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(s), sprPrefix)
+	if !ok {
+		return SPR{}, envelope, fmt.Errorf("signed peer record must start with %s", sprPrefix)
+	}
+
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return SPR{}, envelope, fmt.Errorf("invalid signed peer record: %w", err)
+	}
+
+	fields, err := decodeProto(data)
+	if err != nil {
+		return SPR{}, envelope, fmt.Errorf("invalid signed peer record envelope: %w", err)
+	}
+
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			envelope.publicKey = f.bytes
+		case 2:
+			envelope.payloadType = f.bytes
+		case 3:
+			envelope.payload = f.bytes
+		case 5:
+			envelope.signature = f.bytes
+		}
+	}
+
+	if !isSPRPayloadType(envelope.payloadType) {
+		return SPR{}, envelope, fmt.Errorf("unexpected payload type %x in signed peer record", envelope.payloadType)
+	}
+
+	record := SPR{raw: sprPrefix + encoded}
+
+	record.KeyType, record.PublicKey, err = decodePublicKey(envelope.publicKey)
+	if err != nil {
+		return SPR{}, envelope, err
+	}
+
+	if err := record.decodePayload(envelope.payload); err != nil {
+		return SPR{}, envelope, err
+	}
+
+	return record, envelope, nil
+}
+
+// verify checks the signature of the envelope and that
+// the peer id of the record is the one of the signing key.
+func (e sprEnvelope) verify(record SPR) error {
+	var err error
+	for _, domain := range sprDomains {
+		err = verifyEnvelope(record.KeyType, record.PublicKey, sprSignedData(domain, e.payloadType, e.payload), e.signature)
+		if err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if expected := peerIDFromPublicKey(e.publicKey); record.PeerID != expected {
+		return fmt.Errorf("peer id %s of the record does not match its key %s", record.PeerID, expected)
+	}
+
+	return nil
+}
+
+func (r *SPR) decodePayload(payload []byte) error {
+	fields, err := decodeProto(payload)
+	if err != nil {
+		return fmt.Errorf("invalid peer record: %w", err)
+	}
+
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			r.PeerID = PeerID(base58Encode(f.bytes))
+			if err := r.PeerID.Validate(); err != nil {
+				return err
+			}
+		case 2:
+			r.SeqNo = f.varint
+		case 3:
+			info, err := decodeProto(f.bytes)
+			if err != nil {
+				return fmt.Errorf("invalid peer record address: %w", err)
+			}
+
+			for _, a := range info {
+				if a.num != 1 {
+					continue
+				}
+
+				addr, err := decodeMultiaddr(a.bytes)
+				if err != nil {
+					return fmt.Errorf("invalid peer record address: %w", err)
+				}
+				r.Addrs = append(r.Addrs, addr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// String returns the "spr:" text of the record.
+func (r SPR) String() string {
+	return r.raw
+}
+
+// Time returns the sequence number as a unix time.
+func (r SPR) Time() time.Time {
+	return time.Unix(int64(r.SeqNo), 0)
+}
+
+// Stale returns true if the record was created more than maxAge ago.
+func (r SPR) Stale(maxAge time.Duration) bool {
+	return time.Since(r.Time()) > maxAge
+}
+
+// Validate checks that the record can be used to dial the peer:
+// it has a valid peer id and at least one address.
+// The signature is verified by ParseSPR.
+func (r SPR) Validate() error {
+	if err := r.PeerID.Validate(); err != nil {
+		return err
+	}
+
+	if len(r.Addrs) == 0 {
+		return fmt.Errorf("signed peer record of %s has no address", r.PeerID)
+	}
+
+	return nil
+}
+
+// SignedPeerRecord decodes the SPR of the node.
+func (d DebugInfo) SignedPeerRecord() (SPR, error) {
+	return ParseSPR(d.Spr)
+}
+
+// SignedPeerRecord decodes the record of a routing table node.
+func (n Node) SignedPeerRecord() (SPR, error) {
+	return ParseSPR(n.Record)
+}
+
+func isSPRPayloadType(payloadType []byte) bool {
+	for _, t := range sprPayloadTypes {
+		if bytes.Equal(payloadType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// sprSignedData is the content signed by the envelope: the domain, the
+// payload type and the payload, each prefixed by its varint length.
+func sprSignedData(domain string, payloadType, payload []byte) []byte {
+	var b []byte
+	for _, part := range [][]byte{[]byte(domain), payloadType, payload} {
+		b = binary.AppendUvarint(b, uint64(len(part)))
+		b = append(b, part...)
+	}
+	return b
+}
+
+// decodePublicKey decodes a protobuf encoded libp2p public key.
+func decodePublicKey(data []byte) (KeyType, []byte, error) {
+	keyType, key, err := decodeKey(data)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	if keyType == KeySecp256k1 {
+		if _, err := secpParsePublicKey(key); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return keyType, key, nil
+}
+
+// decodeKey decodes the type and the raw bytes of a protobuf encoded
+// libp2p key, public or private. The key itself is not checked.
+func decodeKey(data []byte) (KeyType, []byte, error) {
+	fields, err := decodeProto(data)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	keyType, key := KeyType(-1), []byte(nil)
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			keyType = KeyType(f.varint)
+		case 2:
+			key = f.bytes
+		}
+	}
+
+	if keyType < KeyRSA || keyType > KeyECDSA || len(key) == 0 {
+		return 0, nil, errors.New("unknown key type or empty key")
+	}
+
+	return keyType, key, nil
+}
+
+// verifyEnvelope verifies the signature of the data with the public key.
+func verifyEnvelope(keyType KeyType, key, data, signature []byte) error {
+	hash := sha256.Sum256(data)
+
+	var ok bool
+	switch keyType {
+	case KeySecp256k1:
+		pub, err := secpParsePublicKey(key)
+		if err != nil {
+			return err
+		}
+		ok = secpVerify(pub, hash[:], signature)
+	case KeyEd25519:
+		if len(key) != ed25519.PublicKeySize {
+			return errors.New("invalid ed25519 public key")
+		}
+		ok = ed25519.Verify(ed25519.PublicKey(key), data, signature)
+	case KeyECDSA, KeyRSA:
+		pub, err := x509.ParsePKIXPublicKey(key)
+		if err != nil {
+			return fmt.Errorf("invalid %s public key: %w", keyType, err)
+		}
+
+		switch pub := pub.(type) {
+		case *ecdsa.PublicKey:
+			ok = ecdsa.VerifyASN1(pub, hash[:], signature)
+		case *rsa.PublicKey:
+			ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature) == nil
+		}
+	}
+
+	if !ok {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// peerIDFromPublicKey returns the peer id of a protobuf encoded public key:
+// the key itself if it is small enough, its sha2-256 hash otherwise.
+func peerIDFromPublicKey(pub []byte) PeerID {
+	code, digest := uint64(multihashIdentity), pub
+	if len(pub) > maxInlineKeyLength {
+		sum := sha256.Sum256(pub)
+		code, digest = multihashSha256, sum[:]
+	}
+
+	data := binary.AppendUvarint(nil, code)
+	data = binary.AppendUvarint(data, uint64(len(digest)))
+	data = append(data, digest...)
+
+	return PeerID(base58Encode(data))
+}
+
+// decodeBase64 accepts the url and standard alphabets,
+// with or without padding.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+
+	if strings.ContainsAny(s, "+/") {
+		return base64.RawStdEncoding.DecodeString(s)
+	}
+
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testnetSPR is the record of a testnet bootstrap node.
+const testnetSPR = "spr:CiUIAhIhAiJvIcA_ZwPZ9ugVKDbmqwhJZaig5zKyLiuaicRcCGqLEgIDARo8CicAJQgCEiECIm8hwD9nA9n26BUoNuarCEllqKDnMrIuK5qJxFwIaosQ3d6esAYaCwoJBJ_f8zKRAnU6KkYwRAIgM0MvWNJL296kJ9gWvfatfmVvT-A7O2s8Mxp8l9c8EW0CIC-h-H-jBVSgFjg3Eny2u33qF7BDnWFzo7fGfZ7_qc9P"
+
+// testSPR signs a peer record with a secp256k1 key derived from
+// the seed, with ip4/udp addresses.
+func testSPR(t *testing.T, seed byte, seqNo uint64, addrs ...netip.AddrPort) string {
+	t.Helper()
+
+	sum := sha256.Sum256([]byte{seed})
+	d := new(big.Int).Mod(new(big.Int).SetBytes(sum[:]), secpN)
+
+	pub := appendProtoVarint(nil, 1, uint64(KeySecp256k1))
+	pub = appendProtoBytes(pub, 2, secpCompress(secpMul(d, secpG())))
+
+	peerId, err := peerIDFromPublicKey(pub).Multihash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := appendProtoBytes(nil, 1, peerId)
+	payload = appendProtoVarint(payload, 2, seqNo)
+	for _, addr := range addrs {
+		ip := addr.Addr().As4()
+		ma := append([]byte{4}, ip[:]...)
+		ma = binary.AppendUvarint(ma, 273)
+		ma = binary.BigEndian.AppendUint16(ma, addr.Port())
+		payload = appendProtoBytes(payload, 3, appendProtoBytes(nil, 1, ma))
+	}
+
+	payloadType := []byte{0x03, 0x01}
+	hash := sha256.Sum256(sprSignedData("libp2p-peer-record", payloadType, payload))
+	z := new(big.Int).SetBytes(hash[:])
+
+	nonce := sha256.Sum256(append(d.Bytes(), hash[:]...))
+	k := new(big.Int).Mod(new(big.Int).SetBytes(nonce[:]), secpN)
+
+	r := new(big.Int).Mod(secpMul(k, secpG()).x, secpN)
+	s := new(big.Int).Mul(r, d)
+	s.Add(s, z).Mul(s, new(big.Int).ModInverse(k, secpN)).Mod(s, secpN)
+
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := appendProtoBytes(nil, 1, pub)
+	envelope = appendProtoBytes(envelope, 2, payloadType)
+	envelope = appendProtoBytes(envelope, 3, payload)
+	envelope = appendProtoBytes(envelope, 5, sig)
+
+	return "spr:" + base64.RawURLEncoding.EncodeToString(envelope)
+}
+
+func TestParseSPRTestnet(t *testing.T) {
+	spr, err := ParseSPR(testnetSPR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if spr.PeerID != "16Uiu2HAkwk68LSyCYa3HbmfkBLGRDLdQzB5nisydM5LR318iUUtA" {
+		t.Fatalf("unexpected peer id %s", spr.PeerID)
+	}
+
+	if spr.KeyType != KeySecp256k1 || len(spr.PublicKey) != 33 {
+		t.Fatalf("unexpected key %s %x", spr.KeyType, spr.PublicKey)
+	}
+
+	if spr.SeqNo != 1711779677 || !spr.Time().Equal(time.Unix(1711779677, 0)) {
+		t.Fatalf("unexpected seq no %d", spr.SeqNo)
+	}
+
+	if len(spr.Addrs) != 1 || spr.Addrs[0].String() != "/ip4/159.223.243.50/udp/30010" {
+		t.Fatalf("unexpected addresses %v", spr.Addrs)
+	}
+
+	if spr.String() != testnetSPR {
+		t.Fatal("expected the record text to be kept")
+	}
+
+	if err := spr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseSPRForged(t *testing.T) {
+	record := testSPR(t, 1, 42, netip.MustParseAddrPort("10.0.0.1:8090"))
+
+	spr, err := ParseSPR(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if spr.SeqNo != 42 || spr.Addrs[0].String() != "/ip4/10.0.0.1/udp/8090" {
+		t.Fatalf("unexpected record %+v", spr)
+	}
+
+	// Change the address of the record, keeping the signature
+	data, _ := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(record, "spr:"))
+	data = bytes.Replace(data, []byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}, 1)
+
+	forged := "spr:" + base64.RawURLEncoding.EncodeToString(data)
+	if _, err := ParseSPR(forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected an invalid signature, got %v", err)
+	}
+
+	if err := (Config{BootstrapNodes: []string{forged}}).Validate(); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected the configuration to reject the forged record, got %v", err)
+	}
+
+	options := LoadOptions{Overrides: Config{BootstrapNodes: []string{forged}}}
+	if _, err := LoadLayeredConfig(options); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected the loading to reject the forged record, got %v", err)
+	}
+
+	for _, s := range []string{"", "enr:abc", "spr:!!!", "spr:CiUIAhIh"} {
+		if _, err := ParseSPR(s); err == nil {
+			t.Fatalf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestSPRStale(t *testing.T) {
+	spr, err := ParseSPR(testSPR(t, 1, uint64(time.Now().Add(-2*time.Hour).Unix()), netip.MustParseAddrPort("10.0.0.1:8090")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !spr.Stale(time.Hour) || spr.Stale(3*time.Hour) {
+		t.Fatal("unexpected staleness")
+	}
+
+	noAddr, err := ParseSPR(testSPR(t, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := noAddr.Validate(); err == nil {
+		t.Fatal("expected a record without address to be invalid")
+	}
+}
+
+func TestSecpParsePublicKeyRange(t *testing.T) {
+	// Find a point with a small x, so that x + P fits in 32 bytes
+	x := big.NewInt(1)
+	var y *big.Int
+	for ; ; x.Add(x, big.NewInt(1)) {
+		p, err := secpParsePublicKey(append([]byte{2}, x.FillBytes(make([]byte, 32))...))
+		if err == nil {
+			y = p.y
+			break
+		}
+	}
+
+	uncompressed := func(x, y *big.Int) []byte {
+		b := []byte{4}
+		b = append(b, x.FillBytes(make([]byte, 32))...)
+		return append(b, y.FillBytes(make([]byte, 32))...)
+	}
+
+	if _, err := secpParsePublicKey(uncompressed(x, y)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same point modulo P, out of the field range
+	if _, err := secpParsePublicKey(uncompressed(new(big.Int).Add(x, secpP), y)); err == nil {
+		t.Fatal("expected an error for a coordinate above P")
+	}
+}
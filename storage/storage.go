@@ -1,7 +1,15 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"path"
+	"strings"
+	"time"
 	"unsafe"
 )
 
@@ -55,36 +63,167 @@ type Space struct {
 	QuotaReservedBytes int64 `json:"quotaReservedBytes"`
 }
 
+// ManifestFilter filters the manifests returned by ManifestsSeq.
+// The zero value matches all the manifests.
+type ManifestFilter struct {
+	// Mimetype is the MIME type of the manifests.
+	Mimetype string
+
+	// FilenameGlob is a pattern matched against the filename,
+	// with the path.Match syntax, e.g "*.mp4".
+	FilenameGlob string
+
+	// MinSize is the minimum dataset size.
+	MinSize int
+
+	// MaxSize is the maximum dataset size, 0 means no maximum.
+	MaxSize int
+
+	// Protected, if set, keeps only the manifests with
+	// this Protected value.
+	Protected *bool
+
+	// Offset is the number of matching manifests to skip.
+	Offset int
+
+	// Limit is the maximum number of manifests, 0 means no limit.
+	Limit int
+}
+
+func (f ManifestFilter) match(m Manifest) bool {
+	if f.Mimetype != "" && f.Mimetype != m.Mimetype {
+		return false
+	}
+
+	if f.FilenameGlob != "" {
+		if ok, _ := path.Match(f.FilenameGlob, m.Filename); !ok {
+			return false
+		}
+	}
+
+	if m.DatasetSize < f.MinSize || (f.MaxSize > 0 && m.DatasetSize > f.MaxSize) {
+		return false
+	}
+
+	if f.Protected != nil && *f.Protected != m.Protected {
+		return false
+	}
+
+	return true
+}
+
 // Manifests returns the list of all manifests stored by the Logos Storage node.
 func (node StorageNode) Manifests() ([]Manifest, error) {
+	var list []Manifest
+
+	for m, err := range node.ManifestsSeq(ManifestFilter{}) {
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, m)
+	}
+
+	return list, nil
+}
+
+// ManifestsSeq iterates over the manifests stored by the Logos Storage node
+// matching the filter.
+// The library returns the whole list at once, but the manifests are decoded
+// and filtered one by one, so the full list is never held as Go values.
+// The iteration stops after the first error.
+func (node StorageNode) ManifestsSeq(filter ManifestFilter) iter.Seq2[Manifest, error] {
+	return func(yield func(Manifest, error) bool) {
+		if filter.FilenameGlob != "" {
+			if _, err := path.Match(filter.FilenameGlob, ""); err != nil {
+				yield(Manifest{}, fmt.Errorf("invalid filename glob %q: %w", filter.FilenameGlob, err))
+				return
+			}
+		}
+
+		value, err := node.storageList()
+		if err != nil {
+			yield(Manifest{}, err)
+			return
+		}
+
+		decodeManifests(strings.NewReader(value), filter, yield)
+	}
+}
+
+// storageList returns the JSON list of the manifests.
+func (node StorageNode) storageList() (value string, err error) {
+	op := node.observe(OpManifests, nil)
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
 	if C.cGoStorageStorageList(node.ctx, bridge.resp) != C.RET_OK {
-		return nil, bridge.callError("cGoStorageStorageList")
+		return "", bridge.callError("cGoStorageStorageList")
 	}
-	value, err := bridge.wait()
+
+	value, err = bridge.wait()
+	op.set(AttrBytes, len(value))
+	return value, err
+}
+
+// decodeManifests decodes the storage_list JSON array item by item
+// and yields the manifests matching the filter.
+func decodeManifests(r io.Reader, filter ManifestFilter, yield func(Manifest, error) bool) {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
 	if err != nil {
-		return nil, err
+		yield(Manifest{}, err)
+		return
 	}
 
-	var items []manifestWithCid
-	err = json.Unmarshal([]byte(value), &items)
-	if err != nil {
-		return nil, err
+	// The library returns null when there is no manifest
+	if tok == nil {
+		return
 	}
 
-	var list []Manifest
-	for _, item := range items {
-		item.Manifest.Cid = item.Cid
-		list = append(list, item.Manifest)
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		yield(Manifest{}, fmt.Errorf("unexpected manifest list token %v", tok))
+		return
 	}
 
-	return list, err
+	skipped, count := 0, 0
+	for dec.More() {
+		var item manifestWithCid
+		if err := dec.Decode(&item); err != nil {
+			yield(Manifest{}, err)
+			return
+		}
+
+		item.Manifest.Cid = item.Cid
+
+		if !filter.match(item.Manifest) {
+			continue
+		}
+
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+
+		if !yield(item.Manifest, nil) {
+			return
+		}
+
+		count++
+		if filter.Limit > 0 && count >= filter.Limit {
+			return
+		}
+	}
 }
 
 // Fetch download a file from the network and store it to the local node.
-func (node StorageNode) Fetch(cid string) (Manifest, error) {
+func (node StorageNode) Fetch(cid string) (_ Manifest, err error) {
+	op := node.observe(OpFetch, Attrs{AttrCid: cid})
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -107,12 +246,130 @@ func (node StorageNode) Fetch(cid string) (Manifest, error) {
 	}
 
 	manifest.Cid = cid
+	node.accesses.Touch(cid)
+	return manifest, nil
+}
+
+// FetchProgress describes the progress of FetchContext.
+type FetchProgress struct {
+	// BlocksStored is the number of blocks stored so far.
+	BlocksStored int
+
+	// TotalBlocks is the number of blocks of the dataset.
+	TotalBlocks int
+
+	// BytesStored is the number of bytes stored so far.
+	BytesStored int
+
+	// DatasetSize is the total size of the dataset, taken from the manifest.
+	DatasetSize int
+
+	// Percent is the percentage of the dataset stored so far.
+	Percent float64
+}
+
+type OnFetchProgressFunc func(progress FetchProgress)
+
+// FetchOptions is used to fetch a dataset with FetchContext.
+type FetchOptions struct {
+	// OnProgress is a callback function that is called after
+	// each block is stored in the local node.
+	OnProgress OnFetchProgressFunc
+
+	// Timeout is the maximum duration of the fetch, 0 means no timeout.
+	Timeout time.Duration
+}
+
+// FetchContext downloads a dataset from the network and stores it to the
+// local node, like Fetch, but reports the progress and can be cancelled.
+//
+// The manifest is retrieved first, then the blocks are streamed from the
+// network with the dataset block size, so that each chunk received is a
+// block stored. If the context is cancelled or the timeout is reached, the
+// download session is cancelled, which stops the network transfer. The
+// blocks already stored are kept.
+func (node StorageNode) FetchContext(ctx context.Context, cid string, options FetchOptions) (_ Manifest, err error) {
+	op := node.observe(OpFetch, Attrs{AttrCid: cid})
+	defer op.end(&err)
+
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	type manifestResult struct {
+		manifest Manifest
+		err      error
+	}
+
+	// The manifest retrieval cannot be cancelled, so it is
+	// abandoned if the context is done before it returns.
+	channelManifest := make(chan manifestResult, 1)
+	go func() {
+		manifest, err := node.DownloadManifest(cid)
+		channelManifest <- manifestResult{manifest, err}
+	}()
+
+	var manifest Manifest
+	select {
+	case res := <-channelManifest:
+		if res.err != nil {
+			return Manifest{}, res.err
+		}
+		manifest = res.manifest
+	case <-ctx.Done():
+		return Manifest{}, ctx.Err()
+	}
+
+	totalBlocks := 0
+	if manifest.BlockSize > 0 {
+		totalBlocks = (manifest.DatasetSize + manifest.BlockSize - 1) / manifest.BlockSize
+	}
+
+	opts := DownloadStreamOptions{
+		ChunkSize:   ChunkSize(manifest.BlockSize),
+		DatasetSize: manifest.DatasetSize,
+	}
+
+	if options.OnProgress != nil {
+		opts.OnProgress = func(read, total int, percent float64, err error) {
+			if err != nil {
+				return
+			}
+
+			blocks := totalBlocks
+			if manifest.BlockSize > 0 {
+				blocks = min((total+manifest.BlockSize-1)/manifest.BlockSize, totalBlocks)
+			}
+
+			options.OnProgress(FetchProgress{
+				BlocksStored: blocks,
+				TotalBlocks:  totalBlocks,
+				BytesStored:  total,
+				DatasetSize:  manifest.DatasetSize,
+				Percent:      min(percent, 100.0),
+			})
+		}
+	}
+
+	if err := node.DownloadStream(ctx, cid, opts); err != nil {
+		// Return the context error to distinguish
+		// the timeout from the cancellation.
+		if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+			return Manifest{}, ctx.Err()
+		}
+
+		return Manifest{}, err
+	}
+
 	return manifest, nil
 }
 
 // Space returns information about the storage space used and available.
-func (node StorageNode) Space() (Space, error) {
-	var space Space
+func (node StorageNode) Space() (space Space, err error) {
+	op := node.observe(OpSpace, nil)
+	defer op.end(&err)
 
 	bridge := newBridgeCtx()
 	defer bridge.free()
@@ -132,7 +389,10 @@ func (node StorageNode) Space() (Space, error) {
 
 // Deletes either a single block or an entire dataset
 // from the local node. Does nothing if the dataset is not locally available.
-func (node StorageNode) Delete(cid string) error {
+func (node StorageNode) Delete(cid string) (err error) {
+	op := node.observe(OpDelete, Attrs{AttrCid: cid})
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -143,12 +403,19 @@ func (node StorageNode) Delete(cid string) error {
 		return bridge.callError("cGoStorageStorageDelete")
 	}
 
-	_, err := bridge.wait()
-	return err
+	if _, err := bridge.wait(); err != nil {
+		return err
+	}
+
+	node.accesses.Forget(cid)
+	return nil
 }
 
 // Exists checks if a given cid exists in the local storage.
-func (node StorageNode) Exists(cid string) (bool, error) {
+func (node StorageNode) Exists(cid string) (_ bool, err error) {
+	op := node.observe(OpExists, Attrs{AttrCid: cid})
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
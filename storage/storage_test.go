@@ -1,6 +1,13 @@
 package storage
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestManifests(t *testing.T) {
 	storage := newStorageNode(t)
@@ -32,6 +39,77 @@ func TestManifests(t *testing.T) {
 	}
 }
 
+func TestDecodeManifests(t *testing.T) {
+	list := `[
+		{"cid": "a", "manifest": {"datasetSize": 100, "filename": "a.txt", "mimetype": "text/plain"}},
+		{"cid": "b", "manifest": {"datasetSize": 2000, "filename": "b.mp4", "mimetype": "video/mp4", "protected": true}},
+		{"cid": "c", "manifest": {"datasetSize": 300, "filename": "c.txt", "mimetype": "text/plain"}}
+	]`
+
+	protected := true
+	tests := []struct {
+		name     string
+		filter   ManifestFilter
+		expected []string
+	}{
+		{"all", ManifestFilter{}, []string{"a", "b", "c"}},
+		{"mimetype", ManifestFilter{Mimetype: "text/plain"}, []string{"a", "c"}},
+		{"glob", ManifestFilter{FilenameGlob: "*.mp4"}, []string{"b"}},
+		{"size range", ManifestFilter{MinSize: 200, MaxSize: 1000}, []string{"c"}},
+		{"protected", ManifestFilter{Protected: &protected}, []string{"b"}},
+		{"offset and limit", ManifestFilter{Offset: 1, Limit: 1}, []string{"b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cids []string
+			decodeManifests(strings.NewReader(list), tt.filter, func(m Manifest, err error) bool {
+				if err != nil {
+					t.Fatal(err)
+				}
+				cids = append(cids, m.Cid)
+				return true
+			})
+
+			if !slices.Equal(cids, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, cids)
+			}
+		})
+	}
+}
+
+func TestDecodeManifestsInvalid(t *testing.T) {
+	var err error
+	decodeManifests(strings.NewReader(`[{"cid": 1}]`), ManifestFilter{}, func(_ Manifest, e error) bool {
+		err = e
+		return true
+	})
+
+	if err == nil {
+		t.Fatal("expected an error when decoding an invalid list")
+	}
+}
+
+func TestManifestsSeq(t *testing.T) {
+	storage := newStorageNode(t)
+
+	cid, _ := uploadHelper(t, storage)
+	uploadBigFileHelper(t, storage)
+
+	var cids []string
+	for m, err := range storage.ManifestsSeq(ManifestFilter{MaxSize: 1024}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cids = append(cids, m.Cid)
+	}
+
+	if !slices.Equal(cids, []string{cid}) {
+		t.Fatalf("expected only %s, got %v", cid, cids)
+	}
+}
+
 func TestSpace(t *testing.T) {
 	storage := newStorageNode(t)
 
@@ -92,6 +170,63 @@ func TestFetchCidDoesNotExist(t *testing.T) {
 	}
 }
 
+func TestFetchContext(t *testing.T) {
+	storage := newStorageNode(t)
+
+	cid, len := uploadHelper(t, storage)
+
+	var last FetchProgress
+	manifest, err := storage.FetchContext(context.Background(), cid, FetchOptions{
+		OnProgress: func(progress FetchProgress) {
+			last = progress
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.Cid != cid {
+		t.Errorf("expected cid %q, got %q", cid, manifest.Cid)
+	}
+
+	if last.BytesStored != len {
+		t.Errorf("expected %d bytes stored, got %d", len, last.BytesStored)
+	}
+
+	if last.TotalBlocks == 0 || last.BlocksStored != last.TotalBlocks {
+		t.Errorf("expected all the blocks to be stored, got %d/%d", last.BlocksStored, last.TotalBlocks)
+	}
+
+	if last.Percent != 100.0 {
+		t.Errorf("expected final percent 100.0, got %.2f", last.Percent)
+	}
+}
+
+func TestFetchContextCancelled(t *testing.T) {
+	storage := newStorageNode(t)
+
+	cid, _ := uploadBigFileHelper(t, storage)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := storage.FetchContext(ctx, cid, FetchOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestFetchContextTimeout(t *testing.T) {
+	storage := newStorageNode(t)
+
+	_, err := storage.FetchContext(context.Background(), "bafybeihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", FetchOptions{
+		Timeout: 100 * time.Millisecond,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
 func TestDelete(t *testing.T) {
 	storage := newStorageNode(t)
 
@@ -0,0 +1,243 @@
+// Package storagetest provides helpers to test applications
+// with several Logos Storage nodes running in the same process.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/logos-storage/logos-storage-go-bindings/storage"
+)
+
+// Options configures a cluster.
+type Options struct {
+	// Config is the base configuration of the nodes. DataDir,
+	// DiscoveryPort, ListenAddrs and BootstrapNodes are set
+	// by the cluster for each node.
+	Config storage.Config
+
+	// Timeout is the maximum time to wait for the nodes
+	// to see each other in their routing tables.
+	// Default: 1 minute
+	Timeout time.Duration
+
+	// PollInterval is the interval between two checks of the
+	// routing tables.
+	// Default: 200 milliseconds
+	PollInterval time.Duration
+}
+
+// Cluster is a set of started nodes sharing a bootstrap node.
+type Cluster struct {
+	t testing.TB
+
+	// Bootstrap is the node whose SPR is used by the other nodes.
+	Bootstrap *storage.StorageNode
+
+	// Nodes are the nodes of the cluster, without the bootstrap node.
+	Nodes []*storage.StorageNode
+
+	// PeerIds are the peer ids of the nodes, in the same order.
+	PeerIds []string
+}
+
+// NewCluster starts a bootstrap node and n nodes pointing at its SPR,
+// on free ports, and waits until each node sees the others in
+// Debug().PeersTable. The nodes are stopped and destroyed
+// at the end of the test.
+func NewCluster(t testing.TB, n int, options Options) *Cluster {
+	t.Helper()
+
+	if options.Timeout == 0 {
+		options.Timeout = time.Minute
+	}
+
+	if options.PollInterval == 0 {
+		options.PollInterval = 200 * time.Millisecond
+	}
+
+	c := &Cluster{t: t}
+
+	c.Bootstrap = startNode(t, options.Config)
+
+	spr, err := c.Bootstrap.Spr()
+	if err != nil {
+		t.Fatalf("Failed to get bootstrap spr: %v", err)
+	}
+
+	for i := 0; i < n; i++ {
+		config := options.Config
+		config.BootstrapNodes = []string{spr}
+
+		node := startNode(t, config)
+
+		peerId, err := node.PeerId()
+		if err != nil {
+			t.Fatalf("Failed to get peer id of node %d: %v", i, err)
+		}
+
+		c.Nodes = append(c.Nodes, node)
+		c.PeerIds = append(c.PeerIds, peerId)
+	}
+
+	if err := c.wait(options.Timeout, options.PollInterval); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// startNode creates and starts a node with its own data
+// directory and free ports.
+func startNode(t testing.TB, config storage.Config) *storage.StorageNode {
+	t.Helper()
+
+	config.DataDir = t.TempDir()
+	config.DiscoveryPort = FreeUDPPort(t)
+	config.ListenAddrs = []string{fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", FreeTCPPort(t))}
+
+	if config.LogFormat == "" {
+		config.LogFormat = storage.LogFormatNoColors
+	}
+
+	if config.Nat == "" {
+		config.Nat = storage.NatNone
+	}
+
+	node, err := storage.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create Logos Storage node: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := node.Stop(); err != nil {
+			t.Logf("cleanup storage: %v", err)
+		}
+
+		if err := node.Destroy(); err != nil {
+			t.Logf("cleanup storage: %v", err)
+		}
+	})
+
+	if err := node.Start(); err != nil {
+		t.Fatalf("Failed to start Logos Storage node: %v", err)
+	}
+
+	return node
+}
+
+// wait polls the routing tables until each node sees the others.
+func (c *Cluster) wait(timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		missing, err := c.missingPeers()
+		if err != nil {
+			return err
+		}
+
+		if len(missing) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("nodes not connected after %s: %v", timeout, missing)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// missingPeers returns, for each node index, the peer
+// ids missing from its routing table.
+func (c *Cluster) missingPeers() (map[int][]string, error) {
+	missing := map[int][]string{}
+
+	for i, node := range c.Nodes {
+		info, err := node.Debug()
+		if err != nil {
+			return nil, fmt.Errorf("debug of node %d: %w", i, err)
+		}
+
+		var seen []string
+		for _, n := range info.PeersTable.Nodes {
+			seen = append(seen, n.PeerId)
+		}
+
+		for j, peerId := range c.PeerIds {
+			if i != j && !slices.Contains(seen, peerId) {
+				missing[i] = append(missing[i], peerId)
+			}
+		}
+	}
+
+	return missing, nil
+}
+
+// Node returns the node i of the cluster.
+func (c *Cluster) Node(i int) *storage.StorageNode {
+	c.t.Helper()
+
+	if i < 0 || i >= len(c.Nodes) {
+		c.t.Fatalf("node %d out of range, the cluster has %d nodes", i, len(c.Nodes))
+	}
+
+	return c.Nodes[i]
+}
+
+// UploadOn uploads the data on the node i and returns its cid.
+func (c *Cluster) UploadOn(i int, data []byte) string {
+	c.t.Helper()
+
+	cid, err := c.Node(i).UploadReader(context.Background(), storage.UploadOptions{Filepath: "data.bin"}, bytes.NewReader(data))
+	if err != nil {
+		c.t.Fatalf("Failed to upload on node %d: %v", i, err)
+	}
+
+	return cid
+}
+
+// DownloadFrom downloads the content of the cid from the
+// network with the node j.
+func (c *Cluster) DownloadFrom(j int, cid string) []byte {
+	c.t.Helper()
+
+	var buf bytes.Buffer
+	if err := c.Node(j).DownloadStream(context.Background(), cid, storage.DownloadStreamOptions{Writer: &buf}); err != nil {
+		c.t.Fatalf("Failed to download %s from node %d: %v", cid, j, err)
+	}
+
+	return buf.Bytes()
+}
+
+// FreeTCPPort returns a TCP port available on the loopback interface.
+func FreeTCPPort(t testing.TB) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free tcp port: %v", err)
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// FreeUDPPort returns a UDP port available on all the interfaces,
+// like the discovery port.
+func FreeUDPPort(t testing.TB) int {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find a free udp port: %v", err)
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
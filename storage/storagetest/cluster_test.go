@@ -0,0 +1,33 @@
+package storagetest
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFreePorts(t *testing.T) {
+	if port := FreeTCPPort(t); port <= 0 || port > 65535 {
+		t.Fatalf("unexpected tcp port %d", port)
+	}
+
+	if port := FreeUDPPort(t); port <= 0 || port > 65535 {
+		t.Fatalf("unexpected udp port %d", port)
+	}
+}
+
+func TestCluster(t *testing.T) {
+	c := NewCluster(t, 3, Options{})
+
+	if len(c.Nodes) != 3 || len(c.PeerIds) != 3 {
+		t.Fatalf("expected 3 nodes, got %d", len(c.Nodes))
+	}
+
+	data := []byte("Hello World!")
+	cid := c.UploadOn(0, data)
+
+	for j := 1; j < len(c.Nodes); j++ {
+		if got := c.DownloadFrom(j, cid); !bytes.Equal(got, data) {
+			t.Fatalf("node %d downloaded %q, expected %q", j, got, data)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package storage
 
 import (
 	"bytes"
+	"cmp"
 	"context"
+	"net"
 	"testing"
 )
 
@@ -15,15 +17,38 @@ func defaultConfigHelper(t *testing.T) Config {
 		MetricsEnabled: false,
 		BlockRetries:   3000,
 		Nat:            "none",
+		DiscoveryPort:  freeUDPPort(t),
 	}
 }
 
+// freeUDPPort returns a free discovery port, so the nodes
+// of the tests running in parallel do not clash.
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find a free udp port: %v", err)
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
 func newStorageNode(t *testing.T, opts ...Config) *StorageNode {
 	config := defaultConfigHelper(t)
 
 	if len(opts) > 0 {
 		c := opts[0]
 
+		if c.DataDir != "" {
+			config.DataDir = c.DataDir
+		}
+
+		if c.RepoKind != "" {
+			config.RepoKind = c.RepoKind
+		}
+
 		if c.BlockRetries > 0 {
 			config.BlockRetries = c.BlockRetries
 		}
@@ -52,11 +77,16 @@ func newStorageNode(t *testing.T, opts ...Config) *StorageNode {
 			config.NumThreads = c.NumThreads
 		}
 
-		if c.BlockTtl != "" {
+		if c.BlockTtl != nil {
 			config.BlockTtl = c.BlockTtl
 		}
 
-		if c.BlockMaintenanceInterval != "" {
+		if c.MetricsEnabled {
+			config.MetricsEnabled = true
+			config.MetricsPort = cmp.Or(c.MetricsPort, MetricsPortFree)
+		}
+
+		if c.BlockMaintenanceInterval != nil {
 			config.BlockMaintenanceInterval = c.BlockMaintenanceInterval
 		}
 	}
@@ -66,7 +96,20 @@ func newStorageNode(t *testing.T, opts ...Config) *StorageNode {
 		t.Fatalf("Failed to create Logos Storage node: %v", err)
 	}
 
-	err = node.Start()
+	// The free metrics port can be taken before the node binds it,
+	// see MetricsPortFree, so the node is created again with another one
+	for attempt := 1; ; attempt++ {
+		err = node.Start()
+		if err == nil || config.MetricsPort != MetricsPortFree || attempt == 3 {
+			break
+		}
+
+		node.Destroy()
+		if node, err = New(config); err != nil {
+			t.Fatalf("Failed to create Logos Storage node: %v", err)
+		}
+	}
+
 	if err != nil {
 		t.Fatalf("Failed to start Logos Storage node: %v", err)
 	}
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parses the subset of TOML used by the configuration files:
+// top level key/value pairs with strings, integers, floats, booleans
+// and arrays. Tables are not supported because the configuration is flat.
+func parseTOML(data string) (map[string]any, error) {
+	p := &tomlParser{data: data, line: 1}
+	values := map[string]any{}
+
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return values, nil
+		}
+
+		if p.peek() == '[' {
+			return nil, p.errorf("tables are not supported")
+		}
+
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpace(false)
+		if p.eof() || p.peek() != '=' {
+			return nil, p.errorf("expected = after %q", key)
+		}
+		p.pos++
+		p.skipSpace(false)
+
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := values[key]; ok {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		values[key] = value
+
+		p.skipSpace(false)
+		if !p.eof() && p.peek() != '\n' && p.peek() != '\r' {
+			return nil, p.errorf("expected a new line after the value of %q", key)
+		}
+	}
+}
+
+type tomlParser struct {
+	data string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("toml line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.data)
+}
+
+func (p *tomlParser) peek() byte {
+	return p.data[p.pos]
+}
+
+// skipSpace skips the spaces and the comments,
+// and the new lines if newlines is set.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		case newlines && (c == '\n' || c == '\r'):
+			if c == '\n' {
+				p.line++
+			}
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) key() (string, error) {
+	if c := p.peek(); c == '"' || c == '\'' {
+		return p.str()
+	}
+
+	start := p.pos
+	for !p.eof() && isTOMLBareKey(p.peek()) {
+		p.pos++
+	}
+
+	if start == p.pos {
+		return "", p.errorf("invalid key")
+	}
+
+	return p.data[start:p.pos], nil
+}
+
+func isTOMLBareKey(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) value() (any, error) {
+	if p.eof() {
+		return nil, p.errorf("missing value")
+	}
+
+	switch p.peek() {
+	case '"', '\'':
+		return p.str()
+	case '[':
+		return p.array()
+	}
+
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n#,]", rune(p.peek())) {
+		p.pos++
+	}
+	raw := p.data[start:p.pos]
+
+	switch raw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+
+	num := strings.ReplaceAll(raw, "_", "")
+	if n, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return n, nil
+	}
+
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, nil
+	}
+
+	return nil, p.errorf("invalid value %q", raw)
+}
+
+func (p *tomlParser) str() (string, error) {
+	quote := p.peek()
+	end := strings.IndexByte(p.data[p.pos+1:], quote)
+
+	// Skip the escaped quotes of basic strings
+	for quote == '"' && end >= 0 && isEscaped(p.data, p.pos+1+end) {
+		next := strings.IndexByte(p.data[p.pos+2+end:], quote)
+		if next < 0 {
+			end = -1
+			break
+		}
+		end += next + 1
+	}
+
+	if end < 0 {
+		return "", p.errorf("unterminated string")
+	}
+
+	raw := p.data[p.pos : p.pos+end+2]
+	if strings.ContainsAny(raw, "\n\r") {
+		return "", p.errorf("multi-line strings are not supported")
+	}
+	p.pos += end + 2
+
+	if quote == '\'' {
+		return raw[1 : len(raw)-1], nil
+	}
+
+	s, err := strconv.Unquote(raw)
+	if err != nil {
+		return "", p.errorf("invalid string %s", raw)
+	}
+
+	return s, nil
+}
+
+// isEscaped returns true if the character at i is preceded
+// by an odd number of backslashes.
+func isEscaped(s string, i int) bool {
+	n := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+func (p *tomlParser) array() ([]any, error) {
+	p.pos++
+
+	values := []any{}
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+
+		if p.peek() == ']' {
+			p.pos++
+			return values, nil
+		}
+
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+
+		p.skipSpace(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
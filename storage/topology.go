@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// TopologyNode is a peer of the graph built by BuildTopology.
+type TopologyNode struct {
+	PeerId  string `json:"peerId"`
+	NodeId  string `json:"nodeId,omitempty"`
+	Address string `json:"address,omitempty"`
+
+	// Local is true if the graph includes the routing table of the node.
+	Local bool `json:"local"`
+
+	// Unreachable is true if the node is only known from the routing
+	// tables of the others, and none of them has seen it.
+	Unreachable bool `json:"unreachable"`
+
+	// NoAddress is true if no routing table has an address for the node.
+	NoAddress bool `json:"noAddress"`
+}
+
+// TopologyEdge means that the routing table of From contains To.
+type TopologyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Seen is the Seen flag of the routing table entry.
+	Seen bool `json:"seen"`
+
+	// Asymmetric is true if the routing table of To is
+	// in the graph and does not contain From.
+	Asymmetric bool `json:"asymmetric"`
+}
+
+// Topology is the graph of the routing tables of a set of nodes.
+// It is serialized in JSON, and in Graphviz with DOT.
+type Topology struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+}
+
+// TopologyFromNodes builds the topology from the routing tables of the nodes.
+func TopologyFromNodes(nodes ...*StorageNode) (Topology, error) {
+	snapshots := make([]DebugInfo, 0, len(nodes))
+	for _, node := range nodes {
+		info, err := node.Debug()
+		if err != nil {
+			return Topology{}, err
+		}
+		snapshots = append(snapshots, info)
+	}
+
+	return BuildTopology(snapshots...), nil
+}
+
+// LoadDebugInfo reads a DebugInfo snapshot saved in JSON,
+// like the output of the debug/info endpoint.
+func LoadDebugInfo(path string) (DebugInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DebugInfo{}, err
+	}
+
+	var info DebugInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return DebugInfo{}, fmt.Errorf("invalid debug info %s: %w", path, err)
+	}
+
+	return info, nil
+}
+
+// BuildTopology merges the routing tables of the snapshots into a graph.
+// The nodes and edges are sorted by peer id.
+func BuildTopology(snapshots ...DebugInfo) Topology {
+	nodes := map[string]*TopologyNode{}
+	edges := map[[2]string]*TopologyEdge{}
+	seen := map[string]bool{}
+
+	add := func(n Node) *TopologyNode {
+		tn, ok := nodes[n.PeerId]
+		if !ok {
+			tn = &TopologyNode{PeerId: n.PeerId}
+			nodes[n.PeerId] = tn
+		}
+
+		if tn.NodeId == "" {
+			tn.NodeId = n.NodeId
+		}
+
+		if tn.Address == "" && n.Address != nil {
+			tn.Address = *n.Address
+		}
+
+		return tn
+	}
+
+	for _, info := range snapshots {
+		local := info.PeersTable.LocalNode
+		if local.PeerId == "" {
+			local.PeerId = info.ID
+		}
+
+		add(local).Local = true
+
+		for _, n := range info.PeersTable.Nodes {
+			if n.PeerId == "" || n.PeerId == local.PeerId {
+				continue
+			}
+
+			add(n)
+			seen[n.PeerId] = seen[n.PeerId] || n.Seen
+
+			key := [2]string{local.PeerId, n.PeerId}
+			if e, ok := edges[key]; ok {
+				e.Seen = e.Seen || n.Seen
+			} else {
+				edges[key] = &TopologyEdge{From: local.PeerId, To: n.PeerId, Seen: n.Seen}
+			}
+		}
+	}
+
+	var t Topology
+
+	for _, e := range edges {
+		_, reverse := edges[[2]string{e.To, e.From}]
+		e.Asymmetric = nodes[e.To].Local && !reverse
+		t.Edges = append(t.Edges, *e)
+	}
+
+	for _, n := range nodes {
+		n.Unreachable = !n.Local && !seen[n.PeerId]
+		n.NoAddress = n.Address == ""
+		t.Nodes = append(t.Nodes, *n)
+	}
+
+	slices.SortFunc(t.Nodes, func(a, b TopologyNode) int {
+		return strings.Compare(a.PeerId, b.PeerId)
+	})
+
+	slices.SortFunc(t.Edges, func(a, b TopologyEdge) int {
+		return cmp.Or(strings.Compare(a.From, b.From), strings.Compare(a.To, b.To))
+	})
+
+	return t
+}
+
+// Node returns the node with the peer id.
+func (t Topology) Node(peerId string) (TopologyNode, bool) {
+	for _, n := range t.Nodes {
+		if n.PeerId == peerId {
+			return n, true
+		}
+	}
+	return TopologyNode{}, false
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language. The nodes whose
+// routing table is known are filled, the unreachable nodes are red and
+// the nodes without address dashed. The edges of entries not seen are
+// dotted and the asymmetric ones orange.
+func (t Topology) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("digraph topology {\n")
+	sb.WriteString("  node [shape=box, fontname=monospace];\n")
+
+	for _, n := range t.Nodes {
+		label := shortPeerId(n.PeerId)
+		if n.Address != "" {
+			label += "\n" + n.Address
+		}
+
+		attrs := []string{"label=" + dotQuote(label)}
+
+		var styles []string
+		if n.Local {
+			styles = append(styles, "filled")
+			attrs = append(attrs, "fillcolor=lightblue")
+		}
+
+		if n.NoAddress {
+			styles = append(styles, "dashed")
+		}
+
+		if len(styles) > 0 {
+			attrs = append(attrs, "style="+dotQuote(strings.Join(styles, ",")))
+		}
+
+		if n.Unreachable {
+			attrs = append(attrs, "color=red", "fontcolor=red")
+		}
+
+		fmt.Fprintf(&sb, "  %s [%s];\n", dotQuote(n.PeerId), strings.Join(attrs, ", "))
+	}
+
+	for _, e := range t.Edges {
+		var attrs []string
+		if !e.Seen {
+			attrs = append(attrs, "style=dotted")
+		}
+
+		if e.Asymmetric {
+			attrs = append(attrs, "color=orange")
+		}
+
+		fmt.Fprintf(&sb, "  %s -> %s", dotQuote(e.From), dotQuote(e.To))
+		if len(attrs) > 0 {
+			fmt.Fprintf(&sb, " [%s]", strings.Join(attrs, ", "))
+		}
+		sb.WriteString(";\n")
+	}
+
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// DOT returns the graph in the Graphviz DOT language, see WriteDOT.
+func (t Topology) DOT() string {
+	var sb strings.Builder
+	t.WriteDOT(&sb)
+	return sb.String()
+}
+
+// shortPeerId keeps the end of the peer id, the start
+// being the same for all the keys of a type.
+func shortPeerId(peerId string) string {
+	if len(peerId) <= 12 {
+		return peerId
+	}
+	return "…" + peerId[len(peerId)-10:]
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
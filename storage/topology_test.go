@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func topologySnapshots() []DebugInfo {
+	addr := func(s string) *string { return &s }
+
+	return []DebugInfo{
+		{
+			ID: "peerA",
+			PeersTable: RoutingTable{
+				LocalNode: Node{PeerId: "peerA", NodeId: "a", Address: addr("10.0.0.1:8090")},
+				Nodes: []Node{
+					{PeerId: "peerB", Address: addr("10.0.0.2:8090"), Seen: true},
+					{PeerId: "peerC", Seen: false},
+				},
+			},
+		},
+		{
+			ID: "peerB",
+			PeersTable: RoutingTable{
+				LocalNode: Node{PeerId: "peerB", NodeId: "b", Address: addr("10.0.0.2:8090")},
+				Nodes: []Node{
+					{PeerId: "peerC", Seen: false},
+				},
+			},
+		},
+	}
+}
+
+func TestBuildTopology(t *testing.T) {
+	topology := BuildTopology(topologySnapshots()...)
+
+	if len(topology.Nodes) != 3 || len(topology.Edges) != 3 {
+		t.Fatalf("unexpected topology %+v", topology)
+	}
+
+	a, _ := topology.Node("peerA")
+	if !a.Local || a.Unreachable || a.NoAddress || a.NodeId != "a" {
+		t.Fatalf("unexpected node %+v", a)
+	}
+
+	c, _ := topology.Node("peerC")
+	if c.Local || !c.Unreachable || !c.NoAddress {
+		t.Fatalf("expected peerC to be unreachable and without address, got %+v", c)
+	}
+
+	ab := topology.Edges[0]
+	if ab.From != "peerA" || ab.To != "peerB" || !ab.Seen || !ab.Asymmetric {
+		t.Fatalf("expected peerA -> peerB to be asymmetric, got %+v", ab)
+	}
+
+	for _, e := range topology.Edges[1:] {
+		if e.To != "peerC" || e.Seen || e.Asymmetric {
+			t.Fatalf("unexpected edge %+v", e)
+		}
+	}
+}
+
+func TestTopologyDOT(t *testing.T) {
+	dot := BuildTopology(topologySnapshots()...).DOT()
+
+	for _, s := range []string{
+		"digraph topology {",
+		`"peerA" [label="peerA\n10.0.0.1:8090", fillcolor=lightblue, style="filled"];`,
+		`"peerC" [label="peerC", style="dashed", color=red, fontcolor=red];`,
+		`"peerA" -> "peerB" [color=orange];`,
+		`"peerB" -> "peerC" [style=dotted];`,
+	} {
+		if !strings.Contains(dot, s) {
+			t.Fatalf("expected %q in:\n%s", s, dot)
+		}
+	}
+}
+
+func TestLoadDebugInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.json")
+
+	data, err := json.Marshal(topologySnapshots()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := LoadDebugInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.ID != "peerA" || len(info.PeersTable.Nodes) != 2 || *info.PeersTable.Nodes[0].Address != "10.0.0.2:8090" {
+		t.Fatalf("unexpected debug info %+v", info)
+	}
+}
@@ -61,6 +61,14 @@ type UploadOptions struct {
 	// after the block is actually stored in the block store. Otherwise, it is called
 	// after the chunk is sent to the stream.
 	OnProgress OnUploadProgressFunc
+
+	// Labels, Description, Uploader and Attributes are recorded in the
+	// catalog attached to the node with SetCatalog, if any.
+	// Uploader defaults to the peer ID of the node.
+	Labels      []string
+	Description string
+	Uploader    string
+	Attributes  map[string]string
 }
 
 func getReaderSize(r io.Reader) int64 {
@@ -82,7 +90,13 @@ func getReaderSize(r io.Reader) int64 {
 // It returns a session ID that can be used for subsequent upload operations.
 // This function is called by UploadReader and UploadFile internally.
 // You should use this function only if you need to manage the upload session manually.
-func (node StorageNode) UploadInit(options *UploadOptions) (string, error) {
+func (node StorageNode) UploadInit(options *UploadOptions) (sessionId string, err error) {
+	op := node.observe(OpUploadInit, Attrs{AttrFilepath: options.Filepath})
+	defer func() {
+		op.set(AttrSessionId, sessionId)
+		op.end(&err)
+	}()
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -101,7 +115,10 @@ func (node StorageNode) UploadInit(options *UploadOptions) (string, error) {
 // and a byte slice containing the chunk data.
 // This function is called by UploadReader internally.
 // You should use this function only if you need to manage the upload session manually.
-func (node StorageNode) UploadChunk(sessionId string, chunk []byte) error {
+func (node StorageNode) UploadChunk(sessionId string, chunk []byte) (err error) {
+	op := node.observe(OpUploadChunk, Attrs{AttrSessionId: sessionId, AttrBytes: len(chunk)})
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -117,7 +134,7 @@ func (node StorageNode) UploadChunk(sessionId string, chunk []byte) error {
 		return bridge.callError("cGoStorageUploadChunk")
 	}
 
-	_, err := bridge.wait()
+	_, err = bridge.wait()
 	return err
 }
 
@@ -125,7 +142,10 @@ func (node StorageNode) UploadChunk(sessionId string, chunk []byte) error {
 // It takes the session ID returned by UploadInit.
 // This function is called by UploadReader and UploadFile internally.
 // You should use this function only if you need to manage the upload session manually.
-func (node StorageNode) UploadFinalize(sessionId string) (string, error) {
+func (node StorageNode) UploadFinalize(sessionId string) (_ string, err error) {
+	op := node.observe(OpUploadFinalize, Attrs{AttrSessionId: sessionId})
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -136,13 +156,23 @@ func (node StorageNode) UploadFinalize(sessionId string) (string, error) {
 		return "", bridge.callError("cGoStorageUploadFinalize")
 	}
 
-	return bridge.wait()
+	cid, err := bridge.wait()
+	if err != nil {
+		return "", err
+	}
+
+	op.set(AttrCid, cid)
+	node.accesses.Touch(cid)
+	return cid, nil
 }
 
 // UploadCancel cancels an ongoing upload session.
 // It can be only if the upload session is managed manually.
 // It doesn't work with UploadFile.
-func (node StorageNode) UploadCancel(sessionId string) error {
+func (node StorageNode) UploadCancel(sessionId string) (err error) {
+	op := node.observe(OpUploadCancel, Attrs{AttrSessionId: sessionId})
+	defer op.end(&err)
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -153,7 +183,7 @@ func (node StorageNode) UploadCancel(sessionId string) error {
 		return bridge.callError("cGoStorageUploadCancel")
 	}
 
-	_, err := bridge.wait()
+	_, err = bridge.wait()
 	return err
 }
 
@@ -166,7 +196,19 @@ func (node StorageNode) UploadCancel(sessionId string) error {
 // - UploadChunk to upload a chunk to storage.
 // - UploadFinalize to finalize the upload session.
 // - UploadCancel if an error occurs.
-func (node StorageNode) UploadReader(ctx context.Context, options UploadOptions, r io.Reader) (string, error) {
+//
+// If a catalog is attached to the node, the dataset is recorded in it,
+// see Catalog.OnRecordError for the failures.
+func (node StorageNode) UploadReader(ctx context.Context, options UploadOptions, r io.Reader) (cid string, err error) {
+	total := 0
+
+	op := node.observe(OpUploadReader, Attrs{AttrFilepath: options.Filepath})
+	defer func() {
+		op.set(AttrCid, cid)
+		op.set(AttrBytes, total)
+		op.end(&err)
+	}()
+
 	sessionId, err := node.UploadInit(&options)
 	if err != nil {
 		return "", err
@@ -174,7 +216,6 @@ func (node StorageNode) UploadReader(ctx context.Context, options UploadOptions,
 	defer node.UploadCancel(sessionId)
 
 	buf := make([]byte, options.ChunkSize.valOrDefault())
-	total := 0
 
 	var size int64
 	if options.OnProgress != nil {
@@ -231,7 +272,14 @@ func (node StorageNode) UploadReader(ctx context.Context, options UploadOptions,
 		}
 	}
 
-	return node.UploadFinalize(sessionId)
+	cid, err = node.UploadFinalize(sessionId)
+	if err != nil {
+		return "", err
+	}
+
+	node.catalogUpload(cid, options)
+
+	return cid, nil
 }
 
 // UploadReaderAsync is the asynchronous version of UploadReader using a goroutine.
@@ -262,7 +310,16 @@ func (node StorageNode) UploadReaderAsync(ctx context.Context, options UploadOpt
 // is sent to the stream.
 //
 // Internally, it calls UploadInit to create the upload session.
-func (node StorageNode) UploadFile(ctx context.Context, options UploadOptions) (string, error) {
+//
+// If a catalog is attached to the node, the dataset is recorded in it,
+// see Catalog.OnRecordError for the failures.
+func (node StorageNode) UploadFile(ctx context.Context, options UploadOptions) (cid string, err error) {
+	op := node.observe(OpUploadFile, Attrs{AttrFilepath: options.Filepath})
+	defer func() {
+		op.set(AttrCid, cid)
+		op.end(&err)
+	}()
+
 	bridge := newBridgeCtx()
 	defer bridge.free()
 
@@ -345,7 +402,15 @@ func (node StorageNode) UploadFile(ctx context.Context, options UploadOptions) (
 		return "", err
 	}
 
-	return bridge.result, cancelErr
+	node.accesses.Touch(bridge.result)
+
+	if cancelErr != nil {
+		return bridge.result, cancelErr
+	}
+
+	node.catalogUpload(bridge.result, options)
+
+	return bridge.result, nil
 }
 
 // UploadFileAsync is the asynchronous version of UploadFile using a goroutine.